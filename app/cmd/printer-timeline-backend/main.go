@@ -1,71 +1,106 @@
 package main
 
 import (
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
 	"fmt"
+
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
 
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/awslambda"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
 	initConfig "bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/gin"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func createCloudWatch(sess *session.Session) (*cloudwatchlogs.CloudWatchLogs, error) {
 	return cloudwatchlogs.New(sess), nil
 }
 
-func createQueryExecutor(svc *cloudwatchlogs.CloudWatchLogs) cloudwatch.QueryExecutor {
-	return cloudwatch.NewQueryExecutorImpl(svc)
+func createQueryExecutor(svc *cloudwatchlogs.CloudWatchLogs, sess *session.Session) (cloudwatch.QueryExecutor, error) {
+	polling := cloudwatch.PollingStrategy{
+		InitialDelay:  initConfig.GetQueryPollInitialDelay(),
+		BackoffFactor: initConfig.GetQueryPollBackoffFactor(),
+		MaxDelay:      initConfig.GetQueryPollMaxDelay(),
+		Timeout:       initConfig.GetQueryTimeout(),
+	}
+	queryExecutor := cloudwatch.NewQueryExecutorImpl(svc, polling)
+
+	var cache cloudwatch.QueryCache
+	switch initConfig.GetQueryCacheBackend() {
+	case initConfig.QueryCacheBackendNone:
+		return queryExecutor, nil
+	case initConfig.QueryCacheBackendDynamo:
+		dynamoCache, err := db.NewQueryCacheCollectionWithSession(sess, initConfig.GetQueryCacheTTL())
+		if err != nil {
+			return nil, err
+		}
+		cache = dynamoCache
+	default:
+		memoryCache, err := cloudwatch.NewMemoryQueryCache(initConfig.GetQueryCacheSize(), initConfig.GetQueryCacheMaxBytes())
+		if err != nil {
+			return nil, err
+		}
+		cache = memoryCache
+	}
+	return cloudwatch.NewCachingQueryExecutor(queryExecutor, cache, initConfig.GetQueryCacheSettleMargin()), nil
 }
 
-func createS3Fetcher(sess *session.Session) storage.S3Fetcher {
-	svc := s3.New(sess)
-	return svc
+func createS3Fetcher(sess *session.Session, region string) (storage.S3Fetcher, error) {
+	svc := s3.New(sess, aws.NewConfig().WithRegion(region))
+	return svc, nil
 }
 
 func main() {
 	initConfig.Init()
+	if err := initConfig.Validate(); err != nil {
+		panic(err)
+	}
 
-	sess1, sess2, err := initConfig.CreateAWSSession()
+	sess, err := initConfig.CreateAWSSession()
 	if err != nil {
 		panic(err)
 	}
 
-	svc, err := createCloudWatch(sess1)
+	svc, err := createCloudWatch(sess)
 	if err != nil {
 		panic(err)
 	}
 
-	queryExecutor := createQueryExecutor(svc)
+	queryExecutor, err := createQueryExecutor(svc, sess)
+	if err != nil {
+		panic(err)
+	}
 
-	xmlsFetcher := datafetcher.NewOpenXmlsFetcher(queryExecutor)
-	cloudJsonFetcher := datafetcher.NewCloudJsonsFetcher(queryExecutor)
-	heartbeatsFetcher := datafetcher.NewHeartbeatsFetcher(queryExecutor)
-	rtaFetcher := datafetcher.NewRtaFetcher(queryExecutor)
+	eventDefinitions, err := datafetcher.LoadEventDefinitions(initConfig.GetEventDefinitionsFile())
+	if err != nil {
+		panic(err)
+	}
+	sources := datafetcher.NewSources(eventDefinitions, queryExecutor)
+	fleetFetcher := datafetcher.NewAggregationFetcher(eventDefinitions, queryExecutor, initConfig.GetFleetBin())
 
-	s3FetcherUsEast1 := createS3Fetcher(sess1)
-	s3FetcherUsWest1 := createS3Fetcher(sess2)
+	s3Registry := storage.NewRegionRegistry(initConfig.GetS3Regions(), func(region string) (storage.S3Fetcher, error) {
+		return createS3Fetcher(sess, region)
+	})
 
-	printerSubscriptionFetcher, err := db.NewCCPrinterSubscriptionCollectionWithSession(sess1)
+	printerSubscriptionFetcher, err := db.NewCCPrinterSubscriptionCollectionWithSession(sess)
 	if err != nil {
 		panic(err)
 	}
 
 	dev := initConfig.IsDevelopment()
 	if dev {
-		router := gin.InitRouter(s3FetcherUsEast1, s3FetcherUsWest1, xmlsFetcher, cloudJsonFetcher, heartbeatsFetcher, rtaFetcher, printerSubscriptionFetcher)
+		router := gin.InitRouter(s3Registry, sources, fleetFetcher, printerSubscriptionFetcher)
 		if err := router.Run(); err != nil {
 			fmt.Println(err)
 			return
 		}
 	} else {
-		lambda.Start(awslambda.CreateLambdaHandler(s3FetcherUsEast1, s3FetcherUsWest1, xmlsFetcher, cloudJsonFetcher, heartbeatsFetcher, rtaFetcher, printerSubscriptionFetcher))
+		lambda.Start(awslambda.CreateLambdaHandler(s3Registry, sources, fleetFetcher, printerSubscriptionFetcher))
 	}
 }
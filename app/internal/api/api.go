@@ -1,17 +1,22 @@
 package api
 
 import (
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+	"context"
 	"net/http"
+	"time"
 
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
 	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
 )
 
 //go:generate mockgen -source=../datafetcher/datafetcher.go -destination=../datafetcher/mocks/datafetcher.go -package=mocks
 
 // SelectHTTPStatus returns the appropriate http status based on the error passed as a parameter.
+// The gin and the lambda handlers respond to the errors with it.
 func SelectHTTPStatus(err error) int {
 	switch err {
 	case nil:
@@ -20,21 +25,92 @@ func SelectHTTPStatus(err error) int {
 		ErrorQueryStringMissingEndTime, ErrorQueryStringEndTimeAppears, ErrorQueryStringUnsupportedEndTime,
 		ErrorQueryStringMissingOffsetUnits, ErrorQueryStringUnsupportedOffsetUnits, ErrorQueryStringMissingOffsetValue,
 		ErrorQueryStringUnsupportedOffsetValue, ErrorQueryStringMissingStartTime, ErrorQueryStringUnsupportedStartTime,
-		ErrorQueryStringTimeDifferenceTooBig, ErrorQueryStringEndTimePreviousThanStartTime, ErrorQueryStringPnSn:
+		ErrorQueryStringTimeDifferenceTooBig, ErrorQueryStringEndTimePreviousThanStartTime, ErrorQueryStringPnSn,
+		ErrorQueryStringUnsupportedCursor, ErrorQueryStringUnsupportedChunked, ErrorQueryStringMalformedProductNumber,
+		ErrorQueryStringMalformedSerialNumber, ErrorQueryStringUnsupportedDuration, ErrorQueryStringDurationConflict,
+		ErrorQueryStringMissingProductNumber, ErrorQueryStringMissingSerialNumber, ErrorQueryStringUnsupportedInterval,
+		ErrorQueryStringMissingAnchorTime, ErrorQueryStringUnsupportedAnchorTime, ErrorQueryStringMissingAroundOffsets,
+		ErrorQueryStringUnsupportedObjectMode, ErrorQueryStringUnsupportedObjectFormat, ErrorQueryStringMissingBucketRegion,
+		ErrorQueryStringUnsupportedBucketRegion, ErrorQueryStringMissingBucketName, ErrorQueryStringMissingObjectKey,
+		ErrorQueryStringMissingAccountID, db.MalformedSubscriptionErr, db.InvalidPrinterIDErr, db.MissingAccountIDErr,
+		db.UnsupportedServiceErr, ErrorQueryStringMissingService, ErrorQueryStringUnsupportedLimit, db.InvalidPageTokenErr,
+		ErrorQueryStringUnsupportedConsistent, ErrorQueryStringUnsupportedInclude:
 		return http.StatusBadRequest
-	case db.NotFoundErr:
+	case storage.ErrorAccessDenied:
+		return http.StatusForbidden
+	case db.NotFoundErr, db.ConditionalDelErr, storage.ErrorObjectNotFound:
 		return http.StatusNotFound
+	case db.ConditionalPutErr, db.ConcurrentDelErr:
+		return http.StatusConflict
+	case storage.ErrorRangeNotSatisfiable:
+		return http.StatusRequestedRangeNotSatisfiable
+	case storage.ErrorObjectTooBig, storage.ErrorMalformedContent, storage.ErrorContentNotConvertible:
+		return http.StatusUnprocessableEntity
+	case storage.ErrorRenderedObjectTooBig:
+		return http.StatusRequestEntityTooLarge
+	case cloudwatch.ErrorQueryFailed, cloudwatch.ErrorQueryCancelled, storage.ErrorReadingObject:
+		return http.StatusBadGateway
+	case cloudwatch.ErrorQueryTimeout, context.DeadlineExceeded:
+		return http.StatusGatewayTimeout
 	default:
 		return http.StatusInternalServerError
 	}
 }
 
+// GetFleet obtains the summary of the printers of the product number of queryParameters.
+func GetFleet(ctx context.Context, queryParameters map[string]string, fetcher datafetcher.FleetFetcher) (status int, result *datafetcher.FleetSummary, err error) {
+	result, err = fetcher.FetchFleet(ctx, queryParameters)
+	status = SelectHTTPStatus(err)
+	return status, result, err
+}
+
+// fetchAllEvents follows the cursors of fetcher until the last page or until the scan budget of ctx is exhausted.
+// It returns the cursor of the next page, empty when all the events were obtained.
+func fetchAllEvents(ctx context.Context, queryParameters map[string]string, fetcher datafetcher.DataFetcher) (events []datafetcher.TimelineEvent, nextCursor string, err error) {
+	budget := datafetcher.ScanBudgetFromContext(ctx)
+	if budget == nil {
+		ctx, budget = datafetcher.WithScanBudget(ctx, configs.GetScanBudgetBytes())
+	}
+
+	pageParameters := make(map[string]string, len(queryParameters))
+	for k, v := range queryParameters {
+		pageParameters[k] = v
+	}
+
+	for {
+		page, err := fetcher.FetchData(ctx, pageParameters)
+		if err != nil {
+			return nil, "", err
+		}
+		events = append(events, page.Events...)
+
+		if page.NextCursor == "" || page.NextCursor == pageParameters[configs.CursorQueryParam] {
+			return events, "", nil
+		}
+		if budget.Exhausted() {
+			return events, page.NextCursor, nil
+		}
+		pageParameters[configs.CursorQueryParam] = page.NextCursor
+	}
+}
+
+// eventsBefore returns the events whose timestamp is previous to limit.
+func eventsBefore(events []datafetcher.TimelineEvent, limit time.Time) []datafetcher.TimelineEvent {
+	filtered := make([]datafetcher.TimelineEvent, 0, len(events))
+	for _, event := range events {
+		if event.Timestamp.Before(limit) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
 // GetData is the responsible of obtaining the data based in the queryParameters.
 // This function is independent of the Framework used to create the web server as its input is just
 // a maputil containing the http query parameters.
 // A DataFetcher is injected in order to obtain the data.
-func GetData(queryParameters map[string]string, fetcher datafetcher.DataFetcher) (status int, result *cloudwatchlogs.GetQueryResultsOutput, err error) {
-	result, err = fetcher.FetchData(queryParameters)
+func GetData(ctx context.Context, queryParameters map[string]string, fetcher datafetcher.DataFetcher) (status int, result *datafetcher.EventsPage, err error) {
+	result, err = fetcher.FetchData(ctx, queryParameters)
 	status = SelectHTTPStatus(err)
 	return status, result, err
 }
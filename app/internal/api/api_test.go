@@ -1,15 +1,24 @@
 package api_test
 
 import (
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher/mocks"
+	"context"
 	"errors"
-	"github.com/golang/mock/gomock"
 	"net/http"
+	"time"
 
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/api"
-	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/api"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher/mocks"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+	dbMocks "bitbucket.org/aldoft/printer-timeline-backend/app/internal/db/mocks"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
 )
 
 var _ = Describe("Api", func() {
@@ -20,14 +29,746 @@ var _ = Describe("Api", func() {
 				defer mockCtrl.Finish()
 
 				mockDataFetcher := mocks.NewMockDataFetcher(mockCtrl)
-				mockDataFetcher.EXPECT().FetchData(gomock.All()).Return(nil, ErrorQueryStringMissingTimeRangeType).Times(1)
+				mockDataFetcher.EXPECT().FetchData(gomock.Any(), gomock.All()).Return(nil, ErrorQueryStringMissingTimeRangeType).Times(1)
 
 				queryparams := map[string]string{}
-				status, result, err := api.GetData(queryparams, mockDataFetcher)
+				status, result, err := api.GetData(context.Background(), queryparams, mockDataFetcher)
+
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+				Expect(err).To(Equal(ErrorQueryStringMissingTimeRangeType))
+			})
+		})
+	})
+
+	Describe("GetFleet", func() {
+		Context("When the product number is missing", func() {
+			It("returns bad request status and the error", func() {
+				mockCtrl := gomock.NewController(GinkgoT())
+				defer mockCtrl.Finish()
+
+				mockFleetFetcher := mocks.NewMockFleetFetcher(mockCtrl)
+				mockFleetFetcher.EXPECT().FetchFleet(gomock.Any(), gomock.Any()).Return(nil, ErrorQueryStringMissingProductNumber).Times(1)
+
+				status, result, err := api.GetFleet(context.Background(), map[string]string{}, mockFleetFetcher)
+
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+				Expect(err).To(Equal(ErrorQueryStringMissingProductNumber))
+			})
+		})
+
+		Context("When the fleet is fetched", func() {
+			It("returns ok status and the summary", func() {
+				mockCtrl := gomock.NewController(GinkgoT())
+				defer mockCtrl.Finish()
+
+				summary := &datafetcher.FleetSummary{ProductNumber: "L2E27A"}
+				mockFleetFetcher := mocks.NewMockFleetFetcher(mockCtrl)
+				mockFleetFetcher.EXPECT().FetchFleet(gomock.Any(), gomock.Any()).Return(summary, nil).Times(1)
+
+				status, result, err := api.GetFleet(context.Background(), map[string]string{configs.ProductNumberQueryParam: "L2E27A"}, mockFleetFetcher)
+
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result).To(Equal(summary))
+				Expect(err).To(BeNil())
+			})
+		})
+	})
+
+	Describe("GetTimeline", func() {
+		var mockCtrl *gomock.Controller
+		var mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher *mocks.MockDataFetcher
+		var queryParams map[string]string
+
+		queryResults := func(timestamps ...string) *datafetcher.EventsPage {
+			page := &datafetcher.EventsPage{Events: []datafetcher.TimelineEvent{}}
+			for _, timestamp := range timestamps {
+				t, err := time.Parse("2006-01-02 15:04:05.000", timestamp)
+				Expect(err).To(BeNil())
+				page.Events = append(page.Events, datafetcher.TimelineEvent{Timestamp: t})
+			}
+			return page
+		}
+
+		timelineSources := func() []datafetcher.Source {
+			return []datafetcher.Source{
+				{Name: api.OpenXMLSource, Fetcher: mockXMLFetcher},
+				{Name: api.CloudJsonSource, Fetcher: mockCloudJSONFetcher},
+				{Name: api.HeartbeatSource, Fetcher: mockHeartbeatFetcher},
+				{Name: api.RTASource, Fetcher: mockRTAFetcher},
+			}
+		}
+
+		BeforeEach(func() {
+			configs.Init()
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockXMLFetcher = mocks.NewMockDataFetcher(mockCtrl)
+			mockCloudJSONFetcher = mocks.NewMockDataFetcher(mockCtrl)
+			mockHeartbeatFetcher = mocks.NewMockDataFetcher(mockCtrl)
+			mockRTAFetcher = mocks.NewMockDataFetcher(mockCtrl)
+
+			queryParams = map[string]string{
+				configs.TimeTypeQueryParam:    "relative",
+				configs.OffsetUnitsQueryParam: "minutes",
+				configs.OffsetValueQueryParam: "10",
+			}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		Context("When all the sources return events", func() {
+			It("returns the events of all the sources merged in chronological order", func() {
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:25:00.347", "2020-09-16 09:30:00.000"), nil)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:26:00.000"), nil)
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:20:00.000"), nil)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, nil)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.Errors).To(BeEmpty())
+				Expect(result.Entries).To(HaveLen(4))
+				Expect(result.Entries[0].Source).To(Equal(api.HeartbeatSource))
+				Expect(result.Entries[1].Source).To(Equal(api.OpenXMLSource))
+				Expect(result.Entries[2].Source).To(Equal(api.CloudJsonSource))
+				Expect(result.Entries[3].Source).To(Equal(api.OpenXMLSource))
+			})
+
+			It("queries all the sources with the same absolute time range", func() {
+				var received []map[string]string
+				record := func(ctx context.Context, params map[string]string) (*datafetcher.EventsPage, error) {
+					received = append(received, params)
+					return queryResults(), nil
+				}
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).DoAndReturn(record)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+
+				fetchers := timelineSources()
+				_, _, err := api.GetTimeline(context.Background(), queryParams, fetchers, nil)
+
+				Expect(err).To(BeNil())
+				Expect(received).To(HaveLen(1))
+				Expect(received[0][configs.TimeTypeQueryParam]).To(Equal("absolute"))
+				Expect(received[0][configs.StartTimeQueryParam]).NotTo(BeEmpty())
+				Expect(received[0][configs.EndTimeQueryParam]).NotTo(BeEmpty())
+			})
+		})
+
+		Context("When some source has more events than fit in a page", func() {
+			It("returns the events previous to the earliest cursor and that cursor", func() {
+				xmlPage := queryResults("2020-09-16 09:20:00.000", "2020-09-16 09:25:00.347")
+				xmlPage.NextCursor = EncodeCursor(time.Date(2020, 9, 16, 9, 26, 0, 0, time.UTC), time.Date(2020, 9, 16, 9, 20, 0, 0, time.UTC), time.Date(2020, 9, 16, 9, 30, 0, 0, time.UTC))
+				cloudJsonPage := queryResults("2020-09-16 09:21:00.000", "2020-09-16 09:24:00.000")
+				cloudJsonPage.NextCursor = EncodeCursor(time.Date(2020, 9, 16, 9, 24, 0, 0, time.UTC), time.Date(2020, 9, 16, 9, 20, 0, 0, time.UTC), time.Date(2020, 9, 16, 9, 30, 0, 0, time.UTC))
+
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(xmlPage, nil)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(cloudJsonPage, nil)
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:23:59.999", "2020-09-16 09:30:00.000"), nil)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, nil)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.NextCursor).To(Equal(cloudJsonPage.NextCursor))
+				Expect(result.Entries).To(HaveLen(3))
+				Expect(result.Entries[0].Source).To(Equal(api.OpenXMLSource))
+				Expect(result.Entries[1].Source).To(Equal(api.CloudJsonSource))
+				Expect(result.Entries[2].Source).To(Equal(api.HeartbeatSource))
+			})
+		})
+
+		Context("When some of the sources fail", func() {
+			It("returns the events of the other sources and reports the failure per source", func() {
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:25:00.347"), nil)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, errors.New("cloud json error"))
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:20:00.000"), nil)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, errors.New("rta error"))
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, nil)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.Entries).To(HaveLen(2))
+				Expect(result.Errors).To(Equal(map[string]string{
+					api.CloudJsonSource: "cloud json error",
+					api.RTASource:       "rta error",
+				}))
+			})
+		})
+
+		Context("When all the sources fail", func() {
+			It("returns the error", func() {
+				fetchErr := errors.New("fetch error")
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, fetchErr)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, fetchErr)
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, fetchErr)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, fetchErr)
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, nil)
+
+				Expect(err).To(Equal(fetchErr))
+				Expect(status).To(Equal(http.StatusInternalServerError))
+				Expect(result).To(BeNil())
+			})
+		})
+
+		Context("When the subscriptions are included", func() {
+			var mockSubscriptionFetcher *dbMocks.MockPrinterSubscriptionFetcher
+
+			BeforeEach(func() {
+				mockSubscriptionFetcher = dbMocks.NewMockPrinterSubscriptionFetcher(mockCtrl)
+				queryParams = map[string]string{
+					configs.TimeTypeQueryParam:      "absolute",
+					configs.StartTimeQueryParam:     "2020-09-16T09:20:00Z",
+					configs.EndTimeQueryParam:       "2020-09-16T09:30:00Z",
+					configs.ProductNumberQueryParam: "cz056a",
+					configs.SerialNumberQueryParam:  "sg4491p001",
+					configs.IncludeQueryParam:       "subscriptions",
+				}
+			})
+
+			registeredAt := func(timestamp string) int64 {
+				t, err := time.Parse("2006-01-02 15:04:05", timestamp)
+				Expect(err).To(BeNil())
+				return t.Unix()
+			}
+
+			It("merges the registrations of the subscriptions in the time range with the events of the sources", func() {
+				subscriptions := []*db.CCPrinterSubscriptionModel{
+					{PrinterID: "CZ056A!SG4491P001", AccountID: "account-2", ServiceID: db.Services[0], RegistrationTimeEpoch: registeredAt("2020-09-16 09:27:00")},
+					{PrinterID: "CZ056A!SG4491P001", AccountID: "account-1", ServiceID: db.Services[0], RegistrationTimeEpoch: registeredAt("2020-09-16 09:22:00")},
+					{PrinterID: "CZ056A!SG4491P001", AccountID: "account-0", ServiceID: db.Services[0], RegistrationTimeEpoch: registeredAt("2020-09-15 09:00:00")},
+				}
+				mockSubscriptionFetcher.EXPECT().GetPrinterSubscriptions(gomock.Any(), "CZ056A!SG4491P001").Return(subscriptions, nil)
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:25:00.347"), nil)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:20:00.000"), nil)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.Errors).To(BeEmpty())
+				Expect(result.Entries).To(HaveLen(4))
+				Expect(result.Entries[0].Source).To(Equal(api.HeartbeatSource))
+				Expect(result.Entries[1].Source).To(Equal(api.SubscriptionsSource))
+				Expect(result.Entries[1].Attributes).To(Equal(map[string]string{"account_id": "account-1", "service_id": string(db.Services[0])}))
+				Expect(result.Entries[2].Source).To(Equal(api.OpenXMLSource))
+				Expect(result.Entries[3].Source).To(Equal(api.SubscriptionsSource))
+				Expect(result.Entries[3].Attributes["account_id"]).To(Equal("account-2"))
+			})
+
+			It("does not report an error when the printer has no subscriptions", func() {
+				mockSubscriptionFetcher.EXPECT().GetPrinterSubscriptions(gomock.Any(), "CZ056A!SG4491P001").Return(nil, db.NotFoundErr)
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:25:00.347"), nil)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.Errors).To(BeEmpty())
+				Expect(result.Entries).To(HaveLen(1))
+			})
+
+			It("reports the failure of the subscriptions as the one of a source", func() {
+				mockSubscriptionFetcher.EXPECT().GetPrinterSubscriptions(gomock.Any(), gomock.Any()).Return(nil, errors.New("dynamo error"))
+				mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults("2020-09-16 09:25:00.347"), nil)
+				mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+				mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(queryResults(), nil)
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.Entries).To(HaveLen(1))
+				Expect(result.Errors).To(Equal(map[string]string{api.SubscriptionsSource: "dynamo error"}))
+			})
+
+			It("returns missing serial number error when the serial number is missing", func() {
+				delete(queryParams, configs.SerialNumberQueryParam)
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringMissingSerialNumber))
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+			})
+
+			It("returns unsupported include error when the data to include is not supported", func() {
+				queryParams[configs.IncludeQueryParam] = "subscriptions,accounts"
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedInclude))
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+			})
+		})
+
+		Context("When there is an error in query parameters", func() {
+			It("does not call any fetcher and returns the error", func() {
+				queryParams := map[string]string{}
+
+				fetchers := timelineSources()
+				status, result, err := api.GetTimeline(context.Background(), queryParams, fetchers, nil)
+
+				Expect(err).To(Equal(ErrorQueryStringMissingTimeRangeType))
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+			})
+		})
+	})
+
+	Describe("GetPrinterSubscriptions", func() {
+		var mockCtrl *gomock.Controller
+		var mockSubscriptionFetcher *dbMocks.MockPrinterSubscriptionFetcher
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockSubscriptionFetcher = dbMocks.NewMockPrinterSubscriptionFetcher(mockCtrl)
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		Context("When the printer identifiers are not normalized", func() {
+			It("looks up the normalized printer id", func() {
+				subscriptions := []*db.CCPrinterSubscriptionModel{{PrinterID: "CZ056A!SG4491P001"}}
+				mockSubscriptionFetcher.EXPECT().GetPrinterSubscriptions(gomock.Any(), "CZ056A!SG4491P001").Return(subscriptions, nil)
+
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: " cz056a ",
+					configs.SerialNumberQueryParam:  "sg4491p001",
+				}
+				status, result, err := api.GetPrinterSubscriptions(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result).To(Equal(subscriptions))
+			})
+		})
+
+		Context("When the subscriptions are read with consistency", func() {
+			It("follows the pages of strongly consistent queries", func() {
+				first := &db.CCPrinterSubscriptionModel{PrinterID: "CZ056A!SG4491P001", AccountID: "fibo24"}
+				second := &db.CCPrinterSubscriptionModel{PrinterID: "CZ056A!SG4491P001", AccountID: "pr12345678"}
+				gomock.InOrder(
+					mockSubscriptionFetcher.EXPECT().QueryPrinterSubscriptions(gomock.Any(), "CZ056A!SG4491P001", db.QueryOptions{ConsistentRead: true}).
+						Return(&db.SubscriptionsPage{Subscriptions: []*db.CCPrinterSubscriptionModel{first}, NextPageToken: "next"}, nil),
+					mockSubscriptionFetcher.EXPECT().QueryPrinterSubscriptions(gomock.Any(), "CZ056A!SG4491P001", db.QueryOptions{PageToken: "next", ConsistentRead: true}).
+						Return(&db.SubscriptionsPage{Subscriptions: []*db.CCPrinterSubscriptionModel{second}}, nil),
+				)
+
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "CZ056A",
+					configs.SerialNumberQueryParam:  "SG4491P001",
+					configs.ConsistentQueryParam:    "true",
+				}
+				status, result, err := api.GetPrinterSubscriptions(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result).To(Equal([]*db.CCPrinterSubscriptionModel{first, second}))
+			})
+
+			It("returns not found if there are none", func() {
+				mockSubscriptionFetcher.EXPECT().QueryPrinterSubscriptions(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&db.SubscriptionsPage{Subscriptions: []*db.CCPrinterSubscriptionModel{}}, nil)
+
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "CZ056A",
+					configs.SerialNumberQueryParam:  "SG4491P001",
+					configs.ConsistentQueryParam:    "1",
+				}
+				status, _, err := api.GetPrinterSubscriptions(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(db.NotFoundErr))
+				Expect(status).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("When a page of the subscriptions is queried", func() {
+			It("queries the page of the token with the limit and the consistency", func() {
+				page := &db.SubscriptionsPage{Subscriptions: []*db.CCPrinterSubscriptionModel{{PrinterID: "CZ056A!SG4491P001"}}}
+				mockSubscriptionFetcher.EXPECT().QueryPrinterSubscriptions(gomock.Any(), "CZ056A!SG4491P001",
+					db.QueryOptions{Limit: 5, PageToken: "token", ConsistentRead: true}).Return(page, nil)
+
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "CZ056A",
+					configs.SerialNumberQueryParam:  "SG4491P001",
+					configs.LimitQueryParam:         "5",
+					configs.PageTokenQueryParam:     "token",
+					configs.ConsistentQueryParam:    "true",
+				}
+				Expect(api.IsPaginated(queryParams)).To(BeTrue())
+				status, result, err := api.QueryPrinterSubscriptions(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result).To(Equal(page))
+			})
+
+			It("returns bad request when consistent is not a boolean", func() {
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "CZ056A",
+					configs.SerialNumberQueryParam:  "SG4491P001",
+					configs.PageTokenQueryParam:     "token",
+					configs.ConsistentQueryParam:    "strong",
+				}
+				status, result, err := api.QueryPrinterSubscriptions(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedConsistent))
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+			})
+		})
 
+		Context("When the serial number is malformed", func() {
+			It("returns bad request without looking up the subscriptions", func() {
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "CZ056A",
+					configs.SerialNumberQueryParam:  "SG4491P001" + db.PrinterIdSeparator + "X",
+				}
+				status, result, err := api.GetPrinterSubscriptions(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringMalformedSerialNumber))
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+			})
+		})
+	})
+
+	Describe("Subscription of a printer with an account", func() {
+		var mockCtrl *gomock.Controller
+		var mockSubscriptionFetcher *dbMocks.MockPrinterSubscriptionFetcher
+		var queryParams map[string]string
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockSubscriptionFetcher = dbMocks.NewMockPrinterSubscriptionFetcher(mockCtrl)
+			queryParams = map[string]string{
+				configs.ProductNumberQueryParam: "cz056a",
+				configs.SerialNumberQueryParam:  "SG4491P001",
+				configs.AccountIDQueryParam:     " pr12345678 ",
+			}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		Context("When it is retrieved", func() {
+			It("looks up the normalized printer id and the account", func() {
+				subscription := db.CCPrinterSubscriptionModel{PrinterID: "CZ056A!SG4491P001", AccountID: "pr12345678"}
+				mockSubscriptionFetcher.EXPECT().Get(gomock.Any(), "CZ056A!SG4491P001", "pr12345678").Return(subscription, nil)
+
+				status, result, err := api.GetPrinterSubscription(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(*result).To(Equal(subscription))
+			})
+
+			It("returns not found if it doesn't exist", func() {
+				mockSubscriptionFetcher.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(db.CCPrinterSubscriptionModel{}, db.NotFoundErr)
+
+				status, result, err := api.GetPrinterSubscription(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(db.NotFoundErr))
+				Expect(status).To(Equal(http.StatusNotFound))
+				Expect(result).To(BeNil())
+			})
+
+			It("returns bad request without the account", func() {
+				delete(queryParams, configs.AccountIDQueryParam)
+
+				status, result, err := api.GetPrinterSubscription(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringMissingAccountID))
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+			})
+
+			It("returns bad request without the serial number", func() {
+				delete(queryParams, configs.SerialNumberQueryParam)
+
+				status, _, err := api.GetPrinterSubscription(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringMissingSerialNumber))
+				Expect(status).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("When it is created", func() {
+			It("stores the subscription with the printer normalized", func() {
+				var stored *db.CCPrinterSubscriptionModel
+				mockSubscriptionFetcher.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, subscription *db.CCPrinterSubscriptionModel) error {
+						stored = subscription
+						return nil
+					})
+
+				body := []byte(`{"PN": "cz056a", "SN": " sg4491p001", "AccountID": "pr12345678", "ServiceID": "PRINTOS"}`)
+				status, result, err := api.CreatePrinterSubscription(context.Background(), body, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusCreated))
+				Expect(result).To(Equal(stored))
+				Expect(result.PrinterID).To(Equal("CZ056A!SG4491P001"))
+				Expect(result.ProductNumber).To(Equal("CZ056A"))
+				Expect(result.SerialNumber).To(Equal("SG4491P001"))
+				Expect(result.ServiceID).To(Equal(db.Service(db.ServicePrintOS)))
+				Expect(result.RegistrationTimeEpoch).To(BeNumerically("~", time.Now().Unix(), 5))
+			})
+
+			It("accepts the printer id instead of the product and serial numbers", func() {
+				mockSubscriptionFetcher.EXPECT().Put(gomock.Any(), gomock.Any()).Return(nil)
+
+				body := []byte(`{"PrinterID": "CZ056A!SG4491P001", "AccountID": "fibo24", "ServiceID": "fibo24", "RegistrationTimeEpoch": 1600248300}`)
+				status, result, err := api.CreatePrinterSubscription(context.Background(), body, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusCreated))
+				Expect(result.ProductNumber).To(Equal("CZ056A"))
+				Expect(result.SerialNumber).To(Equal("SG4491P001"))
+				Expect(result.RegistrationTimeEpoch).To(BeEquivalentTo(1600248300))
+			})
+
+			It("returns conflict if it already exists", func() {
+				mockSubscriptionFetcher.EXPECT().Put(gomock.Any(), gomock.Any()).Return(db.ConditionalPutErr)
+
+				body := []byte(`{"PN": "CZ056A", "SN": "SG4491P001", "AccountID": "pr12345678", "ServiceID": "PRINTOS"}`)
+				status, result, err := api.CreatePrinterSubscription(context.Background(), body, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(db.ConditionalPutErr))
+				Expect(status).To(Equal(http.StatusConflict))
+				Expect(result).To(BeNil())
+			})
+
+			invalidBodies := []struct {
+				description string
+				body        string
+				err         error
+			}{
+				{"the body is not JSON", `PN=CZ056A`, db.MalformedSubscriptionErr},
+				{"the printer is missing", `{"AccountID": "pr12345678", "ServiceID": "PRINTOS"}`, db.InvalidPrinterIDErr},
+				{"the serial number is malformed", `{"PN": "CZ056A", "SN": "SG!1", "AccountID": "pr12345678", "ServiceID": "PRINTOS"}`, db.InvalidPrinterIDErr},
+				{"the printer id doesn't match the product number", `{"PrinterID": "CZ056A!SG4491P001", "PN": "Y0U23A", "SN": "SG4491P001", "AccountID": "pr12345678", "ServiceID": "PRINTOS"}`, db.InvalidPrinterIDErr},
+				{"the account is missing", `{"PN": "CZ056A", "SN": "SG4491P001", "AccountID": " ", "ServiceID": "PRINTOS"}`, db.MissingAccountIDErr},
+				{"the service is unknown", `{"PN": "CZ056A", "SN": "SG4491P001", "AccountID": "pr12345678", "ServiceID": "Unknown"}`, db.UnsupportedServiceErr},
+				{"the service has another case", `{"PN": "CZ056A", "SN": "SG4491P001", "AccountID": "pr12345678", "ServiceID": "printos"}`, db.UnsupportedServiceErr},
+			}
+			for _, f := range invalidBodies {
+				f := f
+				It("returns bad request without storing it when "+f.description, func() {
+					status, result, err := api.CreatePrinterSubscription(context.Background(), []byte(f.body), mockSubscriptionFetcher)
+
+					Expect(err).To(Equal(f.err))
+					Expect(status).To(Equal(http.StatusBadRequest))
+					Expect(result).To(BeNil())
+				})
+			}
+		})
+
+		Context("When it is deleted", func() {
+			It("removes the subscription of the normalized printer id and the account", func() {
+				mockSubscriptionFetcher.EXPECT().Delete(gomock.Any(), "CZ056A!SG4491P001", "pr12345678").Return(nil)
+
+				status, err := api.DeletePrinterSubscription(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusNoContent))
+			})
+
+			It("returns not found if it doesn't exist", func() {
+				mockSubscriptionFetcher.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Return(db.ConditionalDelErr)
+
+				status, err := api.DeletePrinterSubscription(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(db.ConditionalDelErr))
+				Expect(status).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("Subscriptions by account and by service", func() {
+		var mockCtrl *gomock.Controller
+		var mockSubscriptionFetcher *dbMocks.MockPrinterSubscriptionFetcher
+		var page *db.SubscriptionsPage
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockSubscriptionFetcher = dbMocks.NewMockPrinterSubscriptionFetcher(mockCtrl)
+			page = &db.SubscriptionsPage{
+				Subscriptions: []*db.CCPrinterSubscriptionModel{{PrinterID: "CZ056A!SG4491P001", AccountID: "pr12345678"}},
+				NextPageToken: "next",
+			}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		Context("When the subscriptions of an account are retrieved", func() {
+			It("queries the page of the token with the default limit", func() {
+				mockSubscriptionFetcher.EXPECT().GetSubscriptionsByAccount(gomock.Any(), "pr12345678", int64(DefaultPageLimit), "token").Return(page, nil)
+
+				queryParams := map[string]string{
+					configs.AccountIDQueryParam: "pr12345678",
+					configs.PageTokenQueryParam: "token",
+				}
+				status, result, err := api.GetSubscriptionsByAccount(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result).To(Equal(page))
+			})
+
+			It("returns bad request without the account", func() {
+				status, result, err := api.GetSubscriptionsByAccount(context.Background(), map[string]string{}, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringMissingAccountID))
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+			})
+
+			It("returns bad request when the page token is invalid", func() {
+				mockSubscriptionFetcher.EXPECT().GetSubscriptionsByAccount(gomock.Any(), gomock.Any(), gomock.Any(), "???").Return(nil, db.InvalidPageTokenErr)
+
+				queryParams := map[string]string{
+					configs.AccountIDQueryParam: "pr12345678",
+					configs.PageTokenQueryParam: "???",
+				}
+				status, _, err := api.GetSubscriptionsByAccount(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(db.InvalidPageTokenErr))
+				Expect(status).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("When the subscriptions to a service are retrieved", func() {
+			It("queries the first page with the limit", func() {
+				mockSubscriptionFetcher.EXPECT().GetSubscriptionsByService(gomock.Any(), db.Service(db.ServiceLatexGO), int64(10), "").Return(page, nil)
+
+				queryParams := map[string]string{
+					configs.ServiceQueryParam: "LATEX2GO",
+					configs.LimitQueryParam:   "10",
+				}
+				status, result, err := api.GetSubscriptionsByService(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result).To(Equal(page))
+			})
+
+			invalidParams := []struct {
+				description string
+				queryParams map[string]string
+				err         error
+			}{
+				{"the service is missing", map[string]string{}, ErrorQueryStringMissingService},
+				{"the service is not supported", map[string]string{configs.ServiceQueryParam: "latex2go"}, db.UnsupportedServiceErr},
+				{"the limit is too big", map[string]string{configs.ServiceQueryParam: "seals", configs.LimitQueryParam: "5000"}, ErrorQueryStringUnsupportedLimit},
+			}
+			for _, f := range invalidParams {
+				f := f
+				It("returns bad request without querying when "+f.description, func() {
+					status, result, err := api.GetSubscriptionsByService(context.Background(), f.queryParams, mockSubscriptionFetcher)
+
+					Expect(err).To(Equal(f.err))
+					Expect(status).To(Equal(http.StatusBadRequest))
+					Expect(result).To(BeNil())
+				})
+			}
+		})
+	})
+
+	Describe("GetPrinterSubscriptionHistory", func() {
+		var mockCtrl *gomock.Controller
+		var mockSubscriptionFetcher *dbMocks.MockPrinterSubscriptionFetcher
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockSubscriptionFetcher = dbMocks.NewMockPrinterSubscriptionFetcher(mockCtrl)
+			configs.Init()
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		Context("When the time range is longer than the ones of the events", func() {
+			It("queries the changes of the normalized printer in the whole time range", func() {
+				startTime := time.Date(2020, 9, 14, 0, 0, 0, 0, time.UTC)
+				endTime := time.Date(2020, 9, 18, 0, 0, 0, 0, time.UTC)
+				changes := []*db.CCPrinterSubscriptionChangeModel{
+					{PrinterID: "CZ056A!SG4491P001", AccountID: "pr12345678", Action: db.SubscriptionDeleted, Actor: "admin"},
+				}
+				mockSubscriptionFetcher.EXPECT().GetPrinterSubscriptionHistory(gomock.Any(), "CZ056A!SG4491P001", startTime, endTime).Return(changes, nil)
+
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "cz056a",
+					configs.SerialNumberQueryParam:  "sg4491p001",
+					configs.TimeTypeQueryParam:      "absolute",
+					configs.StartTimeQueryParam:     "2020-09-14T00:00:00Z",
+					configs.EndTimeQueryParam:       "2020-09-18T00:00:00Z",
+				}
+				status, result, err := api.GetPrinterSubscriptionHistory(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result).To(Equal(changes))
+			})
+		})
+
+		Context("When the serial number is missing", func() {
+			It("returns bad request without querying", func() {
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "CZ056A",
+					configs.TimeTypeQueryParam:      "relative",
+					configs.OffsetUnitsQueryParam:   "days",
+					configs.OffsetValueQueryParam:   "1",
+				}
+				status, result, err := api.GetPrinterSubscriptionHistory(context.Background(), queryParams, mockSubscriptionFetcher)
+
+				Expect(err).To(Equal(ErrorQueryStringMissingSerialNumber))
 				Expect(status).To(Equal(http.StatusBadRequest))
 				Expect(result).To(BeNil())
+			})
+		})
+
+		Context("When the time range is missing", func() {
+			It("returns bad request without querying", func() {
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: "CZ056A",
+					configs.SerialNumberQueryParam:  "SG4491P001",
+				}
+				status, _, err := api.GetPrinterSubscriptionHistory(context.Background(), queryParams, mockSubscriptionFetcher)
+
 				Expect(err).To(Equal(ErrorQueryStringMissingTimeRangeType))
+				Expect(status).To(Equal(http.StatusBadRequest))
 			})
 		})
 	})
@@ -145,6 +886,83 @@ var _ = Describe("Api", func() {
 			})
 		})
 
+		Context("When the input is query failed error", func() {
+			It("returns the appropiate status", func() {
+				status := api.SelectHTTPStatus(cloudwatch.ErrorQueryFailed)
+				Expect(status).To(Equal(http.StatusBadGateway))
+			})
+		})
+
+		Context("When the input is query cancelled error", func() {
+			It("returns the appropiate status", func() {
+				status := api.SelectHTTPStatus(cloudwatch.ErrorQueryCancelled)
+				Expect(status).To(Equal(http.StatusBadGateway))
+			})
+		})
+
+		Context("When the input is query timeout error", func() {
+			It("returns the appropiate status", func() {
+				status := api.SelectHTTPStatus(cloudwatch.ErrorQueryTimeout)
+				Expect(status).To(Equal(http.StatusGatewayTimeout))
+			})
+		})
+
+		Context("When the input is QueryStringUnsupportedCursor error", func() {
+			It("returns the appropiate status", func() {
+				status := api.SelectHTTPStatus(ErrorQueryStringUnsupportedCursor)
+				Expect(status).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("When the input is QueryStringMalformedProductNumber or QueryStringMalformedSerialNumber error", func() {
+			It("returns the appropiate status", func() {
+				Expect(api.SelectHTTPStatus(ErrorQueryStringMalformedProductNumber)).To(Equal(http.StatusBadRequest))
+				Expect(api.SelectHTTPStatus(ErrorQueryStringMalformedSerialNumber)).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("When the input is QueryStringUnsupportedDuration or QueryStringDurationConflict error", func() {
+			It("returns the appropiate status", func() {
+				Expect(api.SelectHTTPStatus(ErrorQueryStringUnsupportedDuration)).To(Equal(http.StatusBadRequest))
+				Expect(api.SelectHTTPStatus(ErrorQueryStringDurationConflict)).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("When the input is a missing printer or unsupported interval error", func() {
+			It("returns the appropiate status", func() {
+				Expect(api.SelectHTTPStatus(ErrorQueryStringMissingProductNumber)).To(Equal(http.StatusBadRequest))
+				Expect(api.SelectHTTPStatus(ErrorQueryStringMissingSerialNumber)).To(Equal(http.StatusBadRequest))
+				Expect(api.SelectHTTPStatus(ErrorQueryStringUnsupportedInterval)).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("When the input is an error of the anchor time or the around offsets", func() {
+			It("returns the appropiate status", func() {
+				Expect(api.SelectHTTPStatus(ErrorQueryStringMissingAnchorTime)).To(Equal(http.StatusBadRequest))
+				Expect(api.SelectHTTPStatus(ErrorQueryStringUnsupportedAnchorTime)).To(Equal(http.StatusBadRequest))
+				Expect(api.SelectHTTPStatus(ErrorQueryStringMissingAroundOffsets)).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("When the input is an error of the storage", func() {
+			It("returns the appropiate status", func() {
+				Expect(api.SelectHTTPStatus(storage.ErrorObjectNotFound)).To(Equal(http.StatusNotFound))
+				Expect(api.SelectHTTPStatus(storage.ErrorRangeNotSatisfiable)).To(Equal(http.StatusRequestedRangeNotSatisfiable))
+				Expect(api.SelectHTTPStatus(storage.ErrorAccessDenied)).To(Equal(http.StatusForbidden))
+				Expect(api.SelectHTTPStatus(storage.ErrorObjectTooBig)).To(Equal(http.StatusUnprocessableEntity))
+				Expect(api.SelectHTTPStatus(storage.ErrorMalformedContent)).To(Equal(http.StatusUnprocessableEntity))
+				Expect(api.SelectHTTPStatus(storage.ErrorContentNotConvertible)).To(Equal(http.StatusUnprocessableEntity))
+			})
+		})
+
+		Context("When the input is an error of the subscriptions", func() {
+			It("returns the appropiate status", func() {
+				Expect(api.SelectHTTPStatus(db.ConditionalPutErr)).To(Equal(http.StatusConflict))
+				Expect(api.SelectHTTPStatus(db.ConditionalDelErr)).To(Equal(http.StatusNotFound))
+				Expect(api.SelectHTTPStatus(db.UnsupportedServiceErr)).To(Equal(http.StatusBadRequest))
+			})
+		})
+
 		Context("When the input is nil error", func() {
 			It("returns the appropiate status", func() {
 				status := api.SelectHTTPStatus(nil)
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+// Interval is a period of time between Start and End.
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// HeartbeatGap is a period of time between two heartbeats (or between a heartbeat and the limits of the time range)
+// where MissedHeartbeats heartbeats were expected but did not arrive.
+type HeartbeatGap struct {
+	Interval
+	MissedHeartbeats int `json:"missed_heartbeats"`
+}
+
+// HeartbeatAnalysis is the activity of a printer deduced from its heartbeats in a time range.
+// When Truncated, EndTime is the position of NextCursor, which continues the analysis with the same time range.
+type HeartbeatAnalysis struct {
+	ProductNumber    string         `json:"product_number"`
+	SerialNumber     string         `json:"serial_number"`
+	StartTime        time.Time      `json:"start_time"`
+	EndTime          time.Time      `json:"end_time"`
+	IntervalSeconds  int64          `json:"interval_seconds"`
+	Heartbeats       int            `json:"heartbeats"`
+	LastHeartbeat    *time.Time     `json:"last_heartbeat,omitempty"`
+	Online           []Interval     `json:"online"`
+	Offline          []Interval     `json:"offline"`
+	Gaps             []HeartbeatGap `json:"gaps"`
+	UptimePercentage float64        `json:"uptime_percentage"`
+	Truncated        bool           `json:"truncated,omitempty"`
+	NextCursor       string         `json:"next_cursor,omitempty"`
+}
+
+// GetHeartbeatAnalysis obtains the heartbeats of the printer of queryParameters in its time range and analyses them
+// with the expected interval between heartbeats (the interval query parameter, or configs.GetHeartbeatInterval).
+func GetHeartbeatAnalysis(ctx context.Context, queryParameters map[string]string, fetcher datafetcher.DataFetcher) (status int, result *HeartbeatAnalysis, err error) {
+	queryParameters, startTime, endTime, err := resolveTimeRange(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	productNumber, serialNumber, err := ExtractPrinterInfo(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	if productNumber == "" {
+		return SelectHTTPStatus(ErrorQueryStringMissingProductNumber), nil, ErrorQueryStringMissingProductNumber
+	}
+	if serialNumber == "" {
+		return SelectHTTPStatus(ErrorQueryStringMissingSerialNumber), nil, ErrorQueryStringMissingSerialNumber
+	}
+
+	interval, err := ExtractInterval(queryParameters, configs.GetHeartbeatInterval())
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	events, nextCursor, err := fetchAllEvents(ctx, queryParameters, fetcher)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	if nextCursor != "" {
+		cursor, err := DecodeCursor(nextCursor)
+		if err != nil {
+			return SelectHTTPStatus(err), nil, err
+		}
+		endTime = cursor.Position
+		events = eventsBefore(events, endTime)
+	}
+	heartbeats := make([]time.Time, 0, len(events))
+	for _, event := range events {
+		heartbeats = append(heartbeats, event.Timestamp)
+	}
+
+	result = AnalyzeHeartbeats(heartbeats, startTime, endTime, interval)
+	result.ProductNumber = productNumber
+	result.SerialNumber = serialNumber
+	result.Truncated = nextCursor != ""
+	result.NextCursor = nextCursor
+	return http.StatusOK, result, nil
+}
+
+// AnalyzeHeartbeats returns the HeartbeatAnalysis of the heartbeats of a printer between startTime and endTime,
+// which are expected every interval.
+func AnalyzeHeartbeats(heartbeats []time.Time, startTime, endTime time.Time, interval time.Duration) *HeartbeatAnalysis {
+	sorted := make([]time.Time, 0, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		if !heartbeat.Before(startTime) && !heartbeat.After(endTime) {
+			sorted = append(sorted, heartbeat)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	analysis := &HeartbeatAnalysis{
+		StartTime:       startTime,
+		EndTime:         endTime,
+		IntervalSeconds: int64(interval / time.Second),
+		Heartbeats:      len(sorted),
+		Online:          []Interval{},
+		Offline:         []Interval{},
+		Gaps:            []HeartbeatGap{},
+	}
+	if len(sorted) > 0 {
+		last := sorted[len(sorted)-1]
+		analysis.LastHeartbeat = &last
+	}
+
+	// tolerance is the maximum time between two heartbeats that is not considered a gap.
+	tolerance := interval + interval/2
+
+	// The limits of the time range are used as heartbeats before the first heartbeat and after the last one.
+	previous := startTime
+	for i := 0; i <= len(sorted); i++ {
+		next := endTime
+		if i < len(sorted) {
+			next = sorted[i]
+		}
+		first, last := i == 0, i == len(sorted)
+
+		delta := next.Sub(previous)
+		if delta > tolerance || (first && last && delta > 0) {
+			expected := int(math.Round(float64(delta) / float64(interval)))
+			if !last {
+				expected-- // next is a heartbeat that did arrive
+			}
+			if expected < 1 {
+				expected = 1
+			}
+			analysis.Gaps = append(analysis.Gaps, HeartbeatGap{Interval{previous, next}, expected})
+
+			offlineFrom := startTime
+			if !first {
+				offlineFrom = previous.Add(interval)
+			}
+			analysis.Offline = append(analysis.Offline, Interval{offlineFrom, next})
+		}
+		previous = next
+	}
+
+	var offline time.Duration
+	onlineFrom := startTime
+	for _, period := range analysis.Offline {
+		if period.Start.After(onlineFrom) {
+			analysis.Online = append(analysis.Online, Interval{onlineFrom, period.Start})
+		}
+		offline += period.End.Sub(period.Start)
+		onlineFrom = period.End
+	}
+	if endTime.After(onlineFrom) {
+		analysis.Online = append(analysis.Online, Interval{onlineFrom, endTime})
+	}
+
+	if total := endTime.Sub(startTime); total > 0 {
+		analysis.UptimePercentage = math.Round(10000*float64(total-offline)/float64(total)) / 100
+	}
+	return analysis
+}
@@ -0,0 +1,204 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/api"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher/mocks"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2020, 9, 16, hour, minute, 0, 0, time.UTC)
+}
+
+// every returns the times from first to last (both included) every step minutes.
+func every(first, last time.Time, step int) []time.Time {
+	var times []time.Time
+	for t := first; !t.After(last); t = t.Add(time.Duration(step) * time.Minute) {
+		times = append(times, t)
+	}
+	return times
+}
+
+var _ = Describe("Heartbeat analysis", func() {
+	Describe("AnalyzeHeartbeats", func() {
+		Context("When some heartbeats are missing", func() {
+			It("returns the gap and the offline interval", func() {
+				heartbeats := append(every(at(12, 2), at(12, 22), 5), every(at(12, 42), at(12, 57), 5)...)
+
+				analysis := api.AnalyzeHeartbeats(heartbeats, at(12, 0), at(13, 0), 5*time.Minute)
+
+				Expect(analysis.Heartbeats).To(Equal(9))
+				Expect(*analysis.LastHeartbeat).To(Equal(at(12, 57)))
+				Expect(analysis.Gaps).To(Equal([]api.HeartbeatGap{{Interval: api.Interval{Start: at(12, 22), End: at(12, 42)}, MissedHeartbeats: 3}}))
+				Expect(analysis.Offline).To(Equal([]api.Interval{{Start: at(12, 27), End: at(12, 42)}}))
+				Expect(analysis.Online).To(Equal([]api.Interval{{Start: at(12, 0), End: at(12, 27)}, {Start: at(12, 42), End: at(13, 0)}}))
+				Expect(analysis.UptimePercentage).To(Equal(75.0))
+			})
+		})
+
+		Context("When the heartbeats are late but within the tolerance", func() {
+			It("returns the printer online the whole time range", func() {
+				heartbeats := []time.Time{at(12, 4), at(12, 11), at(12, 18), at(12, 25)}
+
+				analysis := api.AnalyzeHeartbeats(heartbeats, at(12, 0), at(12, 30), 5*time.Minute)
+
+				Expect(analysis.Gaps).To(BeEmpty())
+				Expect(analysis.Offline).To(BeEmpty())
+				Expect(analysis.Online).To(Equal([]api.Interval{{Start: at(12, 0), End: at(12, 30)}}))
+				Expect(analysis.UptimePercentage).To(Equal(100.0))
+			})
+		})
+
+		Context("When the printer stops sending heartbeats", func() {
+			It("returns it offline until the end of the time range", func() {
+				heartbeats := every(at(12, 0), at(12, 30), 5)
+
+				analysis := api.AnalyzeHeartbeats(heartbeats, at(12, 0), at(13, 0), 5*time.Minute)
+
+				Expect(analysis.Gaps).To(Equal([]api.HeartbeatGap{{Interval: api.Interval{Start: at(12, 30), End: at(13, 0)}, MissedHeartbeats: 6}}))
+				Expect(analysis.Offline).To(Equal([]api.Interval{{Start: at(12, 35), End: at(13, 0)}}))
+				Expect(analysis.UptimePercentage).To(Equal(58.33))
+			})
+		})
+
+		Context("When there are no heartbeats", func() {
+			It("returns the printer offline the whole time range", func() {
+				analysis := api.AnalyzeHeartbeats(nil, at(12, 0), at(13, 0), 5*time.Minute)
+
+				Expect(analysis.Heartbeats).To(Equal(0))
+				Expect(analysis.LastHeartbeat).To(BeNil())
+				Expect(analysis.Gaps).To(Equal([]api.HeartbeatGap{{Interval: api.Interval{Start: at(12, 0), End: at(13, 0)}, MissedHeartbeats: 12}}))
+				Expect(analysis.Offline).To(Equal([]api.Interval{{Start: at(12, 0), End: at(13, 0)}}))
+				Expect(analysis.Online).To(BeEmpty())
+				Expect(analysis.UptimePercentage).To(Equal(0.0))
+			})
+		})
+	})
+
+	Describe("GetHeartbeatAnalysis", func() {
+		var mockCtrl *gomock.Controller
+		var mockHeartbeatFetcher *mocks.MockDataFetcher
+		var queryParams map[string]string
+
+		BeforeEach(func() {
+			configs.Init()
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockHeartbeatFetcher = mocks.NewMockDataFetcher(mockCtrl)
+			queryParams = map[string]string{
+				configs.TimeTypeQueryParam:      "absolute",
+				configs.StartTimeQueryParam:     "2020-09-16T12:00:00Z",
+				configs.EndTimeQueryParam:       "2020-09-16T13:00:00Z",
+				configs.ProductNumberQueryParam: "Y0U23A",
+				configs.SerialNumberQueryParam:  "MY97F1T00H",
+				configs.IntervalQueryParam:      "10m",
+			}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		Context("When the heartbeats have more than one page", func() {
+			It("fetches all the pages and analyses the heartbeats", func() {
+				var firstPage, secondPage []datafetcher.TimelineEvent
+				for _, t := range every(at(12, 5), at(12, 15), 10) {
+					firstPage = append(firstPage, datafetcher.TimelineEvent{Timestamp: t})
+				}
+				for _, t := range every(at(12, 45), at(12, 55), 10) {
+					secondPage = append(secondPage, datafetcher.TimelineEvent{Timestamp: t})
+				}
+
+				gomock.InOrder(
+					mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).
+						Return(&datafetcher.EventsPage{Events: firstPage, NextCursor: "cursor"}, nil),
+					mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).
+						DoAndReturn(func(ctx context.Context, params map[string]string) (*datafetcher.EventsPage, error) {
+							Expect(params[configs.CursorQueryParam]).To(Equal("cursor"))
+							return &datafetcher.EventsPage{Events: secondPage}, nil
+						}),
+				)
+
+				status, result, err := api.GetHeartbeatAnalysis(context.Background(), queryParams, mockHeartbeatFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.ProductNumber).To(Equal("Y0U23A"))
+				Expect(result.SerialNumber).To(Equal("MY97F1T00H"))
+				Expect(result.IntervalSeconds).To(Equal(int64(600)))
+				Expect(result.Heartbeats).To(Equal(4))
+				Expect(result.Offline).To(Equal([]api.Interval{{Start: at(12, 25), End: at(12, 45)}}))
+				Expect(result.UptimePercentage).To(Equal(66.67))
+			})
+		})
+
+		Context("When the scan budget is exhausted before the last page", func() {
+			It("stops fetching and analyses the time range before the cursor of the next page", func() {
+				nextCursor := EncodeCursor(at(12, 30), at(12, 0), at(13, 0))
+				var events []datafetcher.TimelineEvent
+				for _, t := range every(at(12, 0), at(12, 30), 5) {
+					events = append(events, datafetcher.TimelineEvent{Timestamp: t})
+				}
+
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, params map[string]string) (*datafetcher.EventsPage, error) {
+						datafetcher.ScanBudgetFromContext(ctx).Add(float64(configs.GetScanBudgetBytes()))
+						return &datafetcher.EventsPage{Events: events, NextCursor: nextCursor}, nil
+					})
+
+				status, result, err := api.GetHeartbeatAnalysis(context.Background(), queryParams, mockHeartbeatFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.Truncated).To(BeTrue())
+				Expect(result.NextCursor).To(Equal(nextCursor))
+				Expect(result.EndTime).To(Equal(at(12, 30)))
+				Expect(result.Heartbeats).To(Equal(6))
+				Expect(result.Offline).To(BeEmpty())
+			})
+		})
+
+		Context("When the serial number is missing", func() {
+			It("returns bad request status and missing serial number error", func() {
+				delete(queryParams, configs.SerialNumberQueryParam)
+
+				status, result, err := api.GetHeartbeatAnalysis(context.Background(), queryParams, mockHeartbeatFetcher)
+
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(result).To(BeNil())
+				Expect(err).To(Equal(ErrorQueryStringMissingSerialNumber))
+			})
+		})
+
+		Context("When the interval is not valid", func() {
+			It("returns bad request status and unsupported interval error", func() {
+				queryParams[configs.IntervalQueryParam] = "1.5s"
+
+				status, _, err := api.GetHeartbeatAnalysis(context.Background(), queryParams, mockHeartbeatFetcher)
+
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedInterval))
+			})
+		})
+
+		Context("When the heartbeats can't be fetched", func() {
+			It("returns the status of the error", func() {
+				mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, context.DeadlineExceeded)
+
+				status, _, err := api.GetHeartbeatAnalysis(context.Background(), queryParams, mockHeartbeatFetcher)
+
+				Expect(status).To(Equal(http.StatusGatewayTimeout))
+				Expect(err).To(Equal(context.DeadlineExceeded))
+			})
+		})
+	})
+})
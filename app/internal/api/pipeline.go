@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+// Parse status of the uploads of a PipelineReport.
+const (
+	// ParsedStatus is the status of an OpenXML with at least one CloudJson generated from it.
+	ParsedStatus = "parsed"
+	// MissingCloudJsonStatus is the status of an OpenXML without any CloudJson generated from it in the time range.
+	MissingCloudJsonStatus = "missing_cloud_json"
+	// OrphanCloudJsonStatus is the status of a CloudJson whose OpenXML is not in the time range.
+	OrphanCloudJsonStatus = "orphan_cloud_json"
+)
+
+// latencyPercentiles are the percentiles of the latencies summarized in a PipelineReport.
+var latencyPercentiles = []int{50, 90, 95, 99}
+
+// PipelineUpload is an OpenXML and the CloudJsons generated from it. Orphan CloudJsons have no OpenXML.
+type PipelineUpload struct {
+	Key           string                      `json:"key"`
+	Status        string                      `json:"status"`
+	ProductNumber string                      `json:"product_number,omitempty"`
+	SerialNumber  string                      `json:"serial_number,omitempty"`
+	OpenXML       *datafetcher.TimelineEvent  `json:"open_xml,omitempty"`
+	CloudJsons    []datafetcher.TimelineEvent `json:"cloud_jsons,omitempty"`
+	LatencyMillis *int64                      `json:"latency_ms,omitempty"`
+}
+
+// LatencySummary summarizes the latencies of the parsed uploads. Percentiles contains the percentiles 50, 90, 95
+// and 99 (keyed as p50, p90...), computed with the nearest-rank method.
+type LatencySummary struct {
+	Count       int              `json:"count"`
+	MinMillis   int64            `json:"min_ms"`
+	MaxMillis   int64            `json:"max_ms"`
+	MeanMillis  int64            `json:"mean_ms"`
+	Percentiles map[string]int64 `json:"percentiles_ms"`
+}
+
+// PipelineReport is the correlation of the OpenXMLs and the CloudJsons of a time range, in chronological order.
+// When Truncated, EndTime is the position of NextCursor, which continues the report with the same time range.
+type PipelineReport struct {
+	StartTime    time.Time        `json:"start_time"`
+	EndTime      time.Time        `json:"end_time"`
+	Uploads      []PipelineUpload `json:"uploads"`
+	StatusCounts map[string]int   `json:"status_counts"`
+	Latency      *LatencySummary  `json:"latency,omitempty"`
+	Truncated    bool             `json:"truncated,omitempty"`
+	NextCursor   string           `json:"next_cursor,omitempty"`
+}
+
+// GetPipelineReport obtains in parallel the OpenXMLs and CloudJsons of queryParameters and correlates them.
+// It fails if any of the fetchers fails, because the correlation would be misleading.
+func GetPipelineReport(ctx context.Context, queryParameters map[string]string, openXMLFetcher, cloudJsonFetcher datafetcher.DataFetcher) (status int, result *PipelineReport, err error) {
+	queryParameters, startTime, endTime, err := resolveTimeRange(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	if _, _, err = ExtractPrinterInfo(queryParameters); err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	ctx, _ = datafetcher.WithScanBudget(ctx, configs.GetScanBudgetBytes())
+
+	var openXMLs, cloudJsons []datafetcher.TimelineEvent
+	var openXMLCursor, cloudJsonCursor string
+	var openXMLErr, cloudJsonErr error
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		openXMLs, openXMLCursor, openXMLErr = fetchAllEvents(ctx, queryParameters, openXMLFetcher)
+	}()
+	go func() {
+		defer wg.Done()
+		cloudJsons, cloudJsonCursor, cloudJsonErr = fetchAllEvents(ctx, queryParameters, cloudJsonFetcher)
+	}()
+	wg.Wait()
+
+	for _, err := range []error{openXMLErr, cloudJsonErr} {
+		if err != nil {
+			return SelectHTTPStatus(err), nil, err
+		}
+	}
+
+	var nextCursor string
+	for _, cursor := range []string{openXMLCursor, cloudJsonCursor} {
+		if cursor == "" {
+			continue
+		}
+		decoded, err := DecodeCursor(cursor)
+		if err != nil {
+			return SelectHTTPStatus(err), nil, err
+		}
+		if nextCursor == "" || decoded.Position.Before(endTime) {
+			nextCursor, endTime = cursor, decoded.Position
+		}
+	}
+	if nextCursor != "" {
+		openXMLs = eventsBefore(openXMLs, endTime)
+		cloudJsons = eventsBefore(cloudJsons, endTime)
+	}
+
+	result = CorrelateUploads(openXMLs, cloudJsons)
+	result.StartTime = startTime
+	result.EndTime = endTime
+	result.Truncated = nextCursor != ""
+	result.NextCursor = nextCursor
+	return http.StatusOK, result, nil
+}
+
+// CorrelateUploads joins each OpenXML with the CloudJsons whose xml generator object path is the key of the OpenXML,
+// and summarizes the latencies between the upload of the OpenXMLs and their first CloudJson.
+func CorrelateUploads(openXMLs, cloudJsons []datafetcher.TimelineEvent) *PipelineReport {
+	byPath := make(map[string][]datafetcher.TimelineEvent)
+	for _, cloudJson := range cloudJsons {
+		path := normalizeObjectPath(cloudJson.XMLGeneratorObjectPath)
+		byPath[path] = append(byPath[path], cloudJson)
+	}
+	for _, generated := range byPath {
+		sort.SliceStable(generated, func(i, j int) bool { return generated[i].Timestamp.Before(generated[j].Timestamp) })
+	}
+
+	report := &PipelineReport{
+		Uploads:      []PipelineUpload{},
+		StatusCounts: map[string]int{ParsedStatus: 0, MissingCloudJsonStatus: 0, OrphanCloudJsonStatus: 0},
+	}
+
+	var latencies []int64
+	matched := make(map[string]bool)
+	for i := range openXMLs {
+		openXML := openXMLs[i]
+		path := normalizeObjectPath(openXML.Key)
+		upload := PipelineUpload{
+			Key:           openXML.Key,
+			Status:        MissingCloudJsonStatus,
+			ProductNumber: openXML.ProductNumber,
+			SerialNumber:  openXML.SerialNumber,
+			OpenXML:       &openXML,
+		}
+
+		if generated, ok := byPath[path]; ok && path != "" {
+			matched[path] = true
+			latency := generated[0].Timestamp.Sub(openXML.Timestamp).Milliseconds()
+			upload.Status = ParsedStatus
+			upload.CloudJsons = generated
+			upload.LatencyMillis = &latency
+			latencies = append(latencies, latency)
+		}
+		report.Uploads = append(report.Uploads, upload)
+	}
+
+	orphanPaths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		if !matched[path] {
+			orphanPaths = append(orphanPaths, path)
+		}
+	}
+	sort.Strings(orphanPaths)
+	for _, path := range orphanPaths {
+		generated := byPath[path]
+		report.Uploads = append(report.Uploads, PipelineUpload{
+			Key:           generated[0].XMLGeneratorObjectPath,
+			Status:        OrphanCloudJsonStatus,
+			ProductNumber: generated[0].ProductNumber,
+			SerialNumber:  generated[0].SerialNumber,
+			CloudJsons:    generated,
+		})
+	}
+
+	sort.SliceStable(report.Uploads, func(i, j int) bool {
+		return uploadTime(report.Uploads[i]).Before(uploadTime(report.Uploads[j]))
+	})
+	for _, upload := range report.Uploads {
+		report.StatusCounts[upload.Status]++
+	}
+
+	report.Latency = summarizeLatencies(latencies)
+	return report
+}
+
+// normalizeObjectPath returns the path of an S3 object without the leading slash, so keys and paths written
+// with and without it are joined.
+func normalizeObjectPath(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// uploadTime returns the time of the OpenXML of upload, or the time of its first CloudJson if it is an orphan.
+func uploadTime(upload PipelineUpload) time.Time {
+	if upload.OpenXML != nil {
+		return upload.OpenXML.Timestamp
+	}
+	return upload.CloudJsons[0].Timestamp
+}
+
+// summarizeLatencies returns the LatencySummary of latencies, or nil if there are none.
+func summarizeLatencies(latencies []int64) *LatencySummary {
+	if len(latencies) == 0 {
+		return nil
+	}
+
+	sorted := append([]int64(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total int64
+	for _, latency := range sorted {
+		total += latency
+	}
+
+	summary := &LatencySummary{
+		Count:       len(sorted),
+		MinMillis:   sorted[0],
+		MaxMillis:   sorted[len(sorted)-1],
+		MeanMillis:  int64(math.Round(float64(total) / float64(len(sorted)))),
+		Percentiles: make(map[string]int64, len(latencyPercentiles)),
+	}
+	for _, percentile := range latencyPercentiles {
+		rank := int(math.Ceil(float64(percentile) / 100 * float64(len(sorted))))
+		summary.Percentiles["p"+strconv.Itoa(percentile)] = sorted[rank-1]
+	}
+	return summary
+}
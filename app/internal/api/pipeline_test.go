@@ -0,0 +1,186 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/api"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher/mocks"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+func openXML(key string, timestamp time.Time) datafetcher.TimelineEvent {
+	return datafetcher.TimelineEvent{Timestamp: timestamp, Key: key, ProductNumber: "Y0U23A", SerialNumber: "MY97F1T00H"}
+}
+
+func cloudJson(path string, timestamp time.Time) datafetcher.TimelineEvent {
+	return datafetcher.TimelineEvent{Timestamp: timestamp, XMLGeneratorObjectPath: path, ProductNumber: "Y0U23A", SerialNumber: "MY97F1T00H"}
+}
+
+var _ = Describe("Pipeline report", func() {
+	Describe("CorrelateUploads", func() {
+		Context("When there are parsed, missing and orphan uploads", func() {
+			It("returns each upload with its status in chronological order", func() {
+				openXMLs := []datafetcher.TimelineEvent{
+					openXML("uploads/raw/second", at(12, 10)),
+					openXML("uploads/raw/first", at(12, 0)),
+				}
+				cloudJsons := []datafetcher.TimelineEvent{
+					cloudJson("/uploads/raw/first", at(12, 2)),
+					cloudJson("uploads/raw/first", at(12, 1)),
+					cloudJson("uploads/raw/orphan", at(12, 5)),
+				}
+
+				report := api.CorrelateUploads(openXMLs, cloudJsons)
+
+				Expect(report.Uploads).To(HaveLen(3))
+				Expect(report.Uploads[0].Key).To(Equal("uploads/raw/first"))
+				Expect(report.Uploads[0].Status).To(Equal(api.ParsedStatus))
+				Expect(report.Uploads[0].CloudJsons).To(HaveLen(2))
+				Expect(*report.Uploads[0].LatencyMillis).To(Equal(int64(60000)))
+				Expect(report.Uploads[1].Key).To(Equal("uploads/raw/orphan"))
+				Expect(report.Uploads[1].Status).To(Equal(api.OrphanCloudJsonStatus))
+				Expect(report.Uploads[1].OpenXML).To(BeNil())
+				Expect(report.Uploads[2].Key).To(Equal("uploads/raw/second"))
+				Expect(report.Uploads[2].Status).To(Equal(api.MissingCloudJsonStatus))
+				Expect(report.Uploads[2].LatencyMillis).To(BeNil())
+				Expect(report.StatusCounts).To(Equal(map[string]int{
+					api.ParsedStatus:           1,
+					api.MissingCloudJsonStatus: 1,
+					api.OrphanCloudJsonStatus:  1,
+				}))
+			})
+		})
+
+		Context("When several uploads are parsed", func() {
+			It("summarizes the latencies with nearest-rank percentiles", func() {
+				var openXMLs, cloudJsons []datafetcher.TimelineEvent
+				for i := 1; i <= 10; i++ {
+					key := "uploads/raw/" + string(rune('a'+i))
+					openXMLs = append(openXMLs, openXML(key, at(12, i)))
+					cloudJsons = append(cloudJsons, cloudJson(key, at(12, i).Add(time.Duration(i)*time.Second)))
+				}
+
+				report := api.CorrelateUploads(openXMLs, cloudJsons)
+
+				Expect(report.Latency).To(Equal(&api.LatencySummary{
+					Count:       10,
+					MinMillis:   1000,
+					MaxMillis:   10000,
+					MeanMillis:  5500,
+					Percentiles: map[string]int64{"p50": 5000, "p90": 9000, "p95": 10000, "p99": 10000},
+				}))
+			})
+		})
+
+		Context("When no upload is parsed", func() {
+			It("returns no latency summary", func() {
+				report := api.CorrelateUploads([]datafetcher.TimelineEvent{openXML("uploads/raw/first", at(12, 0))}, nil)
+
+				Expect(report.Latency).To(BeNil())
+				Expect(report.StatusCounts[api.MissingCloudJsonStatus]).To(Equal(1))
+			})
+		})
+	})
+
+	Describe("GetPipelineReport", func() {
+		var mockCtrl *gomock.Controller
+		var mockOpenXMLFetcher, mockCloudJsonFetcher *mocks.MockDataFetcher
+		var queryParams map[string]string
+
+		BeforeEach(func() {
+			configs.Init()
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockOpenXMLFetcher = mocks.NewMockDataFetcher(mockCtrl)
+			mockCloudJsonFetcher = mocks.NewMockDataFetcher(mockCtrl)
+			queryParams = map[string]string{
+				configs.TimeTypeQueryParam:      "absolute",
+				configs.StartTimeQueryParam:     "2020-09-16T12:00:00Z",
+				configs.EndTimeQueryParam:       "2020-09-16T13:00:00Z",
+				configs.ProductNumberQueryParam: "Y0U23A",
+			}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		Context("When both fetchers succeed", func() {
+			It("returns the report of the time range", func() {
+				mockOpenXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).
+					Return(&datafetcher.EventsPage{Events: []datafetcher.TimelineEvent{openXML("uploads/raw/first", at(12, 0))}}, nil)
+				mockCloudJsonFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).
+					Return(&datafetcher.EventsPage{Events: []datafetcher.TimelineEvent{cloudJson("uploads/raw/first", at(12, 1))}}, nil)
+
+				status, result, err := api.GetPipelineReport(context.Background(), queryParams, mockOpenXMLFetcher, mockCloudJsonFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.StartTime).To(Equal(at(12, 0)))
+				Expect(result.EndTime).To(Equal(at(13, 0)))
+				Expect(result.StatusCounts[api.ParsedStatus]).To(Equal(1))
+			})
+		})
+
+		Context("When the scan budget is exhausted before the last page", func() {
+			It("correlates the time range before the earliest cursor and shares the budget between both fetchers", func() {
+				nextCursor := EncodeCursor(at(12, 30), at(12, 0), at(13, 0))
+				mockOpenXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, params map[string]string) (*datafetcher.EventsPage, error) {
+						datafetcher.ScanBudgetFromContext(ctx).Add(float64(configs.GetScanBudgetBytes()))
+						return &datafetcher.EventsPage{
+							Events:     []datafetcher.TimelineEvent{openXML("uploads/raw/first", at(12, 0))},
+							NextCursor: nextCursor,
+						}, nil
+					})
+				mockCloudJsonFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).
+					Return(&datafetcher.EventsPage{Events: []datafetcher.TimelineEvent{
+						cloudJson("uploads/raw/first", at(12, 1)),
+						cloudJson("uploads/raw/second", at(12, 40)),
+					}}, nil)
+
+				status, result, err := api.GetPipelineReport(context.Background(), queryParams, mockOpenXMLFetcher, mockCloudJsonFetcher)
+
+				Expect(err).To(BeNil())
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(result.Truncated).To(BeTrue())
+				Expect(result.NextCursor).To(Equal(nextCursor))
+				Expect(result.EndTime).To(Equal(at(12, 30)))
+				Expect(result.Uploads).To(HaveLen(1))
+				Expect(result.StatusCounts[api.OrphanCloudJsonStatus]).To(Equal(0))
+			})
+		})
+
+		Context("When one of the fetchers fails", func() {
+			It("returns the status of the error", func() {
+				mockOpenXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(&datafetcher.EventsPage{}, nil)
+				mockCloudJsonFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(nil, cloudwatch.ErrorQueryFailed)
+
+				status, result, err := api.GetPipelineReport(context.Background(), queryParams, mockOpenXMLFetcher, mockCloudJsonFetcher)
+
+				Expect(status).To(Equal(api.SelectHTTPStatus(cloudwatch.ErrorQueryFailed)))
+				Expect(result).To(BeNil())
+				Expect(err).To(Equal(cloudwatch.ErrorQueryFailed))
+			})
+		})
+
+		Context("When the time range is not valid", func() {
+			It("returns bad request status without fetching", func() {
+				queryParams[configs.TimeTypeQueryParam] = "sometimes"
+
+				status, _, err := api.GetPipelineReport(context.Background(), queryParams, mockOpenXMLFetcher, mockCloudJsonFetcher)
+
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedTimeRangeType))
+			})
+		})
+	})
+})
@@ -1,35 +1,164 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
 )
 
-// GetStoredObject is the responsible of obtaining the stored objects based in the queryParameters.
-// This function is independent of the Framework used to create the web server as its input is just
-// a maputil containing the http query parameters.
-// A s3Fetcher is injected in order to obtain the stored objects.
-func GetStoredObject(queryParameters map[string]string, s3FetcherUsEast1 storage.S3Fetcher, s3FetcherUsWest1 storage.S3Fetcher) (status int, result []byte, err error) {
+// OpenStoredObject opens the stored object of the queryParameters to be streamed, only byteRange of it if not empty.
+// The caller has to close the body of the result.
+func OpenStoredObject(ctx context.Context, queryParameters map[string]string, byteRange string, s3Registry storage.S3Registry) (status int, result *s3.GetObjectOutput, err error) {
+	s3FetcherToUSe, bucketName, objectKey, err := locateStoredObject(queryParameters, s3Registry)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	result, err = storage.OpenS3Object(ctx, s3FetcherToUSe, bucketName, objectKey, byteRange)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	if result.ContentRange != nil {
+		return http.StatusPartialContent, result, nil
+	}
+	return http.StatusOK, result, nil
+}
+
+// PresignedObject is a URL to download a stored object directly from S3 without credentials until ExpiresAt.
+type PresignedObject struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PresignStoredObject returns a URL, valid during ttl, to download the stored object of the queryParameters.
+func PresignStoredObject(queryParameters map[string]string, ttl time.Duration, s3Registry storage.S3Registry) (status int, result *PresignedObject, err error) {
+	s3FetcherToUSe, bucketName, objectKey, err := locateStoredObject(queryParameters, s3Registry)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	expiresAt := time.Now().UTC().Add(ttl).Truncate(time.Second)
+	url, err := storage.PresignS3Object(s3FetcherToUSe, bucketName, objectKey, ttl)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	return http.StatusOK, &PresignedObject{URL: url, ExpiresAt: expiresAt}, nil
+}
+
+// locateStoredObject returns the S3Fetcher, bucket and key of the stored object of the queryParameters, or
+// storage.ErrorAccessDenied if the access policy or the printer of the queryParameters don't allow reading it.
+func locateStoredObject(queryParameters map[string]string, s3Registry storage.S3Registry) (fetcher storage.S3Fetcher, bucketName string, objectKey string, err error) {
 	bucketRegion, bucketName, objectKey, err := queryparams.ExtractS3Info(queryParameters)
 	if err != nil {
-		status = SelectHTTPStatus(err)
-		return
+		return nil, "", "", err
 	}
 
-	s3FetcherToUSe := selectS3Fetcher(bucketRegion, s3FetcherUsEast1, s3FetcherUsWest1)
+	productNumber, serialNumber, err := queryparams.ExtractPrinterInfo(queryParameters)
+	if err != nil {
+		return nil, "", "", err
+	}
 
-	result, err = storage.GetS3Data(*s3FetcherToUSe, bucketName, objectKey)
+	fetcher, err = selectS3Fetcher(bucketRegion, s3Registry)
+	if err != nil {
+		return nil, "", "", err
+	}
 
-	status = SelectHTTPStatus(err)
-	return status, result, err
+	if !storage.AccessPolicy(configs.GetS3AccessPolicy()).Allows(bucketRegion, bucketName, objectKey) {
+		return nil, "", "", storage.ErrorAccessDenied
+	}
+	if productNumber != "" && !storage.KeyBelongsToPrinter(objectKey, productNumber, serialNumber) {
+		return nil, "", "", storage.ErrorAccessDenied
+	}
+	return fetcher, bucketName, objectKey, nil
 }
 
-func selectS3Fetcher(bucketRegion string, s3FetcherUsEast1 storage.S3Fetcher, s3FetcherUsWest1 storage.S3Fetcher) *storage.S3Fetcher {
-	if bucketRegion == queryparams.UsEast1S3Region {
-		return &s3FetcherUsEast1
+// selectS3Fetcher returns the S3Fetcher of the registry for bucketRegion, or ErrorQueryStringUnsupportedBucketRegion
+// if the registry doesn't support it.
+func selectS3Fetcher(bucketRegion string, s3Registry storage.S3Registry) (storage.S3Fetcher, error) {
+	fetcher, err := s3Registry.Fetcher(bucketRegion)
+	if err == storage.ErrorUnsupportedRegion {
+		return nil, queryparams.ErrorQueryStringUnsupportedBucketRegion
 	}
-	if bucketRegion == queryparams.UsWest1S3Region {
-		return &s3FetcherUsWest1
+	return fetcher, err
+}
+
+// RenderedObject is a stored object decompressed and rendered in a format. ContentLength is -1 when it is unknown.
+type RenderedObject struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+	Encoding      string
+}
+
+// readCloser reads from a Reader (the decompressed body of an object) and closes a Closer (the body itself).
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// RenderStoredObject obtains the stored object of the queryParameters decompressed and rendered in format.
+// The pretty and json formats read the whole object, up to configs.GetStorageRenderMaxBytes.
+func RenderStoredObject(ctx context.Context, queryParameters map[string]string, format string, s3Registry storage.S3Registry) (status int, result *RenderedObject, err error) {
+	status, object, err := OpenStoredObject(ctx, queryParameters, "", s3Registry)
+	if err != nil {
+		return status, nil, err
 	}
-	return nil
+
+	maxBytes := configs.GetStorageRenderMaxBytes()
+	content, err := storage.DecodeContent(object.Body, maxBytes)
+	if err != nil {
+		object.Body.Close()
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	if format == queryparams.DecodedObjectFormat {
+		result = &RenderedObject{
+			Body:          readCloser{Reader: content.Reader, Closer: object.Body},
+			ContentType:   content.MimeType(),
+			ContentLength: -1,
+			Encoding:      content.Encoding,
+		}
+		if content.Encoding == storage.IdentityEncoding && object.ContentLength != nil {
+			result.ContentLength = *object.ContentLength
+		}
+		return http.StatusOK, result, nil
+	}
+
+	defer object.Body.Close()
+	data, err := storage.ReadContent(content, maxBytes)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	contentType := content.Type
+	switch {
+	case format == queryparams.PrettyObjectFormat:
+		data, err = storage.PrettyPrint(data, contentType)
+	case format == queryparams.JSONObjectFormat && contentType == storage.XMLContent:
+		data, err = storage.XMLToJSON(data)
+		contentType = storage.JSONContent
+	case format == queryparams.JSONObjectFormat && contentType != storage.JSONContent:
+		err = storage.ErrorContentNotConvertible
+	}
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	return http.StatusOK, &RenderedObject{
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentType:   storage.MimeType(contentType),
+		ContentLength: int64(len(data)),
+		Encoding:      content.Encoding,
+	}, nil
 }
@@ -1,16 +1,39 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
-	"context"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
 )
 
 // GetPrinterSubscriptions is the responsible of retrieving subscriptions based in the queryParameters.
-func GetPrinterSubscriptions(queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result []*db.CCPrinterSubscriptionModel, err error) {
+func GetPrinterSubscriptions(ctx context.Context, queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result []*db.CCPrinterSubscriptionModel, err error) {
+	productNumber, serialNumber, err := ExtractPrinterInfo(queryParameters)
+	if err != nil {
+		status = SelectHTTPStatus(err)
+		return
+	}
+	consistent, err := ExtractConsistent(queryParameters)
+	if err != nil {
+		status = SelectHTTPStatus(err)
+		return
+	}
 
-	printerId := queryParameters[configs.ProductNumberQueryParam] + db.PrinterIdSeparator + queryParameters[configs.SerialNumberQueryParam]
-	subs, err := printerSubscriptionFetcher.GetPrinterSubscriptions(context.Background(), printerId)
+	printerId := productNumber + db.PrinterIdSeparator + serialNumber
+	var subs []*db.CCPrinterSubscriptionModel
+	if consistent {
+		subs, err = fetchAllSubscriptions(ctx, printerId, printerSubscriptionFetcher)
+	} else {
+		subs, err = printerSubscriptionFetcher.GetPrinterSubscriptions(ctx, printerId)
+	}
 	if err != nil {
 		status = SelectHTTPStatus(err)
 		return
@@ -19,3 +42,259 @@ func GetPrinterSubscriptions(queryParameters map[string]string, printerSubscript
 	status = SelectHTTPStatus(err)
 	return status, subs, err
 }
+
+// fetchAllSubscriptions obtains the subscriptions of all the pages of the printer with strongly consistent queries,
+// following the page tokens until the last page. It returns db.NotFoundErr if there are none.
+func fetchAllSubscriptions(ctx context.Context, printerId string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) ([]*db.CCPrinterSubscriptionModel, error) {
+	var subscriptions []*db.CCPrinterSubscriptionModel
+
+	options := db.QueryOptions{ConsistentRead: true}
+	for {
+		page, err := printerSubscriptionFetcher.QueryPrinterSubscriptions(ctx, printerId, options)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, page.Subscriptions...)
+
+		if page.NextPageToken == "" || page.NextPageToken == options.PageToken {
+			break
+		}
+		options.PageToken = page.NextPageToken
+	}
+
+	if len(subscriptions) == 0 {
+		return nil, db.NotFoundErr
+	}
+	return subscriptions, nil
+}
+
+// IsPaginated returns true if the queryParameters ask for a page of subscriptions (they contain limit or page_token)
+// instead of all of them.
+func IsPaginated(queryParameters map[string]string) bool {
+	return queryParameters[configs.LimitQueryParam] != "" || queryParameters[configs.PageTokenQueryParam] != ""
+}
+
+// QueryPrinterSubscriptions retrieves a page of the subscriptions of the printer of the queryParameters.
+func QueryPrinterSubscriptions(ctx context.Context, queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result *db.SubscriptionsPage, err error) {
+	productNumber, serialNumber, err := ExtractPrinterInfo(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	limit, err := ExtractLimit(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	consistent, err := ExtractConsistent(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	options := db.QueryOptions{
+		Limit:          limit,
+		PageToken:      queryParameters[configs.PageTokenQueryParam],
+		ConsistentRead: consistent,
+	}
+	result, err = printerSubscriptionFetcher.QueryPrinterSubscriptions(ctx, productNumber+db.PrinterIdSeparator+serialNumber, options)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+// GetPrinterSubscription retrieves the subscription of the printer and the account of the queryParameters.
+func GetPrinterSubscription(ctx context.Context, queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result *db.CCPrinterSubscriptionModel, err error) {
+	productNumber, serialNumber, accountId, err := ExtractPrinterKey(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	subscription, err := printerSubscriptionFetcher.Get(ctx, productNumber+db.PrinterIdSeparator+serialNumber, accountId)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	return http.StatusOK, &subscription, nil
+}
+
+// CreatePrinterSubscription stores the subscription of body, a CCPrinterSubscriptionModel in JSON.
+func CreatePrinterSubscription(ctx context.Context, body []byte, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result *db.CCPrinterSubscriptionModel, err error) {
+	subscription := &db.CCPrinterSubscriptionModel{}
+	if err = json.Unmarshal(body, subscription); err != nil {
+		err = db.MalformedSubscriptionErr
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	if err = normalizeSubscription(subscription); err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	if subscription.RegistrationTimeEpoch == 0 {
+		subscription.RegistrationTimeEpoch = time.Now().Unix()
+	}
+	if err = subscription.Validate(); err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	if err = printerSubscriptionFetcher.Put(ctx, subscription); err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	return http.StatusCreated, subscription, nil
+}
+
+// normalizeSubscription normalizes the product number, the serial number and the printer id of subscription (which
+// have to match each other) and trims its account id.
+func normalizeSubscription(subscription *db.CCPrinterSubscriptionModel) error {
+	productNumber, serialNumber := subscription.ProductNumber, subscription.SerialNumber
+	printerId := strings.TrimSpace(subscription.PrinterID)
+	if productNumber == "" && serialNumber == "" {
+		if parts := strings.Split(printerId, db.PrinterIdSeparator); len(parts) == 2 {
+			productNumber, serialNumber = parts[0], parts[1]
+		}
+	}
+
+	productNumber, err := NormalizeProductNumber(productNumber)
+	if err != nil {
+		return db.InvalidPrinterIDErr
+	}
+	serialNumber, err = NormalizeSerialNumber(serialNumber)
+	if err != nil {
+		return db.InvalidPrinterIDErr
+	}
+
+	subscription.ProductNumber = productNumber
+	subscription.SerialNumber = serialNumber
+	subscription.PrinterID = productNumber + db.PrinterIdSeparator + serialNumber
+	if printerId != "" && !strings.EqualFold(printerId, subscription.PrinterID) {
+		return db.InvalidPrinterIDErr
+	}
+
+	subscription.AccountID = strings.TrimSpace(subscription.AccountID)
+	return nil
+}
+
+// DeletePrinterSubscription removes the subscription of the printer and the account of the queryParameters.
+func DeletePrinterSubscription(ctx context.Context, queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, err error) {
+	productNumber, serialNumber, accountId, err := ExtractPrinterKey(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), err
+	}
+
+	if err = printerSubscriptionFetcher.Delete(ctx, productNumber+db.PrinterIdSeparator+serialNumber, accountId); err != nil {
+		return SelectHTTPStatus(err), err
+	}
+	return http.StatusNoContent, nil
+}
+
+// GetSubscriptionsByAccount retrieves a page of the subscriptions of the account of the queryParameters.
+func GetSubscriptionsByAccount(ctx context.Context, queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result *db.SubscriptionsPage, err error) {
+	accountId, err := ExtractAccountID(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	limit, err := ExtractLimit(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	result, err = printerSubscriptionFetcher.GetSubscriptionsByAccount(ctx, accountId, limit, queryParameters[configs.PageTokenQueryParam])
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+// GetSubscriptionsByService retrieves a page of the subscriptions to the service of the queryParameters.
+func GetSubscriptionsByService(ctx context.Context, queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result *db.SubscriptionsPage, err error) {
+	service := db.Service(strings.TrimSpace(queryParameters[configs.ServiceQueryParam]))
+	if service == "" {
+		err = ErrorQueryStringMissingService
+		return SelectHTTPStatus(err), nil, err
+	}
+	if !service.IsValid() {
+		err = db.UnsupportedServiceErr
+		return SelectHTTPStatus(err), nil, err
+	}
+	limit, err := ExtractLimit(queryParameters)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	result, err = printerSubscriptionFetcher.GetSubscriptionsByService(ctx, service, limit, queryParameters[configs.PageTokenQueryParam])
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+// GetPrinterSubscriptionHistory retrieves in chronological order the changes of the subscriptions of the printer
+// of the queryParameters in their time range.
+func GetPrinterSubscriptionHistory(ctx context.Context, queryParameters map[string]string, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result []*db.CCPrinterSubscriptionChangeModel, err error) {
+	productNumber, serialNumber, err := ExtractPrinterInfo(queryParameters)
+	if err == nil && productNumber == "" {
+		err = ErrorQueryStringMissingProductNumber
+	}
+	if err == nil && serialNumber == "" {
+		err = ErrorQueryStringMissingSerialNumber
+	}
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	startTime, endTime, err := ExtractTimeRange(queryParameters, configs.GetMaxChunkedTimeDiffInMinutes())
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+
+	result, err = printerSubscriptionFetcher.GetPrinterSubscriptionHistory(ctx, productNumber+db.PrinterIdSeparator+serialNumber, startTime, endTime)
+	if err != nil {
+		return SelectHTTPStatus(err), nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+// subscriptionEventsFetcher obtains, like a datafetcher.DataFetcher, the registrations of the subscriptions of a printer,
+// as events of the timeline at their RegistrationTimeEpoch.
+type subscriptionEventsFetcher struct {
+	printerSubscriptionFetcher db.PrinterSubscriptionFetcher
+}
+
+// FetchData returns the registrations of the subscriptions of the printer of queryParameters in their time range
+// (starting at the cursor, if any), in chronological order. They all fit in a single page.
+func (fetcher subscriptionEventsFetcher) FetchData(ctx context.Context, queryParameters map[string]string) (*datafetcher.EventsPage, error) {
+	maxTimeDiffInMinutes, err := ExtractMaxTimeDiffInMinutes(queryParameters)
+	if err != nil {
+		return nil, err
+	}
+	_, endTime, startTime, err := ExtractPageTimeRange(queryParameters, maxTimeDiffInMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	productNumber, serialNumber, err := ExtractPrinterInfo(queryParameters)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := fetcher.printerSubscriptionFetcher.GetPrinterSubscriptions(ctx, productNumber+db.PrinterIdSeparator+serialNumber)
+	if err != nil && err != db.NotFoundErr {
+		return nil, err
+	}
+
+	page := &datafetcher.EventsPage{Events: []datafetcher.TimelineEvent{}}
+	for _, subscription := range subscriptions {
+		registrationTime := time.Unix(subscription.RegistrationTimeEpoch, 0).UTC()
+		if registrationTime.Before(startTime) || registrationTime.After(endTime) {
+			continue
+		}
+		page.Events = append(page.Events, datafetcher.TimelineEvent{
+			Timestamp:     registrationTime,
+			ProductNumber: productNumber,
+			SerialNumber:  serialNumber,
+			Attributes: map[string]string{
+				"account_id": subscription.AccountID,
+				"service_id": string(subscription.ServiceID),
+			},
+		})
+	}
+
+	sort.SliceStable(page.Events, func(i, j int) bool { return page.Events[i].Timestamp.Before(page.Events[j].Timestamp) })
+	return page, nil
+}
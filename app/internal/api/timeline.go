@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/maputil"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+// Sources of the events of the default event definitions.
+const (
+	OpenXMLSource   = datafetcher.OpenXMLEvents
+	CloudJsonSource = datafetcher.CloudJsonEvents
+	HeartbeatSource = datafetcher.HeartbeatEvents
+	RTASource       = datafetcher.RTAEvents
+
+	// SubscriptionsSource is the source of the registrations of the subscriptions of the printer, which are in the
+	// timeline with include=subscriptions.
+	SubscriptionsSource = "subscriptions"
+)
+
+// TimelineEntry is a single event of the timeline tagged with the source it comes from.
+type TimelineEntry struct {
+	Source string `json:"source"`
+	datafetcher.TimelineEvent
+}
+
+// Timeline is the chronologically merged list of events of all the sources.
+// Errors contains, for each source that could not be fetched, the reason of the failure.
+type Timeline struct {
+	Entries    []TimelineEntry   `json:"entries"`
+	Errors     map[string]string `json:"errors,omitempty"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// GetTimeline obtains in parallel the events of all the sources based in the queryParameters and merges them in
+// chronological order. It only fails when all the sources fail.
+func GetTimeline(ctx context.Context, queryParameters map[string]string, sources []datafetcher.Source, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) (status int, result *Timeline, err error) {
+	queryParameters, _, _, err = resolveTimeRange(queryParameters)
+	if err != nil {
+		status = SelectHTTPStatus(err)
+		return
+	}
+
+	productNumber, serialNumber, err := ExtractPrinterInfo(queryParameters)
+	if err != nil {
+		status = SelectHTTPStatus(err)
+		return
+	}
+
+	include, err := ExtractInclude(queryParameters)
+	if err != nil {
+		status = SelectHTTPStatus(err)
+		return
+	}
+	if include[IncludeSubscriptions] {
+		switch {
+		case productNumber == "":
+			err = ErrorQueryStringMissingProductNumber
+		case serialNumber == "":
+			err = ErrorQueryStringMissingSerialNumber
+		}
+		if err != nil {
+			status = SelectHTTPStatus(err)
+			return
+		}
+	}
+
+	timelineSources := make([]timelineSource, 0, len(sources)+1)
+	for _, source := range sources {
+		timelineSources = append(timelineSources, timelineSource{Name: source.Name, fetchData: source.Fetcher.FetchData})
+	}
+	if include[IncludeSubscriptions] {
+		subscriptionEvents := subscriptionEventsFetcher{printerSubscriptionFetcher: printerSubscriptionFetcher}
+		timelineSources = append(timelineSources, timelineSource{Name: SubscriptionsSource, fetchData: subscriptionEvents.FetchData})
+	}
+
+	results := make([]*datafetcher.EventsPage, len(timelineSources))
+	errs := make([]error, len(timelineSources))
+
+	var wg sync.WaitGroup
+	for i, source := range timelineSources {
+		wg.Add(1)
+		go func(i int, source timelineSource) {
+			defer wg.Done()
+			results[i], errs[i] = source.fetchData(ctx, queryParameters)
+		}(i, source)
+	}
+	wg.Wait()
+
+	result = &Timeline{Entries: []TimelineEntry{}}
+	var firstErr error
+	var nextCursorTime time.Time
+	for i, source := range timelineSources {
+		if errs[i] != nil {
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[source.Name] = errs[i].Error()
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		for _, event := range results[i].Events {
+			result.Entries = append(result.Entries, TimelineEntry{Source: source.Name, TimelineEvent: event})
+		}
+
+		if results[i].NextCursor == "" {
+			continue
+		}
+		cursor, err := DecodeCursor(results[i].NextCursor)
+		if err != nil {
+			return SelectHTTPStatus(err), nil, err
+		}
+		cursorTime := cursor.Position
+		if result.NextCursor == "" || cursorTime.Before(nextCursorTime) {
+			result.NextCursor = results[i].NextCursor
+			nextCursorTime = cursorTime
+		}
+	}
+
+	if len(timelineSources) > 0 && len(result.Errors) == len(timelineSources) {
+		return SelectHTTPStatus(firstErr), nil, firstErr
+	}
+
+	if result.NextCursor != "" {
+		result.Entries = entriesBefore(result.Entries, nextCursorTime)
+	}
+
+	sort.SliceStable(result.Entries, func(i, j int) bool {
+		return result.Entries[i].Timestamp.Before(result.Entries[j].Timestamp)
+	})
+
+	return http.StatusOK, result, nil
+}
+
+// timelineSource is a source of events of the timeline: the events of a datafetcher.Source or the registrations of
+// the subscriptions of the printer.
+type timelineSource struct {
+	Name      string
+	fetchData func(ctx context.Context, queryParameters map[string]string) (*datafetcher.EventsPage, error)
+}
+
+// resolveTimeRange returns a copy of queryParameters with an absolute time range, so all the sources are queried
+// with the same one, together with the start time of the page and the end time of the time range.
+func resolveTimeRange(queryParameters map[string]string) (resolved map[string]string, startTime, endTime time.Time, err error) {
+	maxTimeDiffInMinutes, err := ExtractMaxTimeDiffInMinutes(queryParameters)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	startTime, endTime, pageStart, err := ExtractPageTimeRange(queryParameters, maxTimeDiffInMinutes)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	absoluteTimeRange := map[string]string{
+		configs.TimeTypeQueryParam:    "absolute",
+		configs.StartTimeQueryParam:   strconv.FormatInt(startTime.Unix(), 10),
+		configs.EndTimeQueryParam:     strconv.FormatInt(endTime.Unix(), 10),
+		configs.OffsetUnitsQueryParam: "",
+		configs.OffsetValueQueryParam: "",
+		configs.DurationQueryParam:    "",
+		configs.AnchorTimeQueryParam:  "",
+		configs.BeforeQueryParam:      "",
+		configs.AfterQueryParam:       "",
+	}
+
+	resolved = make(map[string]string, len(queryParameters))
+	for k, v := range queryParameters {
+		resolved[k] = v
+	}
+	return maputil.JoinMaps(absoluteTimeRange, resolved), pageStart.Truncate(time.Second), endTime.Truncate(time.Second), nil
+}
+
+// entriesBefore returns the entries whose timestamp is previous to limit.
+func entriesBefore(entries []TimelineEntry, limit time.Time) []TimelineEntry {
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if entry.Timestamp.Before(limit) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
@@ -3,16 +3,22 @@ package awslambda
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"unicode/utf8"
 
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
-	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
 
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/api"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/maputil"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
-	"github.com/aws/aws-lambda-go/events"
 )
 
 // LambdaHandler is the function fulfilling the AWS Lambda handler signature.
@@ -21,27 +27,49 @@ type LambdaHandler func(ctx context.Context, request *events.APIGatewayProxyRequ
 
 // CreateLambdaHandler is the responsible of extracting the request path (endpoint) and call the appropiate
 // handler to handle that endpoint.
-func CreateLambdaHandler(s3FetcherUsEast1 storage.S3Fetcher, s3FetcherUsWest1 storage.S3Fetcher,
-	xmlsFetcher datafetcher.DataFetcher, cloudJsonsFetcher datafetcher.DataFetcher,
-	heartbeatsFetcher datafetcher.DataFetcher, rtaFetcher datafetcher.DataFetcher,
-	subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+func CreateLambdaHandler(s3Registry storage.S3Registry,
+	sources []datafetcher.Source, fleetFetcher datafetcher.FleetFetcher, subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+
+	eventHandlers := make(map[string]LambdaHandler, len(sources))
+	for _, source := range sources {
+		eventHandlers[configs.EventPath(source.Name)] = GenericHandler(source.Fetcher)
+	}
 
 	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		if handler, ok := eventHandlers[request.Path]; ok {
+			return handler(ctx, request)
+		}
+
 		var handler LambdaHandler
 
 		switch request.Path {
-		case configs.CloudJsonPath:
-			handler = GenericHandler(cloudJsonsFetcher)
-		case configs.OpenXMLPath:
-			handler = GenericHandler(xmlsFetcher)
-		case configs.HeartbeatPath:
-			handler = GenericHandler(heartbeatsFetcher)
-		case configs.RTAPath:
-			handler = GenericHandler(rtaFetcher)
 		case configs.StorageObjectPath:
-			handler = StorageHandler(s3FetcherUsEast1, s3FetcherUsWest1)
+			handler = StorageHandler(s3Registry)
 		case configs.SubscriptionsPath:
 			handler = SubscriptionHandler(subscriptionFetcher)
+		case configs.SubscriptionsByAccountPath:
+			handler = SubscriptionsPageHandler(subscriptionFetcher, api.GetSubscriptionsByAccount)
+		case configs.SubscriptionsByServicePath:
+			handler = SubscriptionsPageHandler(subscriptionFetcher, api.GetSubscriptionsByService)
+		case configs.SubscriptionsHistoryPath:
+			handler = SubscriptionHistoryHandler(subscriptionFetcher)
+		case configs.TimelinePath:
+			handler = TimelineHandler(sources, subscriptionFetcher)
+		case configs.FleetPath:
+			handler = FleetHandler(fleetFetcher)
+		case configs.HeartbeatAnalysisPath:
+			heartbeatFetcher, ok := datafetcher.FindSource(sources, datafetcher.HeartbeatEvents)
+			if !ok {
+				return newLambdaError(http.StatusBadRequest, ErrorNotValidEndpoint)
+			}
+			handler = HeartbeatAnalysisHandler(heartbeatFetcher)
+		case configs.PipelinePath:
+			openXMLFetcher, openXMLFound := datafetcher.FindSource(sources, datafetcher.OpenXMLEvents)
+			cloudJsonFetcher, cloudJsonFound := datafetcher.FindSource(sources, datafetcher.CloudJsonEvents)
+			if !openXMLFound || !cloudJsonFound {
+				return newLambdaError(http.StatusBadRequest, ErrorNotValidEndpoint)
+			}
+			handler = PipelineHandler(openXMLFetcher, cloudJsonFetcher)
 		default:
 			return newLambdaError(http.StatusBadRequest, ErrorNotValidEndpoint)
 		}
@@ -53,12 +81,59 @@ func CreateLambdaHandler(s3FetcherUsEast1 storage.S3Fetcher, s3FetcherUsWest1 st
 func GenericHandler(fetcher datafetcher.DataFetcher) LambdaHandler {
 	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
 		queryParams := ExtractQueryParams(request)
-		result, err := fetcher.FetchData(queryParams)
 
+		ctx, cacheStats := cloudwatch.WithCacheStats(ctx)
+		status, result, err := api.GetData(ctx, queryParams, fetcher)
+		if err != nil {
+			return newLambdaError(status, err)
+		}
+
+		jsonResp, err := json.Marshal(result)
+		if err != nil {
+			return newLambdaError(http.StatusInternalServerError, err)
+		}
+
+		headers := map[string]string{
+			"Content-type": "application/json",
+		}
+
+		return newLambdaOkResponse(maputil.JoinMaps(cacheStats.Headers(), headers), jsonResp)
+	}
+}
+
+func TimelineHandler(sources []datafetcher.Source, subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractQueryParams(request)
+
+		ctx, cacheStats := cloudwatch.WithCacheStats(ctx)
+		status, result, err := api.GetTimeline(ctx, queryParams, sources, subscriptionFetcher)
+		if err != nil {
+			return newLambdaError(status, err)
+		}
+
+		jsonResp, err := json.Marshal(result)
 		if err != nil {
 			return newLambdaError(http.StatusInternalServerError, err)
 		}
 
+		headers := map[string]string{
+			"Content-type": "application/json",
+		}
+
+		return newLambdaOkResponse(maputil.JoinMaps(cacheStats.Headers(), headers), jsonResp)
+	}
+}
+
+func FleetHandler(fleetFetcher datafetcher.FleetFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractQueryParams(request)
+
+		ctx, cacheStats := cloudwatch.WithCacheStats(ctx)
+		status, result, err := api.GetFleet(ctx, queryParams, fleetFetcher)
+		if err != nil {
+			return newLambdaError(status, err)
+		}
+
 		jsonResp, err := json.Marshal(result)
 		if err != nil {
 			return newLambdaError(http.StatusInternalServerError, err)
@@ -68,33 +143,289 @@ func GenericHandler(fetcher datafetcher.DataFetcher) LambdaHandler {
 			"Content-type": "application/json",
 		}
 
-		return newLambdaOkResponse(headers, jsonResp)
+		return newLambdaOkResponse(maputil.JoinMaps(cacheStats.Headers(), headers), jsonResp)
 	}
 }
 
-func StorageHandler(s3FetcherUsEast1 storage.S3Fetcher, s3FetcherUsWest1 storage.S3Fetcher) LambdaHandler {
+func HeartbeatAnalysisHandler(heartbeatFetcher datafetcher.DataFetcher) LambdaHandler {
 	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
-		queryParams := ExtractStorageQueryParams(request)
+		queryParams := ExtractQueryParams(request)
+
+		ctx, cacheStats := cloudwatch.WithCacheStats(ctx)
+		status, result, err := api.GetHeartbeatAnalysis(ctx, queryParams, heartbeatFetcher)
+		if err != nil {
+			return newLambdaError(status, err)
+		}
+
+		jsonResp, err := json.Marshal(result)
+		if err != nil {
+			return newLambdaError(http.StatusInternalServerError, err)
+		}
+
+		headers := map[string]string{
+			"Content-type": "application/json",
+		}
 
-		status, result, err := api.GetStoredObject(queryParams, s3FetcherUsEast1, s3FetcherUsWest1)
+		return newLambdaOkResponse(maputil.JoinMaps(cacheStats.Headers(), headers), jsonResp)
+	}
+}
+
+func PipelineHandler(openXMLFetcher, cloudJsonFetcher datafetcher.DataFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractQueryParams(request)
 
+		ctx, cacheStats := cloudwatch.WithCacheStats(ctx)
+		status, result, err := api.GetPipelineReport(ctx, queryParams, openXMLFetcher, cloudJsonFetcher)
 		if err != nil {
 			return newLambdaError(status, err)
 		}
 
+		jsonResp, err := json.Marshal(result)
+		if err != nil {
+			return newLambdaError(http.StatusInternalServerError, err)
+		}
+
+		headers := map[string]string{
+			"Content-type": "application/json",
+		}
+
+		return newLambdaOkResponse(maputil.JoinMaps(cacheStats.Headers(), headers), jsonResp)
+	}
+}
+
+// StorageHandler returns the objects decompressed and rendered in the requested format, or their pre-signed URL in
+// presign mode. The raw format and the requests with the Range header are handled by RawObjectHandler.
+func StorageHandler(s3Registry storage.S3Registry) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractStorageQueryParams(request)
+
+		mode, err := ExtractObjectMode(queryParams)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+		if mode == PresignObjectMode {
+			return PresignHandler(s3Registry)(ctx, request)
+		}
+
+		format, err := ExtractObjectFormat(queryParams)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+		if format == RawObjectFormat || ExtractHeader(request, "Range") != "" {
+			return RawObjectHandler(s3Registry)(ctx, request)
+		}
+
+		status, result, err := api.RenderStoredObject(ctx, queryParams, format, s3Registry)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+		defer result.Body.Close()
+
+		// a pre-signed URL would return the object as it is stored, not rendered in format
+		maxBytes := configs.GetStorageLambdaMaxBytes()
+		if result.ContentLength > maxBytes {
+			return newLambdaAPIError(storage.ErrorRenderedObjectTooBig)
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(result.Body, maxBytes+1))
+		if err != nil {
+			return newLambdaAPIError(storage.ErrorReadingObject)
+		}
+		if int64(len(body)) > maxBytes {
+			return newLambdaAPIError(storage.ErrorRenderedObjectTooBig)
+		}
+
 		headers := map[string]string{
-			"Content-type": "text/plain",
+			"Content-type": result.ContentType,
 		}
 
-		return newLambdaOkResponse(headers, result)
+		return newStorageResponse(status, headers, body)
 	}
 }
 
+// RawObjectHandler returns the objects of up to configs.GetStorageLambdaMaxBytes bytes as they are stored, or the
+// range of them requested with the Range header. Bigger objects are redirected to a pre-signed URL.
+func RawObjectHandler(s3Registry storage.S3Registry) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractStorageQueryParams(request)
+
+		status, result, err := api.OpenStoredObject(ctx, queryParams, ExtractHeader(request, "Range"), s3Registry)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+		defer result.Body.Close()
+
+		maxBytes := configs.GetStorageLambdaMaxBytes()
+		if aws.Int64Value(result.ContentLength) > maxBytes {
+			return presignedRedirect(queryParams, s3Registry)
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(result.Body, maxBytes+1))
+		if err != nil {
+			return newLambdaAPIError(storage.ErrorReadingObject)
+		}
+		if int64(len(body)) > maxBytes {
+			return presignedRedirect(queryParams, s3Registry)
+		}
+
+		headers := map[string]string{
+			"Content-type":  aws.StringValue(result.ContentType),
+			"Accept-Ranges": "bytes",
+		}
+		if result.ContentRange != nil {
+			headers["Content-Range"] = *result.ContentRange
+		}
+
+		return newStorageResponse(status, headers, body)
+	}
+}
+
+// newStorageResponse returns the response with the content of a stored object, encoded in base64 unless it is text
+// because API Gateway re-encodes the bodies as UTF-8.
+func newStorageResponse(status int, headers map[string]string, body []byte) (*events.APIGatewayProxyResponse, error) {
+	if storage.IsTextMimeType(headers["Content-type"]) && utf8.Valid(body) {
+		return newLambdaResponse(status, headers, body)
+	}
+	return newLambdaBinaryResponse(status, headers, body)
+}
+
+// PresignHandler returns a pre-signed URL of the object, so it can be downloaded directly from S3.
+func PresignHandler(s3Registry storage.S3Registry) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractStorageQueryParams(request)
+
+		_, result, err := api.PresignStoredObject(queryParams, configs.GetStoragePresignTTL(), s3Registry)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		jsonResp, err := json.Marshal(result)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		headers := map[string]string{
+			"Content-type": "application/json",
+		}
+
+		return newLambdaOkResponse(headers, jsonResp)
+	}
+}
+
+// presignedRedirect returns a redirection to a pre-signed URL of the object of queryParams.
+func presignedRedirect(queryParams map[string]string, s3Registry storage.S3Registry) (*events.APIGatewayProxyResponse, error) {
+	_, result, err := api.PresignStoredObject(queryParams, configs.GetStoragePresignTTL(), s3Registry)
+	if err != nil {
+		return newLambdaAPIError(err)
+	}
+
+	headers := map[string]string{
+		"Location": result.URL,
+	}
+
+	return newLambdaResponse(http.StatusTemporaryRedirect, headers, nil)
+}
+
+// SubscriptionHandler handles the requests to the subscriptions depending on their method: GET (the default),
+// POST or DELETE.
 func SubscriptionHandler(subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
 	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
-		queryParams := ExtractPrinterQueryParams(request)
+		switch request.HTTPMethod {
+		case "", http.MethodGet:
+			if request.QueryStringParameters[configs.AccountIDQueryParam] != "" {
+				return GetSubscriptionHandler(subscriptionFetcher)(ctx, request)
+			}
+			if api.IsPaginated(request.QueryStringParameters) {
+				return SubscriptionsPageHandler(subscriptionFetcher, api.QueryPrinterSubscriptions)(ctx, request)
+			}
+			return GetSubscriptionsHandler(subscriptionFetcher)(ctx, request)
+		case http.MethodPost:
+			return CreateSubscriptionHandler(subscriptionFetcher)(ctx, request)
+		case http.MethodDelete:
+			return DeleteSubscriptionHandler(subscriptionFetcher)(ctx, request)
+		default:
+			return newLambdaError(http.StatusMethodNotAllowed, ErrorNotAllowedMethod)
+		}
+	}
+}
+
+// GetSubscriptionsHandler retrieves all the subscriptions of a printer.
+func GetSubscriptionsHandler(subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractSubscriptionQueryParams(request)
 
-		status, result, err := api.GetPrinterSubscriptions(queryParams, subscriptionFetcher)
+		_, result, err := api.GetPrinterSubscriptions(ctx, queryParams, subscriptionFetcher)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		jsonResp, err := json.Marshal(result)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		headers := map[string]string{
+			"Content-type": "application/json",
+		}
+
+		return newLambdaOkResponse(headers, jsonResp)
+	}
+}
+
+// GetSubscriptionHandler retrieves the subscription of a printer with an account.
+func GetSubscriptionHandler(subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractSubscriptionQueryParams(request)
+
+		status, result, err := api.GetPrinterSubscription(ctx, queryParams, subscriptionFetcher)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		return newSubscriptionResponse(status, result)
+	}
+}
+
+// CreateSubscriptionHandler creates the subscription of the JSON of the body of the request on behalf of its actor.
+func CreateSubscriptionHandler(subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		body, err := ExtractBody(request)
+		if err != nil {
+			return newLambdaAPIError(db.MalformedSubscriptionErr)
+		}
+		ctx = db.WithActor(ctx, ExtractActor(request))
+
+		status, result, err := api.CreatePrinterSubscription(ctx, body, subscriptionFetcher)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		return newSubscriptionResponse(status, result)
+	}
+}
+
+// DeleteSubscriptionHandler removes the subscription of a printer with an account on behalf of the actor of the request.
+func DeleteSubscriptionHandler(subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractSubscriptionQueryParams(request)
+		ctx = db.WithActor(ctx, ExtractActor(request))
+
+		status, err := api.DeletePrinterSubscription(ctx, queryParams, subscriptionFetcher)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		return newLambdaResponse(status, nil, nil)
+	}
+}
+
+// SubscriptionsPageHandler retrieves pages of subscriptions with getPage.
+func SubscriptionsPageHandler(subscriptionFetcher db.PrinterSubscriptionFetcher,
+	getPage func(context.Context, map[string]string, db.PrinterSubscriptionFetcher) (int, *db.SubscriptionsPage, error)) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractSubscriptionQueryParams(request)
+
+		status, result, err := getPage(ctx, queryParams, subscriptionFetcher)
 		if err != nil {
 			return newLambdaError(status, err)
 		}
@@ -111,3 +442,40 @@ func SubscriptionHandler(subscriptionFetcher db.PrinterSubscriptionFetcher) Lamb
 		return newLambdaOkResponse(headers, jsonResp)
 	}
 }
+
+// SubscriptionHistoryHandler retrieves the changes of the subscriptions of a printer in a time range.
+func SubscriptionHistoryHandler(subscriptionFetcher db.PrinterSubscriptionFetcher) LambdaHandler {
+	return func(ctx context.Context, request *events.APIGatewayProxyRequest) (response *events.APIGatewayProxyResponse, err error) {
+		queryParams := ExtractQueryParams(request)
+
+		_, result, err := api.GetPrinterSubscriptionHistory(ctx, queryParams, subscriptionFetcher)
+		if err != nil {
+			return newLambdaAPIError(err)
+		}
+
+		jsonResp, err := json.Marshal(result)
+		if err != nil {
+			return newLambdaError(http.StatusInternalServerError, err)
+		}
+
+		headers := map[string]string{
+			"Content-type": "application/json",
+		}
+
+		return newLambdaOkResponse(headers, jsonResp)
+	}
+}
+
+// newSubscriptionResponse returns a response with status and the subscription in JSON.
+func newSubscriptionResponse(status int, subscription *db.CCPrinterSubscriptionModel) (*events.APIGatewayProxyResponse, error) {
+	jsonResp, err := json.Marshal(subscription)
+	if err != nil {
+		return newLambdaAPIError(err)
+	}
+
+	headers := map[string]string{
+		"Content-type": "application/json",
+	}
+
+	return newLambdaResponse(status, headers, jsonResp)
+}
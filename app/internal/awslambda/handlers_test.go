@@ -1,25 +1,38 @@
 package awslambda_test
 
 import (
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/awslambda"
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher/mocks"
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
-	printerSubscriptionMocks "bitbucket.org/aldoft/printer-timeline-backend/app/internal/db/mocks"
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
-	s3Mocks "bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage/mocks"
 	"bytes"
+	"compress/gzip"
 	"context"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"io/ioutil"
-	"net/http"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/awslambda"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher/mocks"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+	printerSubscriptionMocks "bitbucket.org/aldoft/printer-timeline-backend/app/internal/db/mocks"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
+	s3Mocks "bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage/mocks"
 )
 
 // //go:generate mockgen -source=../s3storage/s3.go -destination=../s3storage/mocks/s3.go -package=mocks
@@ -29,59 +42,6 @@ const (
 	invalidRegion = "EU_CENTRAL_1"
 	bucketName    = "bucketName"
 	objectName    = "objectKey"
-
-	testResponse = `{
-  "Results": [
-    [
-      {
-        "Field": "@timestamp",
-        "Value": "2020-09-16 09:25:00.347"
-      },
-      {
-        "Field": "fields.ProductNumber",
-        "Value": "Y0U23A"
-      },
-      {
-        "Field": "fields.SerialNumber",
-        "Value": "MY97F1T00H"
-      },
-      {
-        "Field": "fields.bucket_name",
-        "Value": "drp-cloudconnector-to-blacksea"
-      },
-      {
-        "Field": "fields.bucket_region",
-        "Value": "US_WEST_1"
-      },
-      {
-        "Field": "fields.key",
-        "Value": "Y0U23A!MY97F1T00H-7396e65a-f5f2-4db9-8d02-bd1a7d4c8132"
-      },
-      {
-        "Field": "fields.topic",
-        "Value": "json"
-      },
-      {
-        "Field": "fields.metadata.date",
-        "Value": "2020-09-16T09:24:59Z"
-      },
-      {
-        "Field": "fields.metadata.xml-generator-object-path",
-        "Value": "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16_09_24_57_813"
-      },
-      {
-        "Field": "@ptr",
-        "Value": "Cl8KJgoiMTAzNjkxMDEzODI3Oi9hd3MvbGFtYmRhL0FXU1BhcnNlchAFEjUaGAIF8qpFWAAAAACOybG5AAX2HZngAAAHgiABKLP57LHJLjCz9O2xyS44CED3E0jRSFDANxABGAE=n     "
-      }
-    ]
-  ],
-  "Statistics": {
-    "BytesScanned": 16792,
-    "RecordsMatched": 13,
-    "RecordsScanned": 52
-  },
-  "Status": "Complete"
-}`
 )
 
 var _ = Describe("Handlers test", func() {
@@ -93,13 +53,16 @@ var _ = Describe("Handlers test", func() {
 		var mockXMLFetcher *mocks.MockDataFetcher
 		var mockHeartbeatFetcher *mocks.MockDataFetcher
 		var mockRTAFetcher *mocks.MockDataFetcher
+		var sources []datafetcher.Source
+		var mockFleetFetcher *mocks.MockFleetFetcher
 
 		var mockPrinterSubscriptionFetcher *printerSubscriptionMocks.MockPrinterSubscriptionFetcher
 		var mockS3UsEastFetcher, mockS3UsWestFetcher *s3Mocks.MockS3Fetcher
+		var s3Registry *storage.RegionRegistry
 		var eventRequest *events.APIGatewayProxyRequest
 
 		var objectResult *s3.GetObjectOutput
-		var results *cloudwatchlogs.GetQueryResultsOutput
+		var results *datafetcher.EventsPage
 
 		BeforeEach(func() {
 			mockCtrl = gomock.NewController(GinkgoT())
@@ -107,14 +70,29 @@ var _ = Describe("Handlers test", func() {
 			mockPrinterSubscriptionFetcher = printerSubscriptionMocks.NewMockPrinterSubscriptionFetcher(mockCtrl)
 			mockS3UsEastFetcher = s3Mocks.NewMockS3Fetcher(mockCtrl)
 			mockS3UsWestFetcher = s3Mocks.NewMockS3Fetcher(mockCtrl)
+			s3Registry = storage.NewRegionRegistry([]string{"us-east-1", "us-west-1"}, func(region string) (storage.S3Fetcher, error) {
+				if region == "us-east-1" {
+					return mockS3UsEastFetcher, nil
+				}
+				return mockS3UsWestFetcher, nil
+			})
 			mockXMLFetcher = mocks.NewMockDataFetcher(mockCtrl)
 			mockCloudJSONFetcher = mocks.NewMockDataFetcher(mockCtrl)
 			mockHeartbeatFetcher = mocks.NewMockDataFetcher(mockCtrl)
 			mockRTAFetcher = mocks.NewMockDataFetcher(mockCtrl)
+			mockFleetFetcher = mocks.NewMockFleetFetcher(mockCtrl)
+			sources = []datafetcher.Source{
+				{Name: datafetcher.OpenXMLEvents, Fetcher: mockXMLFetcher},
+				{Name: datafetcher.CloudJsonEvents, Fetcher: mockCloudJSONFetcher},
+				{Name: datafetcher.HeartbeatEvents, Fetcher: mockHeartbeatFetcher},
+				{Name: datafetcher.RTAEvents, Fetcher: mockRTAFetcher},
+			}
 
 			objectResult = &s3.GetObjectOutput{
-				Body:     ioutil.NopCloser(bytes.NewReader([]byte(`content`))),
-				Metadata: nil,
+				Body:          ioutil.NopCloser(bytes.NewReader([]byte(`content`))),
+				ContentLength: aws.Int64(7),
+				ContentType:   aws.String("text/plain"),
+				Metadata:      nil,
 			}
 			eventRequest = &events.APIGatewayProxyRequest{
 				Path:                  "",
@@ -123,8 +101,18 @@ var _ = Describe("Handlers test", func() {
 				QueryStringParameters: make(map[string]string),
 			}
 
-			err := json.Unmarshal([]byte(testResponse), &results)
-			Expect(err).To(BeNil())
+			results = &datafetcher.EventsPage{Events: []datafetcher.TimelineEvent{
+				{
+					Timestamp:              time.Date(2020, 9, 16, 9, 25, 0, 347000000, time.UTC),
+					ProductNumber:          "Y0U23A",
+					SerialNumber:           "MY97F1T00H",
+					BucketName:             "drp-cloudconnector-to-blacksea",
+					BucketRegion:           "US_WEST_1",
+					Key:                    "Y0U23A!MY97F1T00H-7396e65a-f5f2-4db9-8d02-bd1a7d4c8132",
+					Topic:                  "json",
+					XMLGeneratorObjectPath: "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16_09_24_57_813",
+				},
+			}}
 
 		})
 
@@ -135,8 +123,8 @@ var _ = Describe("Handlers test", func() {
 		It("should call cloudjson fetcher", func() {
 			eventRequest.Path = configs.CloudJsonPath
 
-			handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
-			mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any()).Return(results, nil).MinTimes(1)
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).MinTimes(1)
 
 			_, _ = handler(context.Background(), eventRequest)
 
@@ -145,8 +133,8 @@ var _ = Describe("Handlers test", func() {
 		It("should call openXml fetcher", func() {
 			eventRequest.Path = configs.OpenXMLPath
 
-			handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
-			mockXMLFetcher.EXPECT().FetchData(gomock.Any()).Return(results, nil).MinTimes(1)
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).MinTimes(1)
 
 			_, _ = handler(context.Background(), eventRequest)
 
@@ -155,8 +143,8 @@ var _ = Describe("Handlers test", func() {
 		It("should call heartbeat fetcher", func() {
 			eventRequest.Path = configs.HeartbeatPath
 
-			handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
-			mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any()).Return(results, nil).MinTimes(1)
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).MinTimes(1)
 
 			_, _ = handler(context.Background(), eventRequest)
 
@@ -165,8 +153,8 @@ var _ = Describe("Handlers test", func() {
 		It("should call rta fetcher", func() {
 			eventRequest.Path = configs.RTAPath
 
-			handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
-			mockRTAFetcher.EXPECT().FetchData(gomock.Any()).Return(results, nil).MinTimes(1)
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).MinTimes(1)
 
 			_, _ = handler(context.Background(), eventRequest)
 
@@ -174,7 +162,7 @@ var _ = Describe("Handlers test", func() {
 
 		It("should call subscription fetcher", func() {
 			eventRequest.Path = configs.SubscriptionsPath
-			handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
 			mockPrinterSubscriptionFetcher.EXPECT().GetPrinterSubscriptions(gomock.Any(), gomock.Any()).MinTimes(1).Return([]*db.CCPrinterSubscriptionModel{
 				{
 					PrinterID:             "printerID",
@@ -190,19 +178,278 @@ var _ = Describe("Handlers test", func() {
 
 		})
 
+		Context("Subscriptions", func() {
+			BeforeEach(func() {
+				eventRequest.Path = configs.SubscriptionsPath
+				eventRequest.QueryStringParameters[configs.ProductNumberQueryParam] = "Y0U23A"
+				eventRequest.QueryStringParameters[configs.SerialNumberQueryParam] = "MY97F1T00H"
+				eventRequest.QueryStringParameters[configs.AccountIDQueryParam] = "pr12345678"
+			})
+
+			It("should get the subscription of the account", func() {
+				eventRequest.HTTPMethod = http.MethodGet
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().Get(gomock.Any(), "Y0U23A!MY97F1T00H", "pr12345678").
+					Return(db.CCPrinterSubscriptionModel{PrinterID: "Y0U23A!MY97F1T00H", AccountID: "pr12345678"}, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Body).To(MatchJSON(`{"PrinterID": "Y0U23A!MY97F1T00H", "AccountID": "pr12345678"}`))
+			})
+
+			It("should create the subscription of the body", func() {
+				eventRequest.HTTPMethod = http.MethodPost
+				eventRequest.Body = `{"PN": "Y0U23A", "SN": "MY97F1T00H", "AccountID": "pr12345678", "ServiceID": "PRINTOS", "RegistrationTimeEpoch": 1600248300}`
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().Put(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusCreated))
+				Expect(resp.Body).To(MatchJSON(`{"PrinterID": "Y0U23A!MY97F1T00H", "AccountID": "pr12345678", "PN": "Y0U23A",
+					"SN": "MY97F1T00H", "ServiceID": "PRINTOS", "RegistrationTimeEpoch": 1600248300}`))
+			})
+
+			It("should record the principal of the authorizer as the actor of the creation", func() {
+				eventRequest.HTTPMethod = http.MethodPost
+				eventRequest.Body = `{"PrinterID": "Y0U23A!MY97F1T00H", "AccountID": "pr12345678", "ServiceID": "seals"}`
+				eventRequest.RequestContext.Authorizer = map[string]interface{}{"principalId": "account-manager"}
+				eventRequest.RequestContext.Identity.SourceIP = "10.0.0.1"
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, subscription *db.CCPrinterSubscriptionModel) error {
+						Expect(db.ActorFromContext(ctx)).To(Equal("account-manager"))
+						return nil
+					}).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusCreated))
+			})
+
+			It("should return conflict when the subscription already exists", func() {
+				eventRequest.HTTPMethod = http.MethodPost
+				eventRequest.Body = `{"PrinterID": "Y0U23A!MY97F1T00H", "AccountID": "pr12345678", "ServiceID": "HP-PPU"}`
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().Put(gomock.Any(), gomock.Any()).Return(db.ConditionalPutErr).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusConflict))
+			})
+
+			It("should delete the subscription of the account", func() {
+				eventRequest.HTTPMethod = http.MethodDelete
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().Delete(gomock.Any(), "Y0U23A!MY97F1T00H", "pr12345678").Return(nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusNoContent))
+				Expect(resp.Body).To(BeEmpty())
+			})
+
+			It("should get a page of the subscriptions of the printer", func() {
+				delete(eventRequest.QueryStringParameters, configs.AccountIDQueryParam)
+				eventRequest.QueryStringParameters[configs.PageTokenQueryParam] = "token"
+				eventRequest.QueryStringParameters[configs.ConsistentQueryParam] = "true"
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().QueryPrinterSubscriptions(gomock.Any(), "Y0U23A!MY97F1T00H",
+					db.QueryOptions{Limit: queryparams.DefaultPageLimit, PageToken: "token", ConsistentRead: true}).
+					Return(&db.SubscriptionsPage{Subscriptions: []*db.CCPrinterSubscriptionModel{{PrinterID: "Y0U23A!MY97F1T00H", AccountID: "pr12345678"}}}, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Body).To(MatchJSON(`{"subscriptions": [{"PrinterID": "Y0U23A!MY97F1T00H", "AccountID": "pr12345678"}]}`))
+			})
+
+			It("should get a page of the subscriptions of the account", func() {
+				eventRequest.Path = configs.SubscriptionsByAccountPath
+				eventRequest.QueryStringParameters[configs.LimitQueryParam] = "1"
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().GetSubscriptionsByAccount(gomock.Any(), "pr12345678", int64(1), "").Return(&db.SubscriptionsPage{
+					Subscriptions: []*db.CCPrinterSubscriptionModel{{PrinterID: "Y0U23A!MY97F1T00H", AccountID: "pr12345678"}},
+					NextPageToken: "next",
+				}, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Body).To(MatchJSON(`{"subscriptions": [{"PrinterID": "Y0U23A!MY97F1T00H", "AccountID": "pr12345678"}],
+					"next_page_token": "next"}`))
+			})
+
+			It("should get the last page of the subscriptions to the service", func() {
+				eventRequest.Path = configs.SubscriptionsByServicePath
+				eventRequest.QueryStringParameters[configs.ServiceQueryParam] = "HP-PPU"
+				eventRequest.QueryStringParameters[configs.PageTokenQueryParam] = "token"
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().GetSubscriptionsByService(gomock.Any(), db.Service(db.ServicePPU), int64(queryparams.DefaultPageLimit), "token").
+					Return(&db.SubscriptionsPage{Subscriptions: []*db.CCPrinterSubscriptionModel{}}, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Body).To(MatchJSON(`{"subscriptions": []}`))
+			})
+
+			It("should record the API key as the actor of the deletion", func() {
+				eventRequest.HTTPMethod = http.MethodDelete
+				eventRequest.RequestContext.Identity.APIKeyID = "key1"
+				eventRequest.RequestContext.Identity.SourceIP = "10.0.0.1"
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, printerId string, accountId string) error {
+						Expect(db.ActorFromContext(ctx)).To(Equal("api-key:key1"))
+						return nil
+					}).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusNoContent))
+			})
+
+			It("should get the history of the subscriptions of the printer", func() {
+				eventRequest.Path = configs.SubscriptionsHistoryPath
+				eventRequest.QueryStringParameters[configs.TimeTypeQueryParam] = "relative"
+				eventRequest.QueryStringParameters[configs.OffsetUnitsQueryParam] = "days"
+				eventRequest.QueryStringParameters[configs.OffsetValueQueryParam] = "7"
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockPrinterSubscriptionFetcher.EXPECT().GetPrinterSubscriptionHistory(gomock.Any(), "Y0U23A!MY97F1T00H", gomock.Any(), gomock.Any()).
+					Return([]*db.CCPrinterSubscriptionChangeModel{}, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Body).To(MatchJSON(`[]`))
+			})
+
+			It("should return not allowed for other methods", func() {
+				eventRequest.HTTPMethod = http.MethodPatch
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusMethodNotAllowed))
+			})
+		})
+
+		It("should call all the fetchers for the timeline", func() {
+			eventRequest.Path = configs.TimelinePath
+			eventRequest.QueryStringParameters[configs.TimeTypeQueryParam] = "relative"
+			eventRequest.QueryStringParameters[configs.OffsetUnitsQueryParam] = "minutes"
+			eventRequest.QueryStringParameters[configs.OffsetValueQueryParam] = "10"
+			configs.Init()
+
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).Times(1)
+			mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).Times(1)
+			mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).Times(1)
+			mockRTAFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(results, nil).Times(1)
+
+			resp, err := handler(context.Background(), eventRequest)
+
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+		})
+
+		It("should call fleet fetcher", func() {
+			eventRequest.Path = configs.FleetPath
+			eventRequest.QueryStringParameters[configs.ProductNumberQueryParam] = "Y0U23A"
+
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockFleetFetcher.EXPECT().FetchFleet(gomock.Any(), gomock.Any()).Return(&datafetcher.FleetSummary{ProductNumber: "Y0U23A"}, nil).Times(1)
+
+			resp, err := handler(context.Background(), eventRequest)
+
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+			Expect(resp.Body).To(ContainSubstring(`"product_number":"Y0U23A"`))
+		})
+
+		It("should call heartbeat fetcher for the heartbeat analysis", func() {
+			eventRequest.Path = configs.HeartbeatAnalysisPath
+			eventRequest.QueryStringParameters[configs.TimeTypeQueryParam] = "relative"
+			eventRequest.QueryStringParameters[configs.DurationQueryParam] = "PT10M"
+			eventRequest.QueryStringParameters[configs.ProductNumberQueryParam] = "Y0U23A"
+			eventRequest.QueryStringParameters[configs.SerialNumberQueryParam] = "MY97F1T00H"
+			configs.Init()
+
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockHeartbeatFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(&datafetcher.EventsPage{}, nil).Times(1)
+
+			resp, err := handler(context.Background(), eventRequest)
+
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+			Expect(resp.Body).To(ContainSubstring(`"uptime_percentage":0`))
+		})
+
+		It("should call open xml and cloud json fetchers for the pipeline report", func() {
+			eventRequest.Path = configs.PipelinePath
+			eventRequest.QueryStringParameters[configs.TimeTypeQueryParam] = "relative"
+			eventRequest.QueryStringParameters[configs.DurationQueryParam] = "PT10M"
+			eventRequest.QueryStringParameters[configs.ProductNumberQueryParam] = "Y0U23A"
+			configs.Init()
+
+			handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+			mockXMLFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(&datafetcher.EventsPage{}, nil).Times(1)
+			mockCloudJSONFetcher.EXPECT().FetchData(gomock.Any(), gomock.Any()).Return(&datafetcher.EventsPage{}, nil).Times(1)
+
+			resp, err := handler(context.Background(), eventRequest)
+
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+			Expect(resp.Body).To(ContainSubstring(`"status_counts":{`))
+		})
+
 		Context("object tests", func() {
 			BeforeEach(func() {
 				eventRequest.Path = configs.StorageObjectPath
 
 				eventRequest.QueryStringParameters[configs.BucketNameQueryParam] = bucketName
 				eventRequest.QueryStringParameters[configs.ObjectKeyQueryParam] = objectName
+
+				policy := `{"us-east-1": {"` + bucketName + `": []}, "us-west-1": {"` + bucketName + `": []}}`
+				Expect(os.Setenv(configs.EnvS3AccessPolicy, policy)).To(Succeed())
+				configs.Init()
+			})
+
+			AfterEach(func() {
+				Expect(os.Unsetenv(configs.EnvS3AccessPolicy)).To(Succeed())
+				configs.Init()
 			})
 
 			It("should call object fetcher of east1 region", func() {
 				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = *aws.String(queryparams.UsEast1S3Region)
 
-				handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
-				mockS3UsEastFetcher.EXPECT().GetObject(gomock.Any()).Return(objectResult, nil).MinTimes(1)
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).MinTimes(1)
 
 				_, _ = handler(context.Background(), eventRequest)
 			})
@@ -210,8 +457,8 @@ var _ = Describe("Handlers test", func() {
 			It("should call object fetcher of west1 region", func() {
 				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = *aws.String(queryparams.UsWest1S3Region)
 
-				handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
-				mockS3UsWestFetcher.EXPECT().GetObject(gomock.Any()).Return(objectResult, nil).MinTimes(1)
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsWestFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).MinTimes(1)
 
 				_, _ = handler(context.Background(), eventRequest)
 			})
@@ -219,11 +466,346 @@ var _ = Describe("Handlers test", func() {
 			It("should not call object fetchers for an invalid region", func() {
 				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = *aws.String(invalidRegion)
 
-				handler := awslambda.CreateLambdaHandler(mockS3UsEastFetcher, mockS3UsWestFetcher, mockXMLFetcher, mockCloudJSONFetcher, mockHeartbeatFetcher, mockRTAFetcher, mockPrinterSubscriptionFetcher)
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
 
 				resp, _ := handler(context.Background(), eventRequest)
 
-				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusInternalServerError))
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusBadRequest))
+				Expect(resp.Body).To(Equal(queryparams.ErrorQueryStringUnsupportedBucketRegion.Error()))
+			})
+
+			It("should call object fetcher of the standard name of the region", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = "us-west-1"
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsWestFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+			})
+
+			It("should return the object decompressed with its content type", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				configs.Init()
+
+				var compressed bytes.Buffer
+				writer := gzip.NewWriter(&compressed)
+				_, _ = writer.Write([]byte(`{"topic":"heartbeat"}`))
+				_ = writer.Close()
+				objectResult.Body = ioutil.NopCloser(&compressed)
+				objectResult.ContentLength = aws.Int64(int64(compressed.Len()))
+				objectResult.ContentType = aws.String("application/gzip")
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Headers["Content-type"]).To(Equal("application/json"))
+				Expect(resp.Body).To(Equal(`{"topic":"heartbeat"}`))
+			})
+
+			It("should return the binary objects encoded in base64", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				objectResult.Body = ioutil.NopCloser(bytes.NewReader([]byte{0, 1, 2}))
+				objectResult.ContentLength = aws.Int64(3)
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.Headers["Content-type"]).To(Equal("application/octet-stream"))
+				Expect(resp.IsBase64Encoded).To(BeTrue())
+				Expect(resp.Body).To(Equal("AAEC"))
+			})
+
+			It("should return the object pretty printed in pretty format", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectFormatQueryParam] = queryparams.PrettyObjectFormat
+				objectResult.Body = ioutil.NopCloser(bytes.NewReader([]byte(`<a><b>1</b></a>`)))
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.Headers["Content-type"]).To(Equal("application/xml"))
+				Expect(resp.Body).To(Equal("<a>\n  <b>1</b>\n</a>"))
+			})
+
+			It("should return unprocessable entity when the object can't be converted", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectFormatQueryParam] = queryparams.JSONObjectFormat
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusUnprocessableEntity))
+			})
+
+			It("should return the object as it is stored in raw format", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectFormatQueryParam] = queryparams.RawObjectFormat
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Headers["Content-type"]).To(Equal("text/plain"))
+				Expect(resp.Body).To(Equal("content"))
+			})
+
+			It("should return the binary objects encoded in base64 in raw format", func() {
+				var compressed bytes.Buffer
+				writer := gzip.NewWriter(&compressed)
+				_, err := writer.Write([]byte("compressed content"))
+				Expect(err).To(BeNil())
+				Expect(writer.Close()).To(Succeed())
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectFormatQueryParam] = queryparams.RawObjectFormat
+				objectResult.Body = ioutil.NopCloser(bytes.NewReader(compressed.Bytes()))
+				objectResult.ContentLength = aws.Int64(int64(compressed.Len()))
+				objectResult.ContentType = aws.String("application/gzip")
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.IsBase64Encoded).To(BeTrue())
+				body, err := base64.StdEncoding.DecodeString(resp.Body)
+				Expect(err).To(BeNil())
+				Expect(body).To(Equal(compressed.Bytes()))
+			})
+
+			It("should respond with bad gateway when the object can't be read", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectFormatQueryParam] = queryparams.RawObjectFormat
+				objectResult.Body = ioutil.NopCloser(io.MultiReader(strings.NewReader("cont"), failingReader{}))
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusBadGateway))
+				Expect(resp.Body).To(Equal(storage.ErrorReadingObject.Error()))
+			})
+
+			It("should request the range of the Range header", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.Headers = map[string]string{"range": "bytes=0-3"}
+				objectResult.ContentRange = aws.String("bytes 0-3/7")
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx aws.Context, input *s3.GetObjectInput, options ...request.Option) (*s3.GetObjectOutput, error) {
+						Expect(aws.StringValue(input.Range)).To(Equal("bytes=0-3"))
+						return objectResult, nil
+					}).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusPartialContent))
+				Expect(resp.Headers["Content-Range"]).To(Equal("bytes 0-3/7"))
+			})
+
+			It("should respond with range not satisfiable when the Range header is not in bytes", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.Headers = map[string]string{"range": "lines=0-3"}
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Times(0)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusRequestedRangeNotSatisfiable))
+				Expect(resp.Body).To(Equal(storage.ErrorRangeNotSatisfiable.Error()))
+			})
+
+			It("should redirect to a pre-signed URL when the object is too big in raw format", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectFormatQueryParam] = queryparams.RawObjectFormat
+				objectResult.ContentLength = aws.Int64(configs.DefaultStorageLambdaMaxBytes + 1)
+				configs.Init()
+
+				sess := session.Must(session.NewSession(&aws.Config{
+					Region:      aws.String("us-east-1"),
+					Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+				}))
+				presignRequest, _ := s3.New(sess).GetObjectRequest(&s3.GetObjectInput{
+					Bucket: aws.String(bucketName),
+					Key:    aws.String(objectName),
+				})
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+				mockS3UsEastFetcher.EXPECT().GetObjectRequest(gomock.Any()).Return(presignRequest, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusTemporaryRedirect))
+				Expect(resp.Headers["Location"]).To(ContainSubstring(bucketName + "/" + objectName))
+				Expect(resp.Headers["Location"]).To(ContainSubstring("X-Amz-Expires=900"))
+			})
+
+			It("should respond with request entity too large when the rendered object is too big", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				objectResult.Body = ioutil.NopCloser(strings.NewReader(strings.Repeat("a", configs.DefaultStorageLambdaMaxBytes+1)))
+				objectResult.ContentLength = aws.Int64(configs.DefaultStorageLambdaMaxBytes + 1)
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+				mockS3UsEastFetcher.EXPECT().GetObjectRequest(gomock.Any()).Times(0)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusRequestEntityTooLarge))
+				Expect(resp.Body).To(Equal(storage.ErrorRenderedObjectTooBig.Error()))
+			})
+
+			It("should return a pre-signed URL in presign mode", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsWest1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectModeQueryParam] = queryparams.PresignObjectMode
+				configs.Init()
+
+				sess := session.Must(session.NewSession(&aws.Config{
+					Region:      aws.String("us-west-1"),
+					Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+				}))
+				presignRequest, _ := s3.New(sess).GetObjectRequest(&s3.GetObjectInput{
+					Bucket: aws.String(bucketName),
+					Key:    aws.String(objectName),
+				})
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsWestFetcher.EXPECT().GetObjectRequest(gomock.Any()).
+					DoAndReturn(func(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+						Expect(aws.StringValue(input.Bucket)).To(Equal(bucketName))
+						Expect(aws.StringValue(input.Key)).To(Equal(objectName))
+						return presignRequest, nil
+					}).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+				Expect(resp.Headers["Content-type"]).To(Equal("application/json"))
+				Expect(resp.Body).To(ContainSubstring(`"url":"https://s3.us-west-1.amazonaws.com/bucketName/objectKey?`))
+				Expect(resp.Body).To(ContainSubstring(`"expires_at":`))
+			})
+
+			It("should not call object fetchers for an unsupported mode", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectModeQueryParam] = "upload"
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+
+				resp, _ := handler(context.Background(), eventRequest)
+
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusBadRequest))
+			})
+
+			It("should deny the objects out of the access policy", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				Expect(os.Setenv(configs.EnvS3AccessPolicy, `{"us-east-1": {"otherBucket": []}}`)).To(Succeed())
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusForbidden))
+				Expect(resp.Body).To(Equal(storage.ErrorAccessDenied.Error()))
+			})
+
+			It("should deny every object when there is no access policy", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				Expect(os.Unsetenv(configs.EnvS3AccessPolicy)).To(Succeed())
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(configs.Validate()).To(Succeed())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusForbidden))
+				Expect(resp.Body).To(Equal(storage.ErrorAccessDenied.Error()))
+			})
+
+			It("should deny the objects of other printers", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectKeyQueryParam] = "uploads/raw/L2E27A!CN12345678_2020_09_16"
+				eventRequest.QueryStringParameters[configs.ProductNumberQueryParam] = "Y0U23A"
+				eventRequest.QueryStringParameters[configs.SerialNumberQueryParam] = "MY97F1T00H"
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusForbidden))
+			})
+
+			It("should return the objects of the printer", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+				eventRequest.QueryStringParameters[configs.ObjectKeyQueryParam] = "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16"
+				eventRequest.QueryStringParameters[configs.ProductNumberQueryParam] = "Y0U23A"
+				eventRequest.QueryStringParameters[configs.SerialNumberQueryParam] = "MY97F1T00H"
+				configs.Init()
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(objectResult, nil).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusOK))
+			})
+
+			It("should return not found when the object does not exist", func() {
+				eventRequest.QueryStringParameters[configs.BucketRegionQueryParam] = queryparams.UsEast1S3Region
+
+				handler := awslambda.CreateLambdaHandler(s3Registry, sources, mockFleetFetcher, mockPrinterSubscriptionFetcher)
+				mockS3UsEastFetcher.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).
+					Return(nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)).Times(1)
+
+				resp, err := handler(context.Background(), eventRequest)
+
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(BeEquivalentTo(http.StatusNotFound))
 			})
 
 		})
@@ -231,3 +813,10 @@ var _ = Describe("Handlers test", func() {
 	})
 
 })
+
+// failingReader is an io.Reader that always fails.
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
@@ -1,8 +1,12 @@
 package awslambda
 
 import (
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"encoding/base64"
+	"strings"
+
 	"github.com/aws/aws-lambda-go/events"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 )
 
 // ExtractQueryParams is responsible of extracting the query parameters from the
@@ -14,6 +18,14 @@ func ExtractQueryParams(r *events.APIGatewayProxyRequest) map[string]string {
 		configs.OffsetValueQueryParam:   r.QueryStringParameters[configs.OffsetValueQueryParam],
 		configs.StartTimeQueryParam:     r.QueryStringParameters[configs.StartTimeQueryParam],
 		configs.EndTimeQueryParam:       r.QueryStringParameters[configs.EndTimeQueryParam],
+		configs.DurationQueryParam:      r.QueryStringParameters[configs.DurationQueryParam],
+		configs.AnchorTimeQueryParam:    r.QueryStringParameters[configs.AnchorTimeQueryParam],
+		configs.BeforeQueryParam:        r.QueryStringParameters[configs.BeforeQueryParam],
+		configs.AfterQueryParam:         r.QueryStringParameters[configs.AfterQueryParam],
+		configs.CursorQueryParam:        r.QueryStringParameters[configs.CursorQueryParam],
+		configs.ChunkedQueryParam:       r.QueryStringParameters[configs.ChunkedQueryParam],
+		configs.IntervalQueryParam:      r.QueryStringParameters[configs.IntervalQueryParam],
+		configs.IncludeQueryParam:       r.QueryStringParameters[configs.IncludeQueryParam],
 		configs.ProductNumberQueryParam: r.QueryStringParameters[configs.ProductNumberQueryParam],
 		configs.SerialNumberQueryParam:  r.QueryStringParameters[configs.SerialNumberQueryParam],
 	}
@@ -23,9 +35,13 @@ func ExtractQueryParams(r *events.APIGatewayProxyRequest) map[string]string {
 // API Gateway request and returns a map with those query parameters.
 func ExtractStorageQueryParams(r *events.APIGatewayProxyRequest) map[string]string {
 	return map[string]string{
-		configs.BucketRegionQueryParam: r.QueryStringParameters[configs.BucketRegionQueryParam],
-		configs.BucketNameQueryParam:   r.QueryStringParameters[configs.BucketNameQueryParam],
-		configs.ObjectKeyQueryParam:    r.QueryStringParameters[configs.ObjectKeyQueryParam],
+		configs.BucketRegionQueryParam:  r.QueryStringParameters[configs.BucketRegionQueryParam],
+		configs.BucketNameQueryParam:    r.QueryStringParameters[configs.BucketNameQueryParam],
+		configs.ObjectKeyQueryParam:     r.QueryStringParameters[configs.ObjectKeyQueryParam],
+		configs.ObjectModeQueryParam:    r.QueryStringParameters[configs.ObjectModeQueryParam],
+		configs.ObjectFormatQueryParam:  r.QueryStringParameters[configs.ObjectFormatQueryParam],
+		configs.ProductNumberQueryParam: r.QueryStringParameters[configs.ProductNumberQueryParam],
+		configs.SerialNumberQueryParam:  r.QueryStringParameters[configs.SerialNumberQueryParam],
 	}
 }
 
@@ -37,3 +53,54 @@ func ExtractPrinterQueryParams(r *events.APIGatewayProxyRequest) map[string]stri
 		configs.SerialNumberQueryParam:  r.QueryStringParameters[configs.SerialNumberQueryParam],
 	}
 }
+
+// ExtractSubscriptionQueryParams extracts the query parameters of the subscriptions from the API Gateway request.
+func ExtractSubscriptionQueryParams(r *events.APIGatewayProxyRequest) map[string]string {
+	return map[string]string{
+		configs.ProductNumberQueryParam: r.QueryStringParameters[configs.ProductNumberQueryParam],
+		configs.SerialNumberQueryParam:  r.QueryStringParameters[configs.SerialNumberQueryParam],
+		configs.AccountIDQueryParam:     r.QueryStringParameters[configs.AccountIDQueryParam],
+		configs.ServiceQueryParam:       r.QueryStringParameters[configs.ServiceQueryParam],
+		configs.LimitQueryParam:         r.QueryStringParameters[configs.LimitQueryParam],
+		configs.PageTokenQueryParam:     r.QueryStringParameters[configs.PageTokenQueryParam],
+		configs.ConsistentQueryParam:    r.QueryStringParameters[configs.ConsistentQueryParam],
+	}
+}
+
+// ExtractBody extracts the body of the API Gateway request, decoding it if it is in base64.
+func ExtractBody(r *events.APIGatewayProxyRequest) ([]byte, error) {
+	if r.IsBase64Encoded {
+		return base64.StdEncoding.DecodeString(r.Body)
+	}
+	return []byte(r.Body), nil
+}
+
+// ExtractActor returns who makes the API Gateway request: the principal of its authorizer, its IAM user, its
+// Cognito identity or its API key, in that order, or its source IP if it has none of them.
+func ExtractActor(r *events.APIGatewayProxyRequest) string {
+	if principal, ok := r.RequestContext.Authorizer["principalId"].(string); ok && principal != "" {
+		return principal
+	}
+
+	identity := r.RequestContext.Identity
+	switch {
+	case identity.UserArn != "":
+		return identity.UserArn
+	case identity.CognitoIdentityID != "":
+		return identity.CognitoIdentityID
+	case identity.APIKeyID != "":
+		return "api-key:" + identity.APIKeyID
+	default:
+		return identity.SourceIP
+	}
+}
+
+// ExtractHeader extracts the header called name, case insensitive, from the API Gateway request.
+func ExtractHeader(r *events.APIGatewayProxyRequest, name string) string {
+	for header, value := range r.Headers {
+		if strings.EqualFold(header, name) {
+			return value
+		}
+	}
+	return ""
+}
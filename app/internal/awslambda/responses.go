@@ -1,20 +1,41 @@
 package awslambda
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/http"
 
 	"github.com/aws/aws-lambda-go/events"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/api"
 )
 
 func newLambdaOkResponse(headers map[string]string, response []byte) (*events.APIGatewayProxyResponse, error) {
+	return newLambdaResponse(http.StatusOK, headers, response)
+}
+
+func newLambdaResponse(httpStatus int, headers map[string]string, response []byte) (*events.APIGatewayProxyResponse, error) {
 	return &events.APIGatewayProxyResponse{
-		StatusCode: http.StatusOK,
+		StatusCode: httpStatus,
 		Body:       fmt.Sprintf("%s", response),
 		Headers:    headers,
 	}, nil
 }
 
+func newLambdaBinaryResponse(httpStatus int, headers map[string]string, response []byte) (*events.APIGatewayProxyResponse, error) {
+	return &events.APIGatewayProxyResponse{
+		StatusCode:      httpStatus,
+		Body:            base64.StdEncoding.EncodeToString(response),
+		Headers:         headers,
+		IsBase64Encoded: true,
+	}, nil
+}
+
+// newLambdaAPIError returns the error response to err with the http status of api.SelectHTTPStatus.
+func newLambdaAPIError(err error) (*events.APIGatewayProxyResponse, error) {
+	return newLambdaError(api.SelectHTTPStatus(err), err)
+}
+
 func newLambdaError(httpStatus int, err error) (*events.APIGatewayProxyResponse, error) {
 	return &events.APIGatewayProxyResponse{
 		StatusCode: httpStatus,
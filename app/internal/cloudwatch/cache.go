@@ -0,0 +1,162 @@
+package cloudwatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// Headers of the responses with the number of queries whose results were obtained from the cache (hits) and
+// the number of queries that had to be executed in AWS CloudWatch Insights although they could be cached (misses).
+const (
+	CacheHitsHeader   = "X-Cache-Hits"
+	CacheMissesHeader = "X-Cache-Misses"
+)
+
+// QueryCache stores the results of the queries by key. Put returns ErrorCacheValueTooBig when value is bigger
+// than what the cache can store.
+type QueryCache interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Put(ctx context.Context, key string, value []byte) error
+}
+
+// CachingQueryExecutor is a QueryExecutor that caches the results of another one. Only the queries whose time range
+// ended more than settleMargin ago are cached, because the logs are ingested with a delay.
+type CachingQueryExecutor struct {
+	queryExecutor QueryExecutor
+	cache         QueryCache
+	settleMargin  time.Duration
+	now           func() time.Time
+}
+
+// NewCachingQueryExecutor creates a new CachingQueryExecutor that caches in cache the results of queryExecutor
+// for the time ranges that ended more than settleMargin ago.
+func NewCachingQueryExecutor(queryExecutor QueryExecutor, cache QueryCache, settleMargin time.Duration) QueryExecutor {
+	return CachingQueryExecutor{queryExecutor, cache, settleMargin, time.Now}
+}
+
+// ExecuteQuery returns the cached results of insightsQueryParams, or executes the query and caches its results.
+// If the cache fails the query is executed anyway. It also returns an error, if any.
+func (cachingQueryExecutor CachingQueryExecutor) ExecuteQuery(ctx context.Context, insightsQueryParams InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	settled := cachingQueryExecutor.now().Add(-cachingQueryExecutor.settleMargin)
+	if insightsQueryParams.EndTimeEpoch >= settled.Unix() {
+		return cachingQueryExecutor.queryExecutor.ExecuteQuery(ctx, insightsQueryParams)
+	}
+
+	stats := CacheStatsFromContext(ctx)
+	key := CacheKey(insightsQueryParams)
+
+	value, ok, err := cachingQueryExecutor.cache.Get(ctx, key)
+	if err != nil {
+		fmt.Println("WARNING: error reading the query cache. cause:", err)
+	}
+	if ok {
+		result := &cloudwatchlogs.GetQueryResultsOutput{}
+		if err := json.Unmarshal(value, result); err == nil {
+			result.Statistics = &cloudwatchlogs.QueryStatistics{BytesScanned: aws.Float64(0)}
+			stats.addHit()
+			return result, nil
+		}
+		fmt.Println("WARNING: ignoring malformed entry of the query cache", key)
+	}
+
+	stats.addMiss()
+	result, err := cachingQueryExecutor.queryExecutor.ExecuteQuery(ctx, insightsQueryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.StringValue(result.Status) == cloudwatchlogs.QueryStatusComplete {
+		value, err := json.Marshal(result)
+		if err == nil {
+			err = cachingQueryExecutor.cache.Put(ctx, key, value)
+		}
+		switch {
+		case err == ErrorCacheValueTooBig:
+			fmt.Println("INFO: not caching the", len(value), "bytes of the results of the query", key)
+		case err != nil:
+			fmt.Println("WARNING: error writing the query cache. cause:", err)
+		}
+	}
+	return result, nil
+}
+
+// CacheKey returns the key under which the results of insightsQueryParams are cached. It is a hash of the log group,
+// the query and the time range, so queries that differ in any of them never share results.
+func CacheKey(insightsQueryParams InsightsQueryParams) string {
+	hash := sha256.New()
+	for _, part := range []string{
+		insightsQueryParams.LogGroupName,
+		insightsQueryParams.Query,
+		strconv.FormatInt(insightsQueryParams.StartTimeEpoch, 10),
+		strconv.FormatInt(insightsQueryParams.EndTimeEpoch, 10),
+	} {
+		// The length prefix prevents different parameters from producing the same sequence of bytes.
+		hash.Write([]byte(strconv.Itoa(len(part)) + ":" + part))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CacheStats counts the cache hits and misses of the queries executed while handling a request.
+// It is safe for concurrent use.
+type CacheStats struct {
+	hits, misses int64
+}
+
+type cacheStatsKey struct{}
+
+// WithCacheStats returns a copy of ctx that records the cache hits and misses in the returned CacheStats.
+func WithCacheStats(ctx context.Context) (context.Context, *CacheStats) {
+	stats := &CacheStats{}
+	return context.WithValue(ctx, cacheStatsKey{}, stats), stats
+}
+
+// CacheStatsFromContext returns the CacheStats of ctx, or nil if it has none.
+func CacheStatsFromContext(ctx context.Context) *CacheStats {
+	stats, _ := ctx.Value(cacheStatsKey{}).(*CacheStats)
+	return stats
+}
+
+// Hits returns the number of queries whose results were obtained from the cache.
+func (stats *CacheStats) Hits() int64 {
+	if stats == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&stats.hits)
+}
+
+// Misses returns the number of cacheable queries that were not in the cache.
+func (stats *CacheStats) Misses() int64 {
+	if stats == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&stats.misses)
+}
+
+// Headers returns the response headers with the hits and misses of stats.
+func (stats *CacheStats) Headers() map[string]string {
+	return map[string]string{
+		CacheHitsHeader:   strconv.FormatInt(stats.Hits(), 10),
+		CacheMissesHeader: strconv.FormatInt(stats.Misses(), 10),
+	}
+}
+
+func (stats *CacheStats) addHit() {
+	if stats != nil {
+		atomic.AddInt64(&stats.hits, 1)
+	}
+}
+
+func (stats *CacheStats) addMiss() {
+	if stats != nil {
+		atomic.AddInt64(&stats.misses, 1)
+	}
+}
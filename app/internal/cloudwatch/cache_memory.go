@@ -0,0 +1,79 @@
+package cloudwatch
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// MemoryQueryCache is an implementation of the interface QueryCache that keeps in memory the most recently used
+// entries, up to capacity entries and maxBytes bytes of values. It is safe for concurrent use.
+type MemoryQueryCache struct {
+	capacity int
+	maxBytes int64
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	bytes   int64
+}
+
+type memoryCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryQueryCache creates a new MemoryQueryCache that keeps at most capacity entries whose values add up to at
+// most maxBytes bytes. It returns ErrorInvalidCacheLimits if capacity or maxBytes are not positive.
+func NewMemoryQueryCache(capacity int, maxBytes int64) (*MemoryQueryCache, error) {
+	if capacity <= 0 || maxBytes <= 0 {
+		return nil, ErrorInvalidCacheLimits
+	}
+	return &MemoryQueryCache{
+		capacity: capacity,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}, nil
+}
+
+// Get returns the value stored for key and marks it as the most recently used.
+// It returns ok as false when there is nothing stored for key. It never returns an error.
+func (cache *MemoryQueryCache) Get(ctx context.Context, key string) (value []byte, ok bool, err error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*memoryCacheEntry).value, true, nil
+}
+
+// Put stores value for key, evicting the least recently used entries to stay within capacity and maxBytes.
+func (cache *MemoryQueryCache) Put(ctx context.Context, key string, value []byte) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+	if int64(len(value)) > cache.maxBytes {
+		return ErrorCacheValueTooBig
+	}
+
+	cache.entries[key] = cache.order.PushFront(&memoryCacheEntry{key, value})
+	cache.bytes += int64(len(value))
+	for cache.order.Len() > cache.capacity || cache.bytes > cache.maxBytes {
+		cache.remove(cache.order.Back())
+	}
+	return nil
+}
+
+// remove removes the entry of element from the cache.
+func (cache *MemoryQueryCache) remove(element *list.Element) {
+	entry := cache.order.Remove(element).(*memoryCacheEntry)
+	delete(cache.entries, entry.key)
+	cache.bytes -= int64(len(entry.value))
+}
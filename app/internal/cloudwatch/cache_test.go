@@ -0,0 +1,218 @@
+package cloudwatch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+)
+
+// countingQueryExecutor is a QueryExecutor that counts its executions and returns a completed query with one result,
+// or err if it is set.
+type countingQueryExecutor struct {
+	executions int
+	status     string
+	err        error
+}
+
+func (executor *countingQueryExecutor) ExecuteQuery(ctx context.Context, insightsQueryParams cloudwatch.InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	executor.executions++
+	if executor.err != nil {
+		return nil, executor.err
+	}
+
+	status := executor.status
+	if status == "" {
+		status = cloudwatchlogs.QueryStatusComplete
+	}
+	return &cloudwatchlogs.GetQueryResultsOutput{
+		Status:     aws.String(status),
+		Statistics: &cloudwatchlogs.QueryStatistics{BytesScanned: aws.Float64(1024)},
+		Results: [][]*cloudwatchlogs.ResultField{
+			{{Field: aws.String("@timestamp"), Value: aws.String("2020-09-16 09:00:00.000")}},
+		},
+	}, nil
+}
+
+// failingQueryCache is a QueryCache that always fails.
+type failingQueryCache struct{}
+
+func (failingQueryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, errors.New("cache unavailable")
+}
+
+func (failingQueryCache) Put(ctx context.Context, key string, value []byte) error {
+	return errors.New("cache unavailable")
+}
+
+var _ = Describe("CachingQueryExecutor", func() {
+	var executor *countingQueryExecutor
+	var params cloudwatch.InsightsQueryParams
+
+	BeforeEach(func() {
+		executor = &countingQueryExecutor{}
+		params = cloudwatch.InsightsQueryParams{
+			StartTimeEpoch: 1600248300,
+			EndTimeEpoch:   1600251900,
+			LogGroupName:   "logGroup",
+			Query:          "fields @timestamp",
+		}
+	})
+
+	Context("When the time range is in the past", func() {
+		It("executes the query once and returns the cached results afterwards", func() {
+			cachingExecutor := cloudwatch.NewCachingQueryExecutor(executor, newMemoryQueryCache(10, 1024), time.Minute)
+			ctx, stats := cloudwatch.WithCacheStats(context.Background())
+
+			first, err := cachingExecutor.ExecuteQuery(ctx, params)
+			Expect(err).To(BeNil())
+			second, err := cachingExecutor.ExecuteQuery(ctx, params)
+			Expect(err).To(BeNil())
+
+			Expect(executor.executions).To(Equal(1))
+			Expect(second.Results).To(Equal(first.Results))
+			Expect(*second.Statistics.BytesScanned).To(BeZero())
+			Expect(stats.Hits()).To(BeEquivalentTo(1))
+			Expect(stats.Misses()).To(BeEquivalentTo(1))
+			Expect(stats.Headers()).To(Equal(map[string]string{
+				cloudwatch.CacheHitsHeader:   "1",
+				cloudwatch.CacheMissesHeader: "1",
+			}))
+		})
+
+		It("does not share results between different queries", func() {
+			cachingExecutor := cloudwatch.NewCachingQueryExecutor(executor, newMemoryQueryCache(10, 1024), time.Minute)
+
+			_, err := cachingExecutor.ExecuteQuery(context.Background(), params)
+			Expect(err).To(BeNil())
+			params.Query = "fields @timestamp, @message"
+			_, err = cachingExecutor.ExecuteQuery(context.Background(), params)
+			Expect(err).To(BeNil())
+
+			Expect(executor.executions).To(Equal(2))
+		})
+
+		It("does not cache queries that did not complete", func() {
+			executor.status = cloudwatchlogs.QueryStatusRunning
+			cachingExecutor := cloudwatch.NewCachingQueryExecutor(executor, newMemoryQueryCache(10, 1024), time.Minute)
+
+			_, _ = cachingExecutor.ExecuteQuery(context.Background(), params)
+			_, _ = cachingExecutor.ExecuteQuery(context.Background(), params)
+
+			Expect(executor.executions).To(Equal(2))
+		})
+
+		It("returns the error of the query without caching it", func() {
+			executor.err = errors.New("query failed")
+			cachingExecutor := cloudwatch.NewCachingQueryExecutor(executor, newMemoryQueryCache(10, 1024), time.Minute)
+
+			_, err := cachingExecutor.ExecuteQuery(context.Background(), params)
+			Expect(err).To(MatchError("query failed"))
+			_, err = cachingExecutor.ExecuteQuery(context.Background(), params)
+			Expect(err).To(MatchError("query failed"))
+
+			Expect(executor.executions).To(Equal(2))
+		})
+
+		It("executes the query when the cache fails", func() {
+			cachingExecutor := cloudwatch.NewCachingQueryExecutor(executor, failingQueryCache{}, time.Minute)
+
+			result, err := cachingExecutor.ExecuteQuery(context.Background(), params)
+
+			Expect(err).To(BeNil())
+			Expect(result.Results).To(HaveLen(1))
+			Expect(executor.executions).To(Equal(1))
+		})
+	})
+
+	Context("When the time range ends within the settle margin", func() {
+		It("always executes the query and does not count it as a miss", func() {
+			cachingExecutor := cloudwatch.NewCachingQueryExecutor(executor, newMemoryQueryCache(10, 1024), time.Hour)
+			ctx, stats := cloudwatch.WithCacheStats(context.Background())
+			params.EndTimeEpoch = time.Now().Add(-time.Minute).Unix()
+
+			_, err := cachingExecutor.ExecuteQuery(ctx, params)
+			Expect(err).To(BeNil())
+			_, err = cachingExecutor.ExecuteQuery(ctx, params)
+			Expect(err).To(BeNil())
+
+			Expect(executor.executions).To(Equal(2))
+			Expect(stats.Hits()).To(BeZero())
+			Expect(stats.Misses()).To(BeZero())
+		})
+	})
+})
+
+// newMemoryQueryCache creates a MemoryQueryCache failing the test if the limits are not valid.
+func newMemoryQueryCache(capacity int, maxBytes int64) *cloudwatch.MemoryQueryCache {
+	cache, err := cloudwatch.NewMemoryQueryCache(capacity, maxBytes)
+	Expect(err).To(BeNil())
+	return cache
+}
+
+var _ = Describe("MemoryQueryCache", func() {
+	It("returns an error when the capacity or the maximum bytes are not positive", func() {
+		for _, limits := range [][2]int64{{0, 1024}, {10, 0}, {-1, 1024}, {10, -1}} {
+			cache, err := cloudwatch.NewMemoryQueryCache(int(limits[0]), limits[1])
+
+			Expect(err).To(Equal(cloudwatch.ErrorInvalidCacheLimits), fmt.Sprint(limits))
+			Expect(cache).To(BeNil())
+		}
+	})
+
+	It("evicts the least recently used entry when it is full", func() {
+		ctx := context.Background()
+		cache := newMemoryQueryCache(2, 1024)
+
+		Expect(cache.Put(ctx, "a", []byte("1"))).To(Succeed())
+		Expect(cache.Put(ctx, "b", []byte("2"))).To(Succeed())
+		_, ok, _ := cache.Get(ctx, "a")
+		Expect(ok).To(BeTrue())
+		Expect(cache.Put(ctx, "c", []byte("3"))).To(Succeed())
+
+		_, ok, _ = cache.Get(ctx, "b")
+		Expect(ok).To(BeFalse())
+		value, ok, err := cache.Get(ctx, "a")
+		Expect(ok).To(BeTrue())
+		Expect(err).To(BeNil())
+		Expect(value).To(Equal([]byte("1")))
+		_, ok, _ = cache.Get(ctx, "c")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("evicts the least recently used entries when their values exceed the maximum bytes", func() {
+		ctx := context.Background()
+		cache := newMemoryQueryCache(10, 10)
+
+		Expect(cache.Put(ctx, "a", []byte("1234"))).To(Succeed())
+		Expect(cache.Put(ctx, "b", []byte("5678"))).To(Succeed())
+		Expect(cache.Put(ctx, "c", []byte("90"))).To(Succeed())
+		Expect(cache.Put(ctx, "d", []byte("1"))).To(Succeed())
+
+		_, ok, _ := cache.Get(ctx, "a")
+		Expect(ok).To(BeFalse())
+		for _, key := range []string{"b", "c", "d"} {
+			_, ok, _ = cache.Get(ctx, key)
+			Expect(ok).To(BeTrue(), key)
+		}
+	})
+
+	It("does not store a value bigger than the maximum bytes", func() {
+		ctx := context.Background()
+		cache := newMemoryQueryCache(10, 10)
+		Expect(cache.Put(ctx, "a", []byte("1"))).To(Succeed())
+
+		err := cache.Put(ctx, "a", []byte("12345678901"))
+
+		Expect(err).To(Equal(cloudwatch.ErrorCacheValueTooBig))
+		_, ok, _ := cache.Get(ctx, "a")
+		Expect(ok).To(BeFalse())
+	})
+})
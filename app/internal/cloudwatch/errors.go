@@ -0,0 +1,21 @@
+package cloudwatch
+
+import (
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/errorTypes"
+)
+
+const (
+	ErrorQueryFailed    = ConstError("insights query failed error")
+	ErrorQueryCancelled = ConstError("insights query cancelled error")
+	ErrorQueryTimeout   = ConstError("insights query timed out error")
+
+	ErrorCacheValueTooBig   = ConstError("query results too big to be cached error")
+	ErrorInvalidCacheLimits = ConstError("query cache size and max bytes must be greater than zero error")
+
+	ErrorInvalidQueryField       = ConstError("invalid field name in insights query error")
+	ErrorInvalidQueryAlias       = ConstError("invalid alias in insights query error")
+	ErrorInvalidQueryLimit       = ConstError("invalid limit in insights query error")
+	ErrorInvalidQueryBin         = ConstError("invalid bin in insights query error")
+	ErrorInvalidQueryPredicate   = ConstError("invalid predicate in insights query error")
+	ErrorInvalidQueryAggregation = ConstError("invalid aggregation in insights query error")
+)
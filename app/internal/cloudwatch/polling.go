@@ -0,0 +1,48 @@
+package cloudwatch
+
+import (
+	"time"
+)
+
+// PollingStrategy defines how QueryExecutorImpl waits for the results of a query: the delay grows from InitialDelay
+// by BackoffFactor up to MaxDelay, and a Timeout of zero means no timeout.
+type PollingStrategy struct {
+	InitialDelay  time.Duration
+	BackoffFactor float64
+	MaxDelay      time.Duration
+	Timeout       time.Duration
+}
+
+// MinPollingDelay is the minimum delay between two requests of the results of a query.
+const MinPollingDelay = 50 * time.Millisecond
+
+// DefaultPollingStrategy is the PollingStrategy used when no other one is configured.
+var DefaultPollingStrategy = PollingStrategy{
+	InitialDelay:  250 * time.Millisecond,
+	BackoffFactor: 2,
+	MaxDelay:      5 * time.Second,
+	Timeout:       5 * time.Minute,
+}
+
+// FirstDelay returns the delay to wait before requesting the results of a query the first time.
+func (strategy PollingStrategy) FirstDelay() time.Duration {
+	if strategy.InitialDelay < MinPollingDelay {
+		return MinPollingDelay
+	}
+	return strategy.InitialDelay
+}
+
+// NextDelay returns the delay to wait after having waited delay and the query being still running.
+func (strategy PollingStrategy) NextDelay(delay time.Duration) time.Duration {
+	next := time.Duration(float64(delay) * strategy.BackoffFactor)
+	if next < delay {
+		next = delay
+	}
+	if strategy.MaxDelay > 0 && next > strategy.MaxDelay {
+		next = strategy.MaxDelay
+	}
+	if next < MinPollingDelay {
+		next = MinPollingDelay
+	}
+	return next
+}
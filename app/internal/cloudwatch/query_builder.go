@@ -0,0 +1,379 @@
+package cloudwatch
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxQueryLimit is the maximum number of results that a query of AWS CloudWatch Insights can return.
+const MaxQueryLimit = 10000
+
+// SortOrder is the order of the results of a query.
+type SortOrder string
+
+const (
+	Ascending  SortOrder = "asc"
+	Descending SortOrder = "desc"
+)
+
+// plainFieldPattern are the field names that can be written in a query without backticks.
+var plainFieldPattern = regexp.MustCompile(`^@?[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+// aliasPattern are the valid names of the results of an aggregation.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// stringEscaper escapes the characters that can't appear as they are inside a string literal of a query.
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// QuoteField returns field as it has to be written in a query, surrounded by backticks if needed.
+// It returns ErrorInvalidQueryField if field is empty or contains backticks or line breaks.
+func QuoteField(field string) (string, error) {
+	if field == "" || strings.ContainsAny(field, "`\n\r") {
+		return "", ErrorInvalidQueryField
+	}
+	if plainFieldPattern.MatchString(field) {
+		return field, nil
+	}
+	return "`" + field + "`", nil
+}
+
+// QuoteString returns value as a string literal of a query, escaping quotes, backslashes and line breaks,
+// so a value can never end the literal and inject other expressions into a query.
+func QuoteString(value string) string {
+	return `"` + stringEscaper.Replace(value) + `"`
+}
+
+// Predicate is a condition of the filter command of a query.
+type Predicate interface {
+	render() (string, error)
+}
+
+type presentPredicate struct {
+	field string
+}
+
+type comparisonPredicate struct {
+	field, operator, value string
+}
+
+type logicalPredicate struct {
+	operator   string
+	predicates []Predicate
+}
+
+type notPredicate struct {
+	predicate Predicate
+}
+
+// IsPresent returns a Predicate satisfied by the logs that contain field.
+func IsPresent(field string) Predicate {
+	return presentPredicate{field}
+}
+
+// Equals returns a Predicate satisfied by the logs whose field is value.
+func Equals(field, value string) Predicate {
+	return comparisonPredicate{field, "=", value}
+}
+
+// NotEquals returns a Predicate satisfied by the logs whose field is not value.
+func NotEquals(field, value string) Predicate {
+	return comparisonPredicate{field, "!=", value}
+}
+
+// And returns a Predicate satisfied by the logs that satisfy all the predicates.
+func And(predicates ...Predicate) Predicate {
+	return logicalPredicate{"and", predicates}
+}
+
+// Or returns a Predicate satisfied by the logs that satisfy any of the predicates.
+func Or(predicates ...Predicate) Predicate {
+	return logicalPredicate{"or", predicates}
+}
+
+// Not returns a Predicate satisfied by the logs that do not satisfy predicate.
+func Not(predicate Predicate) Predicate {
+	return notPredicate{predicate}
+}
+
+func (predicate presentPredicate) render() (string, error) {
+	field, err := QuoteField(predicate.field)
+	if err != nil {
+		return "", err
+	}
+	return "ispresent(" + field + ")", nil
+}
+
+func (predicate comparisonPredicate) render() (string, error) {
+	field, err := QuoteField(predicate.field)
+	if err != nil {
+		return "", err
+	}
+	return field + " " + predicate.operator + " " + QuoteString(predicate.value), nil
+}
+
+func (predicate logicalPredicate) render() (string, error) {
+	if len(predicate.predicates) == 0 {
+		return "", ErrorInvalidQueryPredicate
+	}
+
+	rendered, err := renderPredicates(predicate.predicates)
+	if err != nil {
+		return "", err
+	}
+	if len(rendered) == 1 {
+		return rendered[0], nil
+	}
+	return "(" + strings.Join(rendered, " "+predicate.operator+" ") + ")", nil
+}
+
+func (predicate notPredicate) render() (string, error) {
+	if predicate.predicate == nil {
+		return "", ErrorInvalidQueryPredicate
+	}
+
+	rendered, err := predicate.predicate.render()
+	if err != nil {
+		return "", err
+	}
+	return "not (" + rendered + ")", nil
+}
+
+func renderPredicates(predicates []Predicate) ([]string, error) {
+	rendered := make([]string, 0, len(predicates))
+	for _, predicate := range predicates {
+		if predicate == nil {
+			return nil, ErrorInvalidQueryPredicate
+		}
+		r, err := predicate.render()
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, r)
+	}
+	return rendered, nil
+}
+
+// Aggregation is a function of the stats command of a query, whose result is called Alias.
+type Aggregation struct {
+	Function string
+	Field    string
+	Alias    string
+}
+
+// Count returns the Aggregation that counts the logs of each group.
+func Count(alias string) Aggregation {
+	return Aggregation{"count", "*", alias}
+}
+
+// CountDistinct returns the Aggregation that counts the different values of field in each group.
+func CountDistinct(field, alias string) Aggregation {
+	return Aggregation{"count_distinct", field, alias}
+}
+
+// Min returns the Aggregation that obtains the minimum value of field in each group.
+func Min(field, alias string) Aggregation {
+	return Aggregation{"min", field, alias}
+}
+
+// Max returns the Aggregation that obtains the maximum value of field in each group.
+func Max(field, alias string) Aggregation {
+	return Aggregation{"max", field, alias}
+}
+
+// Earliest returns the Aggregation that obtains the value of field in the earliest log of each group.
+func Earliest(field, alias string) Aggregation {
+	return Aggregation{"earliest", field, alias}
+}
+
+// Latest returns the Aggregation that obtains the value of field in the latest log of each group.
+func Latest(field, alias string) Aggregation {
+	return Aggregation{"latest", field, alias}
+}
+
+func (aggregation Aggregation) render() (string, error) {
+	if !aliasPattern.MatchString(aggregation.Function) {
+		return "", ErrorInvalidQueryAggregation
+	}
+	if !aliasPattern.MatchString(aggregation.Alias) {
+		return "", ErrorInvalidQueryAlias
+	}
+
+	field := aggregation.Field
+	if field != "*" {
+		var err error
+		if field, err = QuoteField(field); err != nil {
+			return "", err
+		}
+	}
+	return aggregation.Function + "(" + field + ") as " + aggregation.Alias, nil
+}
+
+// Group is an expression of the by clause of the stats command of a query.
+type Group interface {
+	render() (string, error)
+}
+
+type fieldGroup struct {
+	field string
+}
+
+type binGroup struct {
+	period time.Duration
+}
+
+// ByField returns the Group of the logs with the same value of field.
+func ByField(field string) Group {
+	return fieldGroup{field}
+}
+
+// Bin returns the Group of the logs whose @timestamp is in the same interval of length period.
+// Period has to be a whole number of seconds.
+func Bin(period time.Duration) Group {
+	return binGroup{period}
+}
+
+func (group fieldGroup) render() (string, error) {
+	return QuoteField(group.field)
+}
+
+func (group binGroup) render() (string, error) {
+	if group.period <= 0 || group.period%time.Second != 0 {
+		return "", ErrorInvalidQueryBin
+	}
+
+	switch {
+	case group.period%time.Hour == 0:
+		return "bin(" + strconv.FormatInt(int64(group.period/time.Hour), 10) + "h)", nil
+	case group.period%time.Minute == 0:
+		return "bin(" + strconv.FormatInt(int64(group.period/time.Minute), 10) + "m)", nil
+	default:
+		return "bin(" + strconv.FormatInt(int64(group.period/time.Second), 10) + "s)", nil
+	}
+}
+
+// QueryBuilder creates the query string of AWS CloudWatch Insights from its commands. All the field names and
+// values are quoted and escaped, so the values received in a request can be safely used in the filters.
+type QueryBuilder struct {
+	fields       []string
+	filters      []Predicate
+	aggregations []Aggregation
+	groups       []Group
+	sortField    string
+	sortOrder    SortOrder
+	limit        int
+}
+
+// NewQueryBuilder creates a new empty QueryBuilder.
+func NewQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{}
+}
+
+// Fields adds fields to the fields command of the query.
+func (builder *QueryBuilder) Fields(fields ...string) *QueryBuilder {
+	builder.fields = append(builder.fields, fields...)
+	return builder
+}
+
+// Filter adds predicates to the filter command of the query. The query only returns the logs that satisfy all of them.
+func (builder *QueryBuilder) Filter(predicates ...Predicate) *QueryBuilder {
+	builder.filters = append(builder.filters, predicates...)
+	return builder
+}
+
+// Stats sets the stats command of the query, which computes the aggregations of each of the groups.
+func (builder *QueryBuilder) Stats(aggregations []Aggregation, groups ...Group) *QueryBuilder {
+	builder.aggregations = aggregations
+	builder.groups = groups
+	return builder
+}
+
+// Sort sets the sort command of the query.
+func (builder *QueryBuilder) Sort(field string, order SortOrder) *QueryBuilder {
+	builder.sortField = field
+	builder.sortOrder = order
+	return builder
+}
+
+// Limit sets the limit command of the query.
+func (builder *QueryBuilder) Limit(limit int) *QueryBuilder {
+	builder.limit = limit
+	return builder
+}
+
+// Build returns the query string with one command per line. It also returns an error if any of the parts of the
+// query is not valid.
+func (builder *QueryBuilder) Build() (string, error) {
+	var commands []string
+
+	if len(builder.fields) > 0 {
+		fields := make([]string, 0, len(builder.fields))
+		for _, field := range builder.fields {
+			quoted, err := QuoteField(field)
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, quoted)
+		}
+		commands = append(commands, "fields "+strings.Join(fields, ", "))
+	}
+
+	if len(builder.filters) > 0 {
+		filters, err := renderPredicates(builder.filters)
+		if err != nil {
+			return "", err
+		}
+		commands = append(commands, "| filter "+strings.Join(filters, " and "))
+	}
+
+	if len(builder.aggregations) > 0 {
+		aggregations := make([]string, 0, len(builder.aggregations))
+		for _, aggregation := range builder.aggregations {
+			rendered, err := aggregation.render()
+			if err != nil {
+				return "", err
+			}
+			aggregations = append(aggregations, rendered)
+		}
+		stats := "| stats " + strings.Join(aggregations, ", ")
+
+		if len(builder.groups) > 0 {
+			groups := make([]string, 0, len(builder.groups))
+			for _, group := range builder.groups {
+				if group == nil {
+					return "", ErrorInvalidQueryBin
+				}
+				rendered, err := group.render()
+				if err != nil {
+					return "", err
+				}
+				groups = append(groups, rendered)
+			}
+			stats += " by " + strings.Join(groups, ", ")
+		}
+		commands = append(commands, stats)
+	}
+
+	if builder.sortField != "" {
+		field, err := QuoteField(builder.sortField)
+		if err != nil {
+			return "", err
+		}
+		order := builder.sortOrder
+		if order != Descending {
+			order = Ascending
+		}
+		commands = append(commands, "| sort "+field+" "+string(order))
+	}
+
+	if builder.limit != 0 {
+		if builder.limit < 0 || builder.limit > MaxQueryLimit {
+			return "", ErrorInvalidQueryLimit
+		}
+		commands = append(commands, "| limit "+strconv.Itoa(builder.limit))
+	}
+
+	query := strings.Join(commands, "\n")
+	return strings.TrimPrefix(query, "| "), nil
+}
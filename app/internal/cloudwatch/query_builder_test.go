@@ -0,0 +1,114 @@
+package cloudwatch_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+)
+
+var _ = Describe("QueryBuilder", func() {
+	Context("When the query has fields, filters, sort and limit", func() {
+		It("writes one command per line", func() {
+			query, err := cloudwatch.NewQueryBuilder().
+				Fields("@timestamp", "fields.ProductNumber", "fields.metadata.xml-generator-object-path").
+				Filter(cloudwatch.IsPresent("fields.key"), cloudwatch.Equals("fields.topic", "json")).
+				Sort("@timestamp", cloudwatch.Ascending).
+				Limit(100).
+				Build()
+
+			Expect(err).To(BeNil())
+			Expect(query).To(Equal("fields @timestamp, fields.ProductNumber, `fields.metadata.xml-generator-object-path`\n" +
+				"| filter ispresent(fields.key) and fields.topic = \"json\"\n" +
+				"| sort @timestamp asc\n" +
+				"| limit 100"))
+		})
+	})
+
+	Context("When the query has stats", func() {
+		It("writes the aggregations and the groups", func() {
+			query, err := cloudwatch.NewQueryBuilder().
+				Filter(cloudwatch.Or(cloudwatch.Equals("fields.topic", "a"), cloudwatch.Not(cloudwatch.NotEquals("fields.topic", "b")))).
+				Stats([]cloudwatch.Aggregation{cloudwatch.Count("events"), cloudwatch.Max("@timestamp", "last_seen")},
+					cloudwatch.ByField("fields.SerialNumber"), cloudwatch.Bin(time.Hour)).
+				Sort("events", cloudwatch.Descending).
+				Build()
+
+			Expect(err).To(BeNil())
+			Expect(query).To(Equal("filter (fields.topic = \"a\" or not (fields.topic != \"b\"))\n" +
+				"| stats count(*) as events, max(@timestamp) as last_seen by fields.SerialNumber, bin(1h)\n" +
+				"| sort events desc"))
+		})
+
+		It("writes the bins in the biggest exact unit", func() {
+			query, err := cloudwatch.NewQueryBuilder().
+				Stats([]cloudwatch.Aggregation{cloudwatch.Count("a")}, cloudwatch.Bin(90*time.Second), cloudwatch.Bin(30*time.Minute)).
+				Build()
+
+			Expect(err).To(BeNil())
+			Expect(query).To(Equal("stats count(*) as a by bin(90s), bin(30m)"))
+		})
+	})
+
+	Context("When the values are adversarial", func() {
+		adversarialValues := []struct{ value, literal string }{
+			{`X" or fields.topic != "`, `"X\" or fields.topic != \""`},
+			{`X\" | stats count(*) #`, `"X\\\" | stats count(*) #"`},
+			{"X\n| limit 1", `"X\n| limit 1"`},
+			{"A&B'C<D>", `"A&B'C<D>"`},
+			{"{{.serialNumber}}", `"{{.serialNumber}}"`},
+			{"", `""`},
+		}
+
+		for _, adversarial := range adversarialValues {
+			adversarial := adversarial
+			It("keeps "+adversarial.literal+" inside a single string literal", func() {
+				query, err := cloudwatch.NewQueryBuilder().
+					Filter(cloudwatch.Equals("fields.SerialNumber", adversarial.value)).
+					Build()
+
+				Expect(err).To(BeNil())
+				Expect(query).To(Equal("filter fields.SerialNumber = " + adversarial.literal))
+			})
+		}
+	})
+
+	Context("When the field names are adversarial", func() {
+		It("quotes the names with special characters", func() {
+			Expect(cloudwatch.QuoteField("fields.metadata.device-product-number")).To(Equal("`fields.metadata.device-product-number`"))
+			Expect(cloudwatch.QuoteField("fields.a b")).To(Equal("`fields.a b`"))
+			Expect(cloudwatch.QuoteField("@message")).To(Equal("@message"))
+		})
+
+		It("rejects the names that can't be quoted", func() {
+			for _, field := range []string{"", "fields.a` | stats count(*) by `b", "fields.a\n| limit 1"} {
+				_, err := cloudwatch.NewQueryBuilder().Fields(field).Build()
+				Expect(err).To(Equal(cloudwatch.ErrorInvalidQueryField))
+
+				_, err = cloudwatch.NewQueryBuilder().Filter(cloudwatch.Equals(field, "value")).Build()
+				Expect(err).To(Equal(cloudwatch.ErrorInvalidQueryField))
+			}
+		})
+	})
+
+	Context("When the parts of the query are not valid", func() {
+		It("returns the corresponding error", func() {
+			_, err := cloudwatch.NewQueryBuilder().Limit(cloudwatch.MaxQueryLimit + 1).Build()
+			Expect(err).To(Equal(cloudwatch.ErrorInvalidQueryLimit))
+
+			_, err = cloudwatch.NewQueryBuilder().Stats([]cloudwatch.Aggregation{cloudwatch.Count("a b")}).Build()
+			Expect(err).To(Equal(cloudwatch.ErrorInvalidQueryAlias))
+
+			_, err = cloudwatch.NewQueryBuilder().Stats([]cloudwatch.Aggregation{{Function: "count(*) as a, max", Field: "*", Alias: "b"}}).Build()
+			Expect(err).To(Equal(cloudwatch.ErrorInvalidQueryAggregation))
+
+			_, err = cloudwatch.NewQueryBuilder().Stats([]cloudwatch.Aggregation{cloudwatch.Count("a")}, cloudwatch.Bin(time.Millisecond)).Build()
+			Expect(err).To(Equal(cloudwatch.ErrorInvalidQueryBin))
+
+			_, err = cloudwatch.NewQueryBuilder().Filter(cloudwatch.And()).Build()
+			Expect(err).To(Equal(cloudwatch.ErrorInvalidQueryPredicate))
+		})
+	})
+})
@@ -3,10 +3,22 @@
 package cloudwatch
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+const (
+	// stopQueryTimeout is the maximum time spent trying to stop a query whose context has been cancelled.
+	stopQueryTimeout = 5 * time.Second
+
+	// queryStatusTimeout is the status of a query that timed out in AWS CloudWatch Insights
+	// (not defined in cloudwatchlogs package).
+	queryStatusTimeout = "Timeout"
 )
 
 // InsightsQueryParams are the parameters needed by QueryExecutor to execute the corresponding query
@@ -19,23 +31,31 @@ type InsightsQueryParams struct {
 // The query itself is inside 'insightsQueryParams'.
 // It returns the result of the query and an error, if any.
 type QueryExecutor interface {
-	ExecuteQuery(insightsQueryParams InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error)
+	ExecuteQuery(ctx context.Context, insightsQueryParams InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error)
 }
 
 // QueryExecutorImpl is the default implementation of the interface QueryExecutor. It obtains the results
 // using AWS CloudWatch Insights service client (svc variable) (https://docs.aws.amazon.com/sdk-for-go/api/service/cloudwatch/)
 type QueryExecutorImpl struct {
-	svc *cloudwatchlogs.CloudWatchLogs
+	svc     cloudwatchlogsiface.CloudWatchLogsAPI
+	polling PollingStrategy
 }
 
-// NewQueryExecutorImpl creates a new QueryExecutorImpl.
-func NewQueryExecutorImpl(svc *cloudwatchlogs.CloudWatchLogs) QueryExecutor {
-	return QueryExecutorImpl{svc}
+// NewQueryExecutorImpl creates a new QueryExecutorImpl that polls the results following polling.
+func NewQueryExecutorImpl(svc cloudwatchlogsiface.CloudWatchLogsAPI, polling PollingStrategy) QueryExecutor {
+	return QueryExecutorImpl{svc, polling}
 }
 
 // ExecuteQuery is a  method of QueryExecutorImpl that executes a query using its cloudwatchlogs service client based on insightsQueryParams.
-// It also returns an error, if any.
-func (queryExecutor QueryExecutorImpl) ExecuteQuery(insightsQueryParams InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+// The query is stopped if ctx is cancelled or the timeout of the polling strategy expires. It also returns an error, if any.
+func (queryExecutor QueryExecutorImpl) ExecuteQuery(ctx context.Context, insightsQueryParams InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	queryCtx := ctx
+	if queryExecutor.polling.Timeout > 0 {
+		var cancel context.CancelFunc
+		queryCtx, cancel = context.WithTimeout(ctx, queryExecutor.polling.Timeout)
+		defer cancel()
+	}
+
 	startQueryInput := &cloudwatchlogs.StartQueryInput{
 		StartTime:    aws.Int64(insightsQueryParams.StartTimeEpoch),
 		EndTime:      aws.Int64(insightsQueryParams.EndTimeEpoch),
@@ -43,24 +63,72 @@ func (queryExecutor QueryExecutorImpl) ExecuteQuery(insightsQueryParams Insights
 		QueryString:  aws.String(insightsQueryParams.Query),
 	}
 
-	startQueryOutput, err := queryExecutor.svc.StartQuery(startQueryInput)
+	startQueryOutput, err := queryExecutor.svc.StartQueryWithContext(queryCtx, startQueryInput)
 	if err != nil {
+		if queryCtx.Err() != nil {
+			return nil, abandonedQueryError(ctx)
+		}
 		return nil, err
 	}
 
 	queryResultsInput := &cloudwatchlogs.GetQueryResultsInput{
 		QueryId: startQueryOutput.QueryId,
 	}
-	queryResultsOutput, err := queryExecutor.svc.GetQueryResults(queryResultsInput)
-	if err != nil {
-		return nil, err
-	}
-	for *queryResultsOutput.Status == cloudwatchlogs.QueryStatusRunning || *queryResultsOutput.Status == cloudwatchlogs.QueryStatusScheduled {
-		fmt.Println("INFO: Waiting query to finish")
-		queryResultsOutput, err = queryExecutor.svc.GetQueryResults(queryResultsInput)
+
+	delay := queryExecutor.polling.FirstDelay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-queryCtx.Done():
+			queryExecutor.stopQuery(startQueryOutput.QueryId)
+			return nil, abandonedQueryError(ctx)
+		case <-timer.C:
+		}
+
+		queryResultsOutput, err := queryExecutor.svc.GetQueryResultsWithContext(queryCtx, queryResultsInput)
 		if err != nil {
+			if queryCtx.Err() != nil {
+				queryExecutor.stopQuery(startQueryOutput.QueryId)
+				return nil, abandonedQueryError(ctx)
+			}
 			return nil, err
 		}
+
+		switch aws.StringValue(queryResultsOutput.Status) {
+		case cloudwatchlogs.QueryStatusComplete:
+			return queryResultsOutput, nil
+		case cloudwatchlogs.QueryStatusFailed:
+			return nil, ErrorQueryFailed
+		case cloudwatchlogs.QueryStatusCancelled:
+			return nil, ErrorQueryCancelled
+		case queryStatusTimeout:
+			return nil, ErrorQueryTimeout
+		}
+
+		delay = queryExecutor.polling.NextDelay(delay)
+		timer.Reset(delay)
+	}
+}
+
+// abandonedQueryError returns the error of a query abandoned before finishing. When the caller's ctx is done,
+// its error is returned. Otherwise, the query was abandoned because of the timeout of the polling strategy.
+func abandonedQueryError(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return ErrorQueryTimeout
+}
+
+// stopQuery stops the query with id queryId. As it is called when the context of the query has been cancelled,
+// it uses its own context. Errors are only logged because the caller is already returning an error.
+func (queryExecutor QueryExecutorImpl) stopQuery(queryId *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), stopQueryTimeout)
+	defer cancel()
+
+	_, err := queryExecutor.svc.StopQueryWithContext(ctx, &cloudwatchlogs.StopQueryInput{QueryId: queryId})
+	if err != nil {
+		fmt.Println("ERROR: could not stop query", aws.StringValue(queryId), err)
 	}
-	return queryResultsOutput, nil
 }
@@ -0,0 +1,201 @@
+package cloudwatch_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+)
+
+const queryId = "queryId"
+
+// fakeInsightsClient is a CloudWatchLogsAPI that returns the statuses in order on every call to GetQueryResults.
+type fakeInsightsClient struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	statuses       []string
+	getResultsErr  error
+	onGetResults   func()
+	getResultCalls int
+	stoppedQueries []string
+}
+
+func (client *fakeInsightsClient) StartQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StartQueryInput, opts ...request.Option) (*cloudwatchlogs.StartQueryOutput, error) {
+	return &cloudwatchlogs.StartQueryOutput{QueryId: aws.String(queryId)}, nil
+}
+
+func (client *fakeInsightsClient) GetQueryResultsWithContext(ctx aws.Context, input *cloudwatchlogs.GetQueryResultsInput, opts ...request.Option) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	if client.onGetResults != nil {
+		client.onGetResults()
+	}
+	if client.getResultsErr != nil {
+		return nil, client.getResultsErr
+	}
+
+	status := client.statuses[len(client.statuses)-1]
+	if client.getResultCalls < len(client.statuses) {
+		status = client.statuses[client.getResultCalls]
+	}
+	client.getResultCalls++
+	return &cloudwatchlogs.GetQueryResultsOutput{Status: aws.String(status)}, nil
+}
+
+func (client *fakeInsightsClient) StopQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StopQueryInput, opts ...request.Option) (*cloudwatchlogs.StopQueryOutput, error) {
+	client.stoppedQueries = append(client.stoppedQueries, aws.StringValue(input.QueryId))
+	return &cloudwatchlogs.StopQueryOutput{Success: aws.Bool(true)}, nil
+}
+
+var _ = Describe("QueryExecutorImpl", func() {
+	var client *fakeInsightsClient
+	var params cloudwatch.InsightsQueryParams
+	var polling cloudwatch.PollingStrategy
+
+	BeforeEach(func() {
+		client = &fakeInsightsClient{}
+		polling = cloudwatch.PollingStrategy{
+			InitialDelay:  time.Millisecond,
+			BackoffFactor: 2,
+			MaxDelay:      4 * time.Millisecond,
+			Timeout:       time.Second,
+		}
+		params = cloudwatch.InsightsQueryParams{
+			StartTimeEpoch: 1600248300,
+			EndTimeEpoch:   1600251900,
+			LogGroupName:   "/aws/lambda/AWSUpload",
+			Query:          "fields @timestamp",
+		}
+	})
+
+	Context("When the query finishes", func() {
+		It("waits while the query is running and returns the results", func() {
+			client.statuses = []string{cloudwatchlogs.QueryStatusScheduled, cloudwatchlogs.QueryStatusRunning, cloudwatchlogs.QueryStatusComplete}
+
+			result, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(context.Background(), params)
+
+			Expect(err).To(BeNil())
+			Expect(aws.StringValue(result.Status)).To(Equal(cloudwatchlogs.QueryStatusComplete))
+			Expect(client.getResultCalls).To(Equal(3))
+			Expect(client.stoppedQueries).To(BeEmpty())
+		})
+	})
+
+	Context("When the context is cancelled while the query is running", func() {
+		It("stops the query and returns the error of the context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			client.statuses = []string{cloudwatchlogs.QueryStatusRunning}
+			client.onGetResults = cancel
+
+			result, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(ctx, params)
+
+			Expect(err).To(Equal(context.Canceled))
+			Expect(result).To(BeNil())
+			Expect(client.stoppedQueries).To(Equal([]string{queryId}))
+		})
+	})
+
+	Context("When getting the results fails because the context is cancelled", func() {
+		It("stops the query and returns the error of the context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			client.onGetResults = cancel
+			client.getResultsErr = errors.New("request canceled")
+
+			_, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(ctx, params)
+
+			Expect(err).To(Equal(context.Canceled))
+			Expect(client.stoppedQueries).To(Equal([]string{queryId}))
+		})
+	})
+
+	Context("When the query does not complete", func() {
+		It("returns query failed error if the query failed", func() {
+			client.statuses = []string{cloudwatchlogs.QueryStatusRunning, cloudwatchlogs.QueryStatusFailed}
+
+			result, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(context.Background(), params)
+
+			Expect(err).To(Equal(cloudwatch.ErrorQueryFailed))
+			Expect(result).To(BeNil())
+		})
+
+		It("returns query cancelled error if the query was cancelled", func() {
+			client.statuses = []string{cloudwatchlogs.QueryStatusCancelled}
+
+			_, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(context.Background(), params)
+
+			Expect(err).To(Equal(cloudwatch.ErrorQueryCancelled))
+		})
+
+		It("returns query timeout error if the query timed out in CloudWatch", func() {
+			client.statuses = []string{"Timeout"}
+
+			_, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(context.Background(), params)
+
+			Expect(err).To(Equal(cloudwatch.ErrorQueryTimeout))
+		})
+	})
+
+	Context("When the query runs for longer than the timeout", func() {
+		It("stops the query and returns query timeout error", func() {
+			client.statuses = []string{cloudwatchlogs.QueryStatusRunning}
+			polling.Timeout = 20 * time.Millisecond
+
+			_, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(context.Background(), params)
+
+			Expect(err).To(Equal(cloudwatch.ErrorQueryTimeout))
+			Expect(client.stoppedQueries).To(Equal([]string{queryId}))
+		})
+	})
+
+	Context("When getting the results fails", func() {
+		It("returns the error", func() {
+			client.getResultsErr = errors.New("throttling")
+
+			_, err := cloudwatch.NewQueryExecutorImpl(client, polling).ExecuteQuery(context.Background(), params)
+
+			Expect(err).To(Equal(client.getResultsErr))
+			Expect(client.stoppedQueries).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("PollingStrategy", func() {
+	It("increases the delay exponentially up to the max delay", func() {
+		polling := cloudwatch.PollingStrategy{
+			InitialDelay:  100 * time.Millisecond,
+			BackoffFactor: 2,
+			MaxDelay:      time.Second,
+		}
+
+		var delays []time.Duration
+		delay := polling.InitialDelay
+		for i := 0; i < 5; i++ {
+			delay = polling.NextDelay(delay)
+			delays = append(delays, delay)
+		}
+
+		Expect(delays).To(Equal([]time.Duration{
+			200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second,
+		}))
+	})
+
+	It("never decreases the delay", func() {
+		polling := cloudwatch.PollingStrategy{BackoffFactor: 0.5}
+
+		Expect(polling.NextDelay(time.Second)).To(Equal(time.Second))
+	})
+
+	It("never waits less than the minimum delay", func() {
+		polling := cloudwatch.PollingStrategy{BackoffFactor: 2, MaxDelay: time.Millisecond}
+
+		Expect(polling.FirstDelay()).To(Equal(cloudwatch.MinPollingDelay))
+		Expect(polling.NextDelay(0)).To(Equal(cloudwatch.MinPollingDelay))
+		Expect(polling.NextDelay(polling.FirstDelay())).To(Equal(cloudwatch.MinPollingDelay))
+	})
+})
@@ -2,10 +2,13 @@
 package configs
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -16,9 +19,58 @@ const (
 	Development             = "DEVELOPMENT"
 	AwsMainRegion           = "AWS_MAIN_REGION"
 	AwsBlackseaBucketRegion = "AWS_BLACKSEA_BUCKET_REGION"
+	EnvS3Regions            = "S3_REGIONS"
+	EnvS3AccessPolicy       = "S3_ACCESS_POLICY"
 	DefaultTimeDiffMinutes  = 60
 	MaxTimeDiffMinutes      = 2880
 
+	EnvQueryPollInitialDelayMillis = "QUERY_POLL_INITIAL_DELAY_MS"
+	EnvQueryPollBackoffFactor      = "QUERY_POLL_BACKOFF_FACTOR"
+	EnvQueryPollMaxDelayMillis     = "QUERY_POLL_MAX_DELAY_MS"
+	EnvQueryTimeoutSeconds         = "QUERY_TIMEOUT_SECONDS"
+	DefaultQueryPollInitialDelay   = 250 * time.Millisecond
+	DefaultQueryPollBackoffFactor  = 2.0
+	DefaultQueryPollMaxDelay       = 5 * time.Second
+	DefaultQueryTimeout            = 5 * time.Minute
+
+	EnvMaxChunkedTimeDiffMinutes  = "MAX_CHUNKED_TIME_DIFF_IN_MINUTES"
+	EnvChunksConcurrency          = "CHUNKS_CONCURRENCY"
+	EnvScanBudgetBytes            = "SCAN_BUDGET_BYTES"
+	DefaultChunkedTimeDiffMinutes = 10080
+	MaxChunkedTimeDiffMinutes     = 43200
+	DefaultChunksConcurrency      = 4
+	DefaultScanBudgetBytes        = 10 * 1024 * 1024 * 1024
+
+	EnvQueryCacheBackend          = "QUERY_CACHE_BACKEND"
+	EnvQueryCacheSize             = "QUERY_CACHE_SIZE"
+	EnvQueryCacheMaxBytes         = "QUERY_CACHE_MAX_BYTES"
+	EnvQueryCacheTTLHours         = "QUERY_CACHE_TTL_HOURS"
+	EnvQueryCacheSettleMinutes    = "QUERY_CACHE_SETTLE_MINUTES"
+	QueryCacheBackendNone         = "none"
+	QueryCacheBackendMemory       = "memory"
+	QueryCacheBackendDynamo       = "dynamo"
+	DefaultQueryCacheSize         = 512
+	DefaultQueryCacheMaxBytes     = 64 * 1024 * 1024
+	DefaultQueryCacheTTL          = 24 * time.Hour
+	DefaultQueryCacheSettleMargin = 10 * time.Minute
+
+	EnvEventDefinitionsFile = "EVENT_DEFINITIONS_FILE"
+
+	EnvFleetBinMinutes = "FLEET_BIN_MINUTES"
+	DefaultFleetBin    = 15 * time.Minute
+
+	EnvHeartbeatIntervalSeconds = "HEARTBEAT_INTERVAL_SECONDS"
+	DefaultHeartbeatInterval    = 5 * time.Minute
+
+	EnvStorageLambdaMaxBytes     = "STORAGE_LAMBDA_MAX_BYTES"
+	EnvStoragePresignTTLSeconds  = "STORAGE_PRESIGN_TTL_SECONDS"
+	EnvStorageRenderMaxBytes     = "STORAGE_RENDER_MAX_BYTES"
+	DefaultStorageLambdaMaxBytes = 4 * 1024 * 1024
+	DefaultStoragePresignTTL     = 15 * time.Minute
+	MinStoragePresignTTL         = time.Second
+	MaxStoragePresignTTL         = 7 * 24 * time.Hour
+	DefaultStorageRenderMaxBytes = 16 * 1024 * 1024
+
 	InfraStructurePath = "/cc/V01/api/"
 	CloudJsonPath      = InfraStructurePath + "cloud-json"
 	OpenXMLPath        = InfraStructurePath + "open-xml"
@@ -26,6 +78,15 @@ const (
 	RTAPath            = InfraStructurePath + "rta"
 	StorageObjectPath  = InfraStructurePath + "object"
 	SubscriptionsPath  = InfraStructurePath + "subscriptions"
+	TimelinePath       = InfraStructurePath + "timeline"
+	FleetPath          = InfraStructurePath + "fleet"
+
+	HeartbeatAnalysisPath = InfraStructurePath + "heartbeat-analysis"
+	PipelinePath          = InfraStructurePath + "pipeline"
+
+	SubscriptionsByAccountPath = SubscriptionsPath + "/account"
+	SubscriptionsByServicePath = SubscriptionsPath + "/service"
+	SubscriptionsHistoryPath   = SubscriptionsPath + "/history"
 
 	ProductNumberQueryParam = "pn"
 	SerialNumberQueryParam  = "sn"
@@ -34,16 +95,146 @@ const (
 	OffsetValueQueryParam   = "offset_value"
 	StartTimeQueryParam     = "start_time"
 	EndTimeQueryParam       = "end_time"
+	DurationQueryParam      = "duration"
+	AnchorTimeQueryParam    = "anchor_time"
+	BeforeQueryParam        = "before"
+	AfterQueryParam         = "after"
+	CursorQueryParam        = "cursor"
+	ChunkedQueryParam       = "chunked"
+	IntervalQueryParam      = "interval"
+	IncludeQueryParam       = "include"
 
 	BucketRegionQueryParam = "bucket_region"
 	BucketNameQueryParam   = "bucket_name"
 	ObjectKeyQueryParam    = "object_key"
+	ObjectModeQueryParam   = "mode"
+	ObjectFormatQueryParam = "format"
+
+	AccountIDQueryParam  = "account_id"
+	ServiceQueryParam    = "service"
+	LimitQueryParam      = "limit"
+	PageTokenQueryParam  = "page_token"
+	ConsistentQueryParam = "consistent"
 )
 
 var (
 	maxTimeDiffInMinutes int
+
+	queryPollInitialDelay  time.Duration
+	queryPollBackoffFactor float64
+	queryPollMaxDelay      time.Duration
+	queryTimeout           time.Duration
+
+	maxChunkedTimeDiffInMinutes int
+	chunksConcurrency           int
+	scanBudgetBytes             int64
+
+	queryCacheBackend      string
+	queryCacheSize         int
+	queryCacheMaxBytes     int64
+	queryCacheTTL          time.Duration
+	queryCacheSettleMargin time.Duration
+
+	eventDefinitionsFile string
+
+	fleetBin time.Duration
+
+	heartbeatInterval time.Duration
+
+	s3Regions         []string
+	s3AccessPolicy    map[string]map[string][]string
+	s3AccessPolicyErr error
+
+	storageLambdaMaxBytes int64
+	storagePresignTTL     time.Duration
+	storagePresignTTLErr  error
+	storageRenderMaxBytes int64
 )
 
+// BuiltInPaths are the paths of the endpoints that are not event types, so no event type can use them.
+var BuiltInPaths = []string{
+	StorageObjectPath,
+	SubscriptionsPath,
+	TimelinePath,
+	FleetPath,
+	HeartbeatAnalysisPath,
+	PipelinePath,
+}
+
+// EventPath returns the path of the endpoint of the event type called name.
+func EventPath(name string) string {
+	return InfraStructurePath + name
+}
+
+// GetEventDefinitionsFile returns the path of the JSON file with the definitions of the event types, or an empty
+// string if the default definitions have to be used.
+func GetEventDefinitionsFile() string {
+	return eventDefinitionsFile
+}
+
+// GetFleetBin returns the length of the intervals used to detect the gaps in the activity of the printers of a fleet.
+func GetFleetBin() time.Duration {
+	return fleetBin
+}
+
+// GetHeartbeatInterval returns the time expected between two heartbeats of a printer when the request does not specify it.
+func GetHeartbeatInterval() time.Duration {
+	return heartbeatInterval
+}
+
+// GetS3Regions returns the AWS regions whose buckets can be read by the object endpoint, written as they are
+// configured (us-east-1 or US_EAST_1). By default, they are the main region and the region of the blacksea bucket.
+func GetS3Regions() []string {
+	return s3Regions
+}
+
+// GetS3AccessPolicy returns the key prefixes allowed in each bucket of each region by the object endpoint.
+// It is nil when it is not configured, and then no object is allowed.
+func GetS3AccessPolicy() map[string]map[string][]string {
+	return s3AccessPolicy
+}
+
+// GetStorageLambdaMaxBytes returns the maximum size of the objects returned directly by the Lambda. Bigger objects
+// are returned as a redirection to a pre-signed URL, because the Lambda responses are limited.
+func GetStorageLambdaMaxBytes() int64 {
+	return storageLambdaMaxBytes
+}
+
+// GetStoragePresignTTL returns how long the pre-signed URLs of the objects are valid.
+func GetStoragePresignTTL() time.Duration {
+	return storagePresignTTL
+}
+
+// Validate returns an error if a configuration can't be used, so the startup fails instead of the requests.
+func Validate() error {
+	if s3AccessPolicyErr != nil {
+		return s3AccessPolicyErr
+	}
+	return storagePresignTTLErr
+}
+
+// setStoragePresignTTL returns the ttl of STORAGE_PRESIGN_TTL_SECONDS, or an error if it is not a number of seconds
+// between MinStoragePresignTTL and MaxStoragePresignTTL (the limits of S3).
+func setStoragePresignTTL() (time.Duration, error) {
+	stringTTL, ok := os.LookupEnv(EnvStoragePresignTTLSeconds)
+	if !ok {
+		return DefaultStoragePresignTTL, nil
+	}
+
+	seconds, err := strconv.Atoi(stringTTL)
+	ttl := time.Duration(seconds) * time.Second
+	if err != nil || ttl < MinStoragePresignTTL || ttl > MaxStoragePresignTTL {
+		return DefaultStoragePresignTTL, fmt.Errorf("%w: %s=%q", ErrorInvalidStoragePresignTTL, EnvStoragePresignTTLSeconds, stringTTL)
+	}
+	return ttl, nil
+}
+
+// GetStorageRenderMaxBytes returns the maximum size of the objects (once decompressed) that are read whole
+// to be rendered: pretty printed, converted or extracted from zip archives.
+func GetStorageRenderMaxBytes() int64 {
+	return storageRenderMaxBytes
+}
+
 // GetMaxTimeDiffInMinutes returns the maximum amount of time difference (in minutes)
 // between start_time and end_time allowed in a query.
 func GetMaxTimeDiffInMinutes() int {
@@ -69,9 +260,229 @@ func setMaxTimeDiffInMinutes() int {
 	return intDiff
 }
 
+// GetMaxChunkedTimeDiffInMinutes returns the maximum amount of time difference (in minutes)
+// between start_time and end_time allowed in a chunked query. It is never smaller than GetMaxTimeDiffInMinutes.
+func GetMaxChunkedTimeDiffInMinutes() int {
+	return maxChunkedTimeDiffInMinutes
+}
+
+// GetChunksConcurrency returns the maximum number of chunks of a chunked query executed at the same time.
+func GetChunksConcurrency() int {
+	return chunksConcurrency
+}
+
+// GetScanBudgetBytes returns the maximum amount of bytes that the queries of a single request are allowed to scan.
+func GetScanBudgetBytes() int64 {
+	return scanBudgetBytes
+}
+
+func setMaxChunkedTimeDiffInMinutes() int {
+	diff, ok := lookupPositiveInt(EnvMaxChunkedTimeDiffMinutes)
+	if !ok {
+		diff = DefaultChunkedTimeDiffMinutes
+	}
+
+	if diff > MaxChunkedTimeDiffMinutes {
+		diff = MaxChunkedTimeDiffMinutes
+	}
+	if diff < maxTimeDiffInMinutes {
+		diff = maxTimeDiffInMinutes
+	}
+	return diff
+}
+
+func setChunksConcurrency() int {
+	concurrency, ok := lookupPositiveInt(EnvChunksConcurrency)
+	if !ok {
+		return DefaultChunksConcurrency
+	}
+	return concurrency
+}
+
+func setScanBudgetBytes() int64 {
+	stringBudget, ok := os.LookupEnv(EnvScanBudgetBytes)
+	if !ok {
+		return DefaultScanBudgetBytes
+	}
+
+	budget, err := strconv.ParseInt(stringBudget, 10, 64)
+	if err != nil || budget <= 0 {
+		return DefaultScanBudgetBytes
+	}
+	return budget
+}
+
+func setS3Regions() []string {
+	stringRegions, ok := os.LookupEnv(EnvS3Regions)
+	if !ok {
+		stringRegions = os.Getenv(AwsMainRegion) + "," + os.Getenv(AwsBlackseaBucketRegion)
+	}
+
+	var regions []string
+	for _, region := range strings.Split(stringRegions, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+func setS3AccessPolicy() (map[string]map[string][]string, error) {
+	stringPolicy, ok := os.LookupEnv(EnvS3AccessPolicy)
+	if !ok || strings.TrimSpace(stringPolicy) == "" {
+		return nil, nil
+	}
+
+	var policy map[string]map[string][]string
+	if err := json.Unmarshal([]byte(stringPolicy), &policy); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidS3AccessPolicy, err)
+	}
+	return policy, nil
+}
+
+// GetQueryCacheBackend returns where the results of the queries are cached: QueryCacheBackendNone,
+// QueryCacheBackendMemory or QueryCacheBackendDynamo.
+func GetQueryCacheBackend() string {
+	return queryCacheBackend
+}
+
+// GetQueryCacheSize returns the maximum number of query results kept by the memory cache.
+func GetQueryCacheSize() int {
+	return queryCacheSize
+}
+
+// GetQueryCacheMaxBytes returns the maximum number of bytes of the query results kept by the memory cache.
+func GetQueryCacheMaxBytes() int64 {
+	return queryCacheMaxBytes
+}
+
+// GetQueryCacheTTL returns the time the query results are kept by the dynamo cache.
+func GetQueryCacheTTL() time.Duration {
+	return queryCacheTTL
+}
+
+// GetQueryCacheSettleMargin returns how long ago a time range has to end for the results of its queries to be cached.
+func GetQueryCacheSettleMargin() time.Duration {
+	return queryCacheSettleMargin
+}
+
+func setQueryCacheBackend() string {
+	backend := strings.ToLower(os.Getenv(EnvQueryCacheBackend))
+	switch backend {
+	case QueryCacheBackendNone, QueryCacheBackendMemory, QueryCacheBackendDynamo:
+		return backend
+	default:
+		return QueryCacheBackendMemory
+	}
+}
+
+func setQueryCacheSize() int {
+	size, ok := lookupPositiveInt(EnvQueryCacheSize)
+	if !ok {
+		return DefaultQueryCacheSize
+	}
+	return size
+}
+
+// GetQueryPollInitialDelay returns the time to wait before asking for the results of a query the first time.
+func GetQueryPollInitialDelay() time.Duration {
+	return queryPollInitialDelay
+}
+
+// GetQueryPollBackoffFactor returns the factor that multiplies the delay between two requests of the results
+// of a query that is still running.
+func GetQueryPollBackoffFactor() float64 {
+	return queryPollBackoffFactor
+}
+
+// GetQueryPollMaxDelay returns the maximum time to wait between two requests of the results of a query.
+func GetQueryPollMaxDelay() time.Duration {
+	return queryPollMaxDelay
+}
+
+// GetQueryTimeout returns the maximum time a query is allowed to run.
+func GetQueryTimeout() time.Duration {
+	return queryTimeout
+}
+
+// lookupPositiveInt returns the value of the environment variable envVar if it is a positive integer.
+// Otherwise it returns ok as false.
+func lookupPositiveInt(envVar string) (value int, ok bool) {
+	stringValue, ok := os.LookupEnv(envVar)
+	if !ok {
+		return 0, false
+	}
+
+	value, err := strconv.Atoi(stringValue)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	return value, true
+}
+
+// lookupDuration returns the duration in the environment variable envVar, expressed in units, or defaultValue
+// if it is not set or it is not a positive integer.
+func lookupDuration(envVar string, units time.Duration, defaultValue time.Duration) time.Duration {
+	value, ok := lookupPositiveInt(envVar)
+	if !ok {
+		return defaultValue
+	}
+	return time.Duration(value) * units
+}
+
+// lookupBytes returns the amount of bytes in the environment variable envVar, or defaultValue if it is not set
+// or it is not a positive integer.
+func lookupBytes(envVar string, defaultValue int64) int64 {
+	value, ok := lookupPositiveInt(envVar)
+	if !ok {
+		return defaultValue
+	}
+	return int64(value)
+}
+
+func setQueryPollBackoffFactor() float64 {
+	stringFactor, ok := os.LookupEnv(EnvQueryPollBackoffFactor)
+	if !ok {
+		return DefaultQueryPollBackoffFactor
+	}
+
+	factor, err := strconv.ParseFloat(stringFactor, 64)
+	if err != nil || factor < 1 {
+		return DefaultQueryPollBackoffFactor
+	}
+	return factor
+}
+
 // Init initialises some global variables of configuration.
 func Init() {
 	maxTimeDiffInMinutes = setMaxTimeDiffInMinutes()
+
+	queryPollInitialDelay = lookupDuration(EnvQueryPollInitialDelayMillis, time.Millisecond, DefaultQueryPollInitialDelay)
+	queryPollBackoffFactor = setQueryPollBackoffFactor()
+	queryPollMaxDelay = lookupDuration(EnvQueryPollMaxDelayMillis, time.Millisecond, DefaultQueryPollMaxDelay)
+	queryTimeout = lookupDuration(EnvQueryTimeoutSeconds, time.Second, DefaultQueryTimeout)
+
+	maxChunkedTimeDiffInMinutes = setMaxChunkedTimeDiffInMinutes()
+	chunksConcurrency = setChunksConcurrency()
+	scanBudgetBytes = setScanBudgetBytes()
+
+	queryCacheBackend = setQueryCacheBackend()
+	queryCacheSize = setQueryCacheSize()
+	queryCacheMaxBytes = lookupBytes(EnvQueryCacheMaxBytes, DefaultQueryCacheMaxBytes)
+	queryCacheTTL = lookupDuration(EnvQueryCacheTTLHours, time.Hour, DefaultQueryCacheTTL)
+	queryCacheSettleMargin = lookupDuration(EnvQueryCacheSettleMinutes, time.Minute, DefaultQueryCacheSettleMargin)
+
+	eventDefinitionsFile = os.Getenv(EnvEventDefinitionsFile)
+
+	fleetBin = lookupDuration(EnvFleetBinMinutes, time.Minute, DefaultFleetBin)
+	heartbeatInterval = lookupDuration(EnvHeartbeatIntervalSeconds, time.Second, DefaultHeartbeatInterval)
+
+	s3Regions = setS3Regions()
+	s3AccessPolicy, s3AccessPolicyErr = setS3AccessPolicy()
+
+	storageLambdaMaxBytes = lookupBytes(EnvStorageLambdaMaxBytes, DefaultStorageLambdaMaxBytes)
+	storageRenderMaxBytes = lookupBytes(EnvStorageRenderMaxBytes, DefaultStorageRenderMaxBytes)
+	storagePresignTTL, storagePresignTTLErr = setStoragePresignTTL()
 }
 
 // IsDevelopment returns true if we are in development mode based in environment variables.
@@ -85,33 +496,15 @@ func IsDevelopment() bool {
 	return false
 }
 
-// CreateAWSSession creates the corresponding sessions based on environment variables.
-// It also returns an error, if any.
-func CreateAWSSession() (sess1 *session.Session, sess2 *session.Session, err error) {
-
-	awsRegion1, ok := os.LookupEnv(AwsMainRegion)
-	if !ok {
-		return nil, nil, errors.New("could not load " + AwsMainRegion + " environment variable")
-	}
-
-	sess1, err = session.NewSession(&aws.Config{
-		Region: aws.String(awsRegion1)},
-	)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	awsRegion2, ok := os.LookupEnv(AwsBlackseaBucketRegion)
+// CreateAWSSession creates the session of the main region based on environment variables.
+// The S3 clients of the other regions are created from it.
+func CreateAWSSession() (*session.Session, error) {
+	awsRegion, ok := os.LookupEnv(AwsMainRegion)
 	if !ok {
-		return nil, nil, errors.New("could not load " + AwsMainRegion + " environment variable")
+		return nil, errors.New("could not load " + AwsMainRegion + " environment variable")
 	}
 
-	sess2, err = session.NewSession(&aws.Config{
-		Region: aws.String(awsRegion2)},
+	return session.NewSession(&aws.Config{
+		Region: aws.String(awsRegion)},
 	)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return sess1, sess2, nil
 }
@@ -0,0 +1,62 @@
+package configs_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+var _ = Describe("Configs", func() {
+
+	Context("Validate", func() {
+
+		AfterEach(func() {
+			Expect(os.Unsetenv(configs.EnvStoragePresignTTLSeconds)).To(Succeed())
+			Expect(os.Unsetenv(configs.EnvS3AccessPolicy)).To(Succeed())
+			configs.Init()
+		})
+
+		It("should use the default presign ttl when it is not set", func() {
+			Expect(os.Unsetenv(configs.EnvStoragePresignTTLSeconds)).To(Succeed())
+			configs.Init()
+
+			Expect(configs.Validate()).To(Succeed())
+			Expect(configs.GetStoragePresignTTL()).To(Equal(configs.DefaultStoragePresignTTL))
+		})
+
+		It("should accept the presign ttls between 1 second and 7 days", func() {
+			for _, seconds := range []string{"1", "3600", "604800"} {
+				Expect(os.Setenv(configs.EnvStoragePresignTTLSeconds, seconds)).To(Succeed())
+				configs.Init()
+
+				Expect(configs.Validate()).To(Succeed())
+			}
+			Expect(configs.GetStoragePresignTTL()).To(Equal(7 * 24 * time.Hour))
+		})
+
+		It("should fail with the presign ttls out of range or malformed", func() {
+			for _, seconds := range []string{"0", "-5", "604801", "15m"} {
+				Expect(os.Setenv(configs.EnvStoragePresignTTLSeconds, seconds)).To(Succeed())
+				configs.Init()
+
+				err := configs.Validate()
+				Expect(errors.Is(err, configs.ErrorInvalidStoragePresignTTL)).To(BeTrue(), seconds)
+			}
+		})
+
+		It("should fail with an access policy that is not JSON", func() {
+			Expect(os.Setenv(configs.EnvS3AccessPolicy, `us-east-1=bucketName`)).To(Succeed())
+			configs.Init()
+
+			Expect(errors.Is(configs.Validate(), configs.ErrorInvalidS3AccessPolicy)).To(BeTrue())
+			Expect(configs.GetS3AccessPolicy()).To(BeNil())
+		})
+
+	})
+
+})
@@ -0,0 +1,10 @@
+package configs
+
+import (
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/errorTypes"
+)
+
+const (
+	ErrorInvalidStoragePresignTTL = ConstError("storage presign ttl out of the range of 1 second to 7 days error")
+	ErrorInvalidS3AccessPolicy    = ConstError("storage access policy is not valid JSON error")
+)
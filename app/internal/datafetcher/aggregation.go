@@ -0,0 +1,340 @@
+package datafetcher
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+// Names of the results of the stats queries of the AggregationFetcher.
+const (
+	eventsAlias   = "events"
+	lastSeenAlias = "last_seen"
+	binPrefix     = "bin("
+)
+
+// Gap is an interval of the time range without any event of a printer.
+type Gap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// SerialSummary is the activity of a printer during the time range of a FleetSummary: the number of events of each
+// event type, the time of its last event and the intervals without events (measured in bins).
+type SerialSummary struct {
+	SerialNumber string         `json:"serial_number"`
+	Counts       map[string]int `json:"counts"`
+	LastSeen     time.Time      `json:"last_seen"`
+	Gaps         []Gap          `json:"gaps"`
+}
+
+// FleetSummary is the activity of the printers of a product number that have at least one event in a time range.
+// Truncated is true when some counts are lower than the real ones because of the limit of results of a query.
+type FleetSummary struct {
+	ProductNumber string            `json:"product_number"`
+	StartTime     time.Time         `json:"start_time"`
+	EndTime       time.Time         `json:"end_time"`
+	BinSeconds    int64             `json:"bin_seconds"`
+	Serials       []SerialSummary   `json:"serials"`
+	Errors        map[string]string `json:"errors,omitempty"`
+	Truncated     bool              `json:"truncated,omitempty"`
+}
+
+// serialBin is the number of events of an event type of a printer in a bin.
+type serialBin struct {
+	serialNumber string
+	bin          int64
+	events       int
+	lastSeen     time.Time
+}
+
+// AggregationFetcher is the implementation of FleetFetcher that uses a queryExecutor to perform a stats query
+// (by serial number and bin) for each of the event definitions.
+type AggregationFetcher struct {
+	definitions   []EventDefinition
+	queryExecutor cloudwatch.QueryExecutor
+	bin           time.Duration
+}
+
+// NewAggregationFetcher creates a new AggregationFetcher of the events described by definitions that detects the
+// gaps of the printers in bins of length bin (a whole number of seconds).
+func NewAggregationFetcher(definitions []EventDefinition, queryExecutor cloudwatch.QueryExecutor, bin time.Duration) AggregationFetcher {
+	return AggregationFetcher{definitions, queryExecutor, bin}
+}
+
+// CreateStatsQuery returns the query that counts the events of definition of each printer of productNumber in each bin.
+// It also returns an error, if any.
+func (aggregationFetcher AggregationFetcher) CreateStatsQuery(definition EventDefinition, productNumber, serialNumber string) (string, error) {
+	return cloudwatch.NewQueryBuilder().
+		Filter(definition.predicates(productNumber, serialNumber)...).
+		Stats([]cloudwatch.Aggregation{cloudwatch.Count(eventsAlias), cloudwatch.Max(timestampField, lastSeenAlias)},
+			cloudwatch.ByField(definition.SerialNumberField), cloudwatch.Bin(aggregationFetcher.bin)).
+		Limit(cloudwatch.MaxQueryLimit).
+		Build()
+}
+
+// FetchFleet queries in parallel all the event types to obtain the FleetSummary of requestQueryParams.
+// It only fails when all the event types fail.
+func (aggregationFetcher AggregationFetcher) FetchFleet(ctx context.Context, requestQueryParams map[string]string) (*FleetSummary, error) {
+	startTime, endTime, err := queryparams.ExtractTimeRange(requestQueryParams, configs.GetMaxTimeDiffInMinutes())
+	if err != nil {
+		return nil, err
+	}
+
+	productNumber, serialNumber, err := queryparams.ExtractPrinterInfo(requestQueryParams)
+	if err != nil {
+		return nil, err
+	}
+	if productNumber == "" {
+		return nil, queryparams.ErrorQueryStringMissingProductNumber
+	}
+
+	definitions := aggregationFetcher.definitions
+	results := make([][]serialBin, len(definitions))
+	truncated := make([]bool, len(definitions))
+	errs := make([]error, len(definitions))
+
+	var wg sync.WaitGroup
+	for i, definition := range definitions {
+		wg.Add(1)
+		go func(i int, definition EventDefinition) {
+			defer wg.Done()
+			results[i], truncated[i], errs[i] = aggregationFetcher.fetchSerialBins(ctx, definition, productNumber, serialNumber, startTime, endTime)
+		}(i, definition)
+	}
+	wg.Wait()
+
+	summary := &FleetSummary{
+		ProductNumber: productNumber,
+		StartTime:     startTime,
+		EndTime:       endTime,
+		BinSeconds:    int64(aggregationFetcher.bin / time.Second),
+	}
+
+	var firstErr error
+	serials := make(map[string]*SerialSummary)
+	activeBins := make(map[string]map[int64]bool)
+	for i, definition := range definitions {
+		if errs[i] != nil {
+			if summary.Errors == nil {
+				summary.Errors = make(map[string]string)
+			}
+			summary.Errors[definition.Name] = errs[i].Error()
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		summary.Truncated = summary.Truncated || truncated[i]
+
+		for _, result := range results[i] {
+			serial, ok := serials[result.serialNumber]
+			if !ok {
+				serial = &SerialSummary{SerialNumber: result.serialNumber, Counts: make(map[string]int, len(definitions))}
+				for _, d := range definitions {
+					serial.Counts[d.Name] = 0
+				}
+				serials[result.serialNumber] = serial
+				activeBins[result.serialNumber] = make(map[int64]bool)
+			}
+			serial.Counts[definition.Name] += result.events
+			if result.lastSeen.After(serial.LastSeen) {
+				serial.LastSeen = result.lastSeen
+			}
+			activeBins[result.serialNumber][result.bin] = true
+		}
+	}
+
+	if len(definitions) > 0 && len(summary.Errors) == len(definitions) {
+		return nil, firstErr
+	}
+
+	summary.Serials = make([]SerialSummary, 0, len(serials))
+	for serialNumber, serial := range serials {
+		serial.Gaps = findGaps(activeBins[serialNumber], startTime, endTime, aggregationFetcher.bin)
+		summary.Serials = append(summary.Serials, *serial)
+	}
+	sort.Slice(summary.Serials, func(i, j int) bool {
+		return summary.Serials[i].SerialNumber < summary.Serials[j].SerialNumber
+	})
+
+	return summary, nil
+}
+
+// fetchSerialBins performs the stats query of definition and returns its results (see querySerialBins). It also
+// returns truncated as true if some of the results are missing, and an error, if any.
+func (aggregationFetcher AggregationFetcher) fetchSerialBins(ctx context.Context, definition EventDefinition, productNumber, serialNumber string,
+	startTime, endTime time.Time) (results []serialBin, truncated bool, err error) {
+	query, err := aggregationFetcher.CreateStatsQuery(definition, productNumber, serialNumber)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return aggregationFetcher.querySerialBins(ctx, cloudwatch.InsightsQueryParams{
+		StartTimeEpoch: startTime.Unix(),
+		EndTimeEpoch:   endTime.Unix(),
+		LogGroupName:   definition.LogGroup,
+		Query:          query,
+	}, false)
+}
+
+// querySerialBins returns the results of the stats query of insightsQueryParams, splitting the queries that reach the
+// limit, without the bins starting at its end when exclusiveEnd is true. truncated is true if a bin still reaches it.
+func (aggregationFetcher AggregationFetcher) querySerialBins(ctx context.Context, insightsQueryParams cloudwatch.InsightsQueryParams,
+	exclusiveEnd bool) (results []serialBin, truncated bool, err error) {
+	output, err := aggregationFetcher.queryExecutor.ExecuteQuery(ctx, insightsQueryParams)
+	if err != nil {
+		return nil, false, err
+	}
+
+	start, end := insightsQueryParams.StartTimeEpoch, insightsQueryParams.EndTimeEpoch
+	binSeconds := int64(aggregationFetcher.bin / time.Second)
+	binStart := floorDiv(start+(end-start)/2, binSeconds) * binSeconds
+	if binStart <= start {
+		binStart += binSeconds
+	}
+
+	if len(output.Results) < cloudwatch.MaxQueryLimit || binStart >= end {
+		results, err = parseSerialBins(output, aggregationFetcher.bin)
+		if err != nil {
+			return nil, false, err
+		}
+		if exclusiveEnd {
+			results = binsBefore(results, end)
+		}
+		return results, len(output.Results) >= cloudwatch.MaxQueryLimit, nil
+	}
+
+	for _, half := range []struct {
+		timeRange
+		exclusiveEnd bool
+	}{{timeRange{start, binStart}, true}, {timeRange{binStart, end}, exclusiveEnd}} {
+		halfQueryParams := insightsQueryParams
+		halfQueryParams.StartTimeEpoch, halfQueryParams.EndTimeEpoch = half.start, half.end
+
+		halfResults, halfTruncated, err := aggregationFetcher.querySerialBins(ctx, halfQueryParams, half.exclusiveEnd)
+		if err != nil {
+			return nil, false, err
+		}
+		results = append(results, halfResults...)
+		truncated = truncated || halfTruncated
+	}
+	return results, truncated, nil
+}
+
+// binsBefore returns the results whose bin starts before end. The end of the time range of a query is included, so
+// its results can contain the bin starting at end, which is queried with the next time range.
+func binsBefore(results []serialBin, end int64) []serialBin {
+	filtered := results[:0]
+	for _, result := range results {
+		if result.bin < end {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// parseSerialBins converts the results of a stats query to serialBins. The bins are aligned to multiples of bin
+// since the Unix epoch. It also returns an error, if any.
+func parseSerialBins(output *cloudwatchlogs.GetQueryResultsOutput, bin time.Duration) ([]serialBin, error) {
+	binSeconds := int64(bin / time.Second)
+
+	results := make([]serialBin, 0, len(output.Results))
+	for _, row := range output.Results {
+		var result serialBin
+		for _, resultField := range row {
+			if resultField.Field == nil || resultField.Value == nil {
+				continue
+			}
+			field, value := *resultField.Field, *resultField.Value
+
+			switch {
+			case field == eventsAlias:
+				events, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, err
+				}
+				result.events = events
+			case field == lastSeenAlias:
+				lastSeen, err := parseInsightsTime(value)
+				if err != nil {
+					return nil, err
+				}
+				result.lastSeen = lastSeen
+			case strings.HasPrefix(field, binPrefix):
+				binStart, err := parseInsightsTime(value)
+				if err != nil {
+					return nil, err
+				}
+				result.bin = floorDiv(binStart.Unix(), binSeconds) * binSeconds
+			case strings.HasPrefix(field, "@"):
+			default:
+				result.serialNumber = value
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// parseInsightsTime converts a time returned by AWS CloudWatch Insights to time.Time. The aggregations of @timestamp
+// are returned as epochs in milliseconds, and the rest of times in insightsTimestampLayout.
+func parseInsightsTime(value string) (time.Time, error) {
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, millis*int64(time.Millisecond)).UTC(), nil
+	}
+	return time.Parse(insightsTimestampLayout, value)
+}
+
+// findGaps returns the intervals between startTime and endTime that are not covered by any of the activeBins
+// (the epochs of the start of the bins of length bin with events). Consecutive bins without events are merged.
+func findGaps(activeBins map[int64]bool, startTime, endTime time.Time, bin time.Duration) []Gap {
+	binSeconds := int64(bin / time.Second)
+	start, end := startTime.Unix(), endTime.Unix()
+
+	gaps := []Gap{}
+	var gapStart int64
+	inGap := false
+	for binStart := floorDiv(start, binSeconds) * binSeconds; binStart < end; binStart += binSeconds {
+		if !activeBins[binStart] {
+			if !inGap {
+				gapStart = maxInt64(binStart, start)
+				inGap = true
+			}
+			continue
+		}
+		if inGap {
+			gaps = append(gaps, Gap{time.Unix(gapStart, 0).UTC(), time.Unix(binStart, 0).UTC()})
+			inGap = false
+		}
+	}
+	if inGap {
+		gaps = append(gaps, Gap{time.Unix(gapStart, 0).UTC(), time.Unix(end, 0).UTC()})
+	}
+	return gaps
+}
+
+// floorDiv returns a divided by b rounded towards minus infinity.
+func floorDiv(a, b int64) int64 {
+	quotient := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		quotient--
+	}
+	return quotient
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,293 @@
+package datafetcher_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+const fleetDefinitions = `[
+  {"name": "uploads", "log_group": "/uploads",
+   "product_number_field": "fields.ProductNumber", "serial_number_field": "fields.SerialNumber",
+   "fields": [{"field": "fields.key", "attribute": "key", "required": true}]},
+  {"name": "heartbeats", "log_group": "/heartbeats",
+   "product_number_field": "fields.ProductNumber", "serial_number_field": "fields.SerialNumber",
+   "fields": [{"field": "fields.key", "attribute": "key"}],
+   "filters": [{"field": "fields.topic", "operator": "=", "value": "heartbeat"}]}
+]`
+
+// statsQueryExecutor is a QueryExecutor counting the events of the log group of each query by serial and 15 minute bin
+// (failing for failingLogGroups), returning cloudwatch.MaxQueryLimit rows when limit is not zero and reached.
+type statsQueryExecutor struct {
+	rows             map[string][][]string
+	events           map[string][][2]string
+	wholeEndSecond   bool
+	failingLogGroups map[string]bool
+	limit            int
+
+	mutex   sync.Mutex
+	queries map[string]string
+	ranges  []cloudwatch.InsightsQueryParams
+}
+
+func (executor *statsQueryExecutor) ExecuteQuery(ctx context.Context, insightsQueryParams cloudwatch.InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	executor.mutex.Lock()
+	executor.queries[insightsQueryParams.LogGroupName] = insightsQueryParams.Query
+	executor.ranges = append(executor.ranges, insightsQueryParams)
+	executor.mutex.Unlock()
+
+	if executor.failingLogGroups[insightsQueryParams.LogGroupName] {
+		return nil, cloudwatch.ErrorQueryFailed
+	}
+
+	rows := executor.rows[insightsQueryParams.LogGroupName]
+	if events, ok := executor.events[insightsQueryParams.LogGroupName]; ok {
+		rows = executor.countEvents(events, insightsQueryParams)
+	}
+	if executor.limit > 0 {
+		var inRange [][]string
+		for _, row := range rows {
+			bin, err := time.Parse("2006-01-02 15:04:05.000", row[1])
+			Expect(err).To(BeNil())
+			if bin.Unix() >= insightsQueryParams.StartTimeEpoch && bin.Unix() <= insightsQueryParams.EndTimeEpoch {
+				inRange = append(inRange, row)
+			}
+		}
+		rows = inRange
+		for len(rows) >= executor.limit && len(rows) < cloudwatch.MaxQueryLimit {
+			rows = append(rows, rows[0])
+		}
+	}
+
+	output := &cloudwatchlogs.GetQueryResultsOutput{Status: aws.String(cloudwatchlogs.QueryStatusComplete)}
+	for _, row := range rows {
+		output.Results = append(output.Results, []*cloudwatchlogs.ResultField{
+			{Field: aws.String("fields.SerialNumber"), Value: aws.String(row[0])},
+			{Field: aws.String("bin(15m)"), Value: aws.String(row[1])},
+			{Field: aws.String("events"), Value: aws.String(row[2])},
+			{Field: aws.String("last_seen"), Value: aws.String(row[3])},
+		})
+	}
+	return output, nil
+}
+
+// countEvents returns the rows of the stats query of insightsQueryParams over events.
+func (executor *statsQueryExecutor) countEvents(events [][2]string, insightsQueryParams cloudwatch.InsightsQueryParams) [][]string {
+	start := time.Unix(insightsQueryParams.StartTimeEpoch, 0)
+	end := time.Unix(insightsQueryParams.EndTimeEpoch, 0)
+	if executor.wholeEndSecond {
+		end = end.Add(time.Second - time.Millisecond)
+	}
+
+	var rows [][]string
+	groups := make(map[[2]string]int)
+	for _, event := range events {
+		timestamp, err := time.Parse("2006-01-02 15:04:05.000", event[1])
+		Expect(err).To(BeNil())
+		if timestamp.Before(start) || timestamp.After(end) {
+			continue
+		}
+
+		group := [2]string{event[0], timestamp.Truncate(15 * time.Minute).Format("2006-01-02 15:04:05.000")}
+		i, ok := groups[group]
+		if !ok {
+			i = len(rows)
+			groups[group] = i
+			rows = append(rows, []string{group[0], group[1], "0", ""})
+		}
+		count, err := strconv.Atoi(rows[i][2])
+		Expect(err).To(BeNil())
+		rows[i][2] = strconv.Itoa(count + 1)
+		rows[i][3] = strconv.FormatInt(timestamp.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return rows
+}
+
+func utc(hour, minute int) time.Time {
+	return time.Date(2020, 5, 29, hour, minute, 0, 0, time.UTC)
+}
+
+var _ = Describe("AggregationFetcher", func() {
+	var executor *statsQueryExecutor
+	var fetcher AggregationFetcher
+	var queryParams map[string]string
+
+	BeforeEach(func() {
+		configs.Init()
+
+		definitions, err := ParseEventDefinitions([]byte(fleetDefinitions))
+		Expect(err).To(BeNil())
+
+		executor = &statsQueryExecutor{
+			rows: map[string][][]string{
+				"/uploads": {
+					{"SN0000001", "2020-05-29 11:30:00.000", "2", "1590752400000"},
+					{"SN0000002", "2020-05-29 12:15:00.000", "1", "2020-05-29 12:20:00.000"},
+				},
+				"/heartbeats": {
+					{"SN0000001", "2020-05-29 11:30:00.000", "3", "2020-05-29 11:44:00.000"},
+					{"SN0000001", "2020-05-29 12:15:00.000", "3", "2020-05-29 12:29:00.000"},
+				},
+			},
+			failingLogGroups: map[string]bool{},
+			queries:          map[string]string{},
+		}
+		fetcher = NewAggregationFetcher(definitions, executor, 15*time.Minute)
+
+		queryParams = map[string]string{
+			configs.TimeTypeQueryParam:      "absolute",
+			configs.StartTimeQueryParam:     "2020-05-29T11:30:00Z",
+			configs.EndTimeQueryParam:       "2020-05-29T12:30:00Z",
+			configs.ProductNumberQueryParam: "L2E27A",
+		}
+	})
+
+	Context("When all the event types are fetched", func() {
+		It("queries the stats by serial number and bin", func() {
+			_, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+			Expect(err).To(BeNil())
+			Expect(executor.queries["/uploads"]).To(Equal("filter ispresent(fields.key) and fields.ProductNumber = \"L2E27A\"\n" +
+				"| stats count(*) as events, max(@timestamp) as last_seen by fields.SerialNumber, bin(15m)\n" +
+				"| limit 10000"))
+			Expect(executor.queries["/heartbeats"]).To(Equal("filter fields.topic = \"heartbeat\" and fields.ProductNumber = \"L2E27A\"\n" +
+				"| stats count(*) as events, max(@timestamp) as last_seen by fields.SerialNumber, bin(15m)\n" +
+				"| limit 10000"))
+		})
+
+		It("returns the counts, last seen time and gaps of each serial number", func() {
+			summary, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+			Expect(err).To(BeNil())
+			Expect(summary.ProductNumber).To(Equal("L2E27A"))
+			Expect(summary.BinSeconds).To(Equal(int64(900)))
+			Expect(summary.Errors).To(BeNil())
+			Expect(summary.Truncated).To(BeFalse())
+			Expect(summary.Serials).To(Equal([]SerialSummary{
+				{
+					SerialNumber: "SN0000001",
+					Counts:       map[string]int{"uploads": 2, "heartbeats": 6},
+					LastSeen:     utc(12, 29),
+					Gaps:         []Gap{{utc(11, 45), utc(12, 15)}},
+				},
+				{
+					SerialNumber: "SN0000002",
+					Counts:       map[string]int{"uploads": 1, "heartbeats": 0},
+					LastSeen:     utc(12, 20),
+					Gaps:         []Gap{{utc(11, 30), utc(12, 15)}},
+				},
+			}))
+		})
+
+		It("clamps the gaps to the time range", func() {
+			queryParams[configs.StartTimeQueryParam] = "2020-05-29T11:35:00Z"
+			queryParams[configs.EndTimeQueryParam] = "2020-05-29T12:25:00Z"
+
+			summary, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+			Expect(err).To(BeNil())
+			Expect(summary.Serials[1].Gaps).To(Equal([]Gap{{utc(11, 35), utc(12, 15)}}))
+		})
+	})
+
+	Context("When a query reaches the limit of results", func() {
+		BeforeEach(func() {
+			executor.rows["/uploads"] = append(executor.rows["/uploads"], []string{"SN0000003", "2020-05-29 11:45:00.000", "4", "2020-05-29 11:50:00.000"})
+			executor.rows["/heartbeats"] = nil
+		})
+
+		for _, wholeEndSecond := range []bool{false, true} {
+			wholeEndSecond := wholeEndSecond
+			It(fmt.Sprintf("splits the time range at the start of a bin and counts every event once (whole end second: %v)", wholeEndSecond), func() {
+				executor.events = map[string][][2]string{"/uploads": {
+					{"SN0000001", "2020-05-29 11:59:59.999"},
+					{"SN0000001", "2020-05-29 12:00:00.500"},
+					{"SN0000002", "2020-05-29 11:30:00.000"},
+					{"SN0000003", "2020-05-29 12:10:00.000"},
+					{"SN0000003", "2020-05-29 12:15:00.001"},
+				}}
+				executor.wholeEndSecond = wholeEndSecond
+				executor.limit = 4
+
+				summary, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+				Expect(err).To(BeNil())
+				Expect(summary.Truncated).To(BeFalse())
+				Expect(summary.Serials).To(HaveLen(3))
+				Expect(summary.Serials[0].Counts["uploads"]).To(Equal(2))
+				Expect(summary.Serials[0].LastSeen).To(Equal(utc(12, 0).Add(500 * time.Millisecond)))
+				Expect(summary.Serials[1].Counts["uploads"]).To(Equal(1))
+				Expect(summary.Serials[2].Counts["uploads"]).To(Equal(2))
+
+				var uploadRanges [][2]time.Time
+				for _, params := range executor.ranges {
+					if params.LogGroupName == "/uploads" {
+						uploadRanges = append(uploadRanges, [2]time.Time{time.Unix(params.StartTimeEpoch, 0).UTC(), time.Unix(params.EndTimeEpoch, 0).UTC()})
+					}
+				}
+				Expect(uploadRanges).To(Equal([][2]time.Time{
+					{utc(11, 30), utc(12, 30)},
+					{utc(11, 30), utc(12, 0)},
+					{utc(12, 0), utc(12, 30)},
+				}))
+			})
+		}
+
+		It("reports the summary as truncated when a single bin reaches the limit", func() {
+			executor.limit = 1
+
+			summary, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+			Expect(err).To(BeNil())
+			Expect(summary.Truncated).To(BeTrue())
+		})
+	})
+
+	Context("When some event type fails", func() {
+		It("reports the error and returns the rest of the summary", func() {
+			executor.failingLogGroups["/heartbeats"] = true
+
+			summary, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+			Expect(err).To(BeNil())
+			Expect(summary.Errors).To(Equal(map[string]string{"heartbeats": cloudwatch.ErrorQueryFailed.Error()}))
+			Expect(summary.Serials).To(HaveLen(2))
+			Expect(summary.Serials[0].Counts).To(Equal(map[string]int{"uploads": 2, "heartbeats": 0}))
+		})
+	})
+
+	Context("When all the event types fail", func() {
+		It("returns the error", func() {
+			executor.failingLogGroups["/uploads"] = true
+			executor.failingLogGroups["/heartbeats"] = true
+
+			_, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+			Expect(errors.Is(err, cloudwatch.ErrorQueryFailed)).To(BeTrue())
+		})
+	})
+
+	Context("When the product number is missing", func() {
+		It("returns missing product number error", func() {
+			delete(queryParams, configs.ProductNumberQueryParam)
+
+			_, err := fetcher.FetchFleet(context.Background(), queryParams)
+
+			Expect(err).To(Equal(queryparams.ErrorQueryStringMissingProductNumber))
+			Expect(executor.queries).To(BeEmpty())
+		})
+	})
+})
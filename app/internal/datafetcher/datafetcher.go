@@ -2,41 +2,63 @@
 package datafetcher
 
 import (
+	"context"
+	"time"
+
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
-	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 )
 
 // DataFetcher is an interface responsible of obtaining the data. Different structs will have a different logic to
 // obtain its data based in the concrete implementation.
 type DataFetcher interface {
-	FetchData(requestQueryParams map[string]string) (*cloudwatchlogs.GetQueryResultsOutput, error)
-	CreateQueryTemplate(productNumber string, serialNumber string) (queryTemplateStr string)
+	FetchData(ctx context.Context, requestQueryParams map[string]string) (*EventsPage, error)
+	CreateQuery(productNumber string, serialNumber string, limit int) (query string, err error)
 	GetLogGroupName() (logGroupName string)
 }
 
-// createInsightsQueryParams creates InsightQueryParameters based on requestQueryParams and the dataFetcher parameter.
+// FleetFetcher is an interface responsible of obtaining the summary of the printers of a product number (the fleet).
+type FleetFetcher interface {
+	FetchFleet(ctx context.Context, requestQueryParams map[string]string) (*FleetSummary, error)
+}
+
+// fetchEvents obtains with queryExecutor a page of the events of dataFetcher for requestQueryParams.
+// It also returns an error, if any.
+func fetchEvents(ctx context.Context, queryExecutor cloudwatch.QueryExecutor, requestQueryParams map[string]string,
+	dataFetcher DataFetcher, fieldAttributes map[string]string) (*EventsPage, error) {
+	insightsQueryParams, rangeStart, err := createInsightsQueryParams(requestQueryParams, dataFetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := newPageOptions(requestQueryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchPage(ctx, queryExecutor, insightsQueryParams, rangeStart.Unix(), fieldAttributes, options)
+}
+
+// createInsightsQueryParams creates InsightQueryParameters based on requestQueryParams and the dataFetcher parameter,
+// starting at the position of the cursor if any, and the start of the whole time range.
 // The returned InsightQueryParameters will be used by a QueryExecutor to execute the query. It also returns an error, if any.
-func createInsightsQueryParams(requestQueryParams map[string]string, dataFetcher DataFetcher) (insightsQueryParams cloudwatch.InsightsQueryParams, err error) {
-	startTime, endTime, err := queryparams.ExtractTimeRange(requestQueryParams, configs.GetMaxTimeDiffInMinutes())
+func createInsightsQueryParams(requestQueryParams map[string]string, dataFetcher DataFetcher) (insightsQueryParams cloudwatch.InsightsQueryParams, rangeStart time.Time, err error) {
+	maxTimeDiffInMinutes, err := queryparams.ExtractMaxTimeDiffInMinutes(requestQueryParams)
 	if err != nil {
 		return
 	}
 
-	productNumber, serialNumber, err := queryparams.ExtractPrinterInfo(requestQueryParams)
+	rangeStart, endTime, startTime, err := queryparams.ExtractPageTimeRange(requestQueryParams, maxTimeDiffInMinutes)
 	if err != nil {
 		return
 	}
 
-	mapValues := map[string]string{
-		"productNumber": productNumber,
-		"serialNumber":  serialNumber,
+	productNumber, serialNumber, err := queryparams.ExtractPrinterInfo(requestQueryParams)
+	if err != nil {
+		return
 	}
 
-	queryTemplate := dataFetcher.CreateQueryTemplate(productNumber, serialNumber)
-
-	queryToExecute, err := cloudwatch.CreateQuery(queryTemplate, mapValues)
+	queryToExecute, err := dataFetcher.CreateQuery(productNumber, serialNumber, QueryResultsLimit)
 	if err != nil {
 		return
 	}
@@ -47,5 +69,5 @@ func createInsightsQueryParams(requestQueryParams map[string]string, dataFetcher
 		LogGroupName:   dataFetcher.GetLogGroupName(),
 		Query:          queryToExecute,
 	}
-	return insightsQueryParams, nil
+	return insightsQueryParams, rangeStart, nil
 }
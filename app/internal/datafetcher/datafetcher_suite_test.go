@@ -0,0 +1,13 @@
+package datafetcher_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDatafetcher(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Datafetcher Suite")
+}
@@ -0,0 +1,263 @@
+package datafetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/errorTypes"
+)
+
+// Names of the event types of DefaultEventDefinitions.
+const (
+	OpenXMLEvents   = "open-xml"
+	CloudJsonEvents = "cloud-json"
+	HeartbeatEvents = "heartbeat"
+	RTAEvents       = "rta"
+)
+
+const (
+	ErrorInvalidEventDefinitions = ConstError("invalid event definitions")
+	ErrorReservedEventName       = ConstError("event type name reserved for a built-in endpoint")
+	ErrorDuplicatedEventName     = ConstError("event type name defined twice")
+)
+
+// DefaultEventDefinitions are the event types generated by Cloud Connector, used when no other
+// definitions are configured.
+const DefaultEventDefinitions = `[
+  {
+    "name": "open-xml",
+    "log_group": "/aws/lambda/AWSUpload",
+    "product_number_field": "fields.ProductNumber",
+    "serial_number_field": "fields.SerialNumber",
+    "fields": [
+      {"field": "fields.ProductNumber", "attribute": "product_number", "required": true},
+      {"field": "fields.SerialNumber", "attribute": "serial_number", "required": true},
+      {"field": "fields.bucket_name", "attribute": "bucket_name", "required": true},
+      {"field": "fields.bucket_region", "attribute": "bucket_region", "required": true},
+      {"field": "fields.key", "attribute": "key", "required": true},
+      {"field": "fields.topic", "attribute": "topic", "required": true},
+      {"field": "fields.metadata.date", "attribute": "metadata_date", "required": true}
+    ],
+    "filters": [
+      {"field": "fields.topic", "operator": "!=", "value": "heartbeat"}
+    ]
+  },
+  {
+    "name": "cloud-json",
+    "log_group": "/aws/lambda/AWSParser",
+    "product_number_field": "fields.ProductNumber",
+    "serial_number_field": "fields.SerialNumber",
+    "fields": [
+      {"field": "fields.ProductNumber", "attribute": "product_number", "required": true},
+      {"field": "fields.SerialNumber", "attribute": "serial_number", "required": true},
+      {"field": "fields.bucket_name", "attribute": "bucket_name", "required": true},
+      {"field": "fields.bucket_region", "attribute": "bucket_region", "required": true},
+      {"field": "fields.key", "attribute": "key", "required": true},
+      {"field": "fields.topic", "attribute": "topic", "required": true},
+      {"field": "fields.metadata.date", "attribute": "metadata_date", "required": true},
+      {"field": "fields.metadata.xml-generator-object-path", "attribute": "xml_generator_object_path", "required": true}
+    ],
+    "filters": [
+      {"field": "fields.topic", "operator": "=", "value": "json"}
+    ]
+  },
+  {
+    "name": "heartbeat",
+    "log_group": "/aws/lambda/AWSUpload",
+    "product_number_field": "fields.ProductNumber",
+    "serial_number_field": "fields.SerialNumber",
+    "fields": [
+      {"field": "fields.ProductNumber", "attribute": "product_number", "required": true},
+      {"field": "fields.SerialNumber", "attribute": "serial_number", "required": true},
+      {"field": "fields.bucket_name", "attribute": "bucket_name", "required": true},
+      {"field": "fields.bucket_region", "attribute": "bucket_region", "required": true},
+      {"field": "fields.key", "attribute": "key", "required": true},
+      {"field": "fields.topic", "attribute": "topic", "required": true},
+      {"field": "fields.metadata.date", "attribute": "metadata_date", "required": true}
+    ],
+    "filters": [
+      {"field": "fields.topic", "operator": "=", "value": "heartbeat"}
+    ]
+  },
+  {
+    "name": "rta",
+    "log_group": "/aws/lambda/AWSUploadRTA",
+    "product_number_field": "fields.metadata.device-product-number",
+    "serial_number_field": "fields.metadata.device-serial-number",
+    "fields": [
+      {"field": "fields.metadata.device-product-number", "attribute": "product_number", "required": true},
+      {"field": "fields.metadata.device-serial-number", "attribute": "serial_number", "required": true},
+      {"field": "fields.bucket_name", "attribute": "bucket_name", "required": true},
+      {"field": "fields.bucket_region", "attribute": "bucket_region", "required": true},
+      {"field": "fields.key", "attribute": "key", "required": true},
+      {"field": "fields.topic", "attribute": "topic", "required": true},
+      {"field": "fields.metadata.xml-generator-object-path", "attribute": "xml_generator_object_path", "required": true}
+    ]
+  }
+]`
+
+// namePattern are the valid names of the event types. The name is part of the path of the endpoint of the event type.
+var namePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// filterOperators are the comparison operators allowed in the filters of an event type.
+var filterOperators = map[string]bool{"=": true, "!=": true}
+
+// FieldDefinition is a field of the logs that is returned in the attribute of the TimelineEvent with its JSON key
+// as name, or in its Attributes.
+type FieldDefinition struct {
+	Field     string `json:"field"`
+	Attribute string `json:"attribute"`
+	Required  bool   `json:"required,omitempty"`
+}
+
+// FilterDefinition is a comparison of a field of the logs with a value (for instance, the topic of the event).
+// Only the logs that satisfy all the filters are part of the event type.
+type FilterDefinition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// EventDefinition describes an event type of Cloud Connector, served in its own endpoint named after it.
+type EventDefinition struct {
+	Name               string             `json:"name"`
+	LogGroup           string             `json:"log_group"`
+	ProductNumberField string             `json:"product_number_field"`
+	SerialNumberField  string             `json:"serial_number_field"`
+	Fields             []FieldDefinition  `json:"fields"`
+	Filters            []FilterDefinition `json:"filters,omitempty"`
+}
+
+// LoadEventDefinitions returns the event definitions of the JSON file in path, or DefaultEventDefinitions
+// if path is empty. It returns the errors of ParseEventDefinitions, and also returns an error, if any.
+func LoadEventDefinitions(path string) ([]EventDefinition, error) {
+	data := []byte(DefaultEventDefinitions)
+	if path != "" {
+		var err error
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ParseEventDefinitions(data)
+}
+
+// ParseEventDefinitions returns the event definitions of the JSON data. It returns ErrorInvalidEventDefinitions if
+// they are not valid, ErrorReservedEventName or ErrorDuplicatedEventName if a name is already used.
+func ParseEventDefinitions(data []byte) ([]EventDefinition, error) {
+	var definitions []EventDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrorInvalidEventDefinitions, err)
+	}
+
+	if len(definitions) == 0 {
+		return nil, fmt.Errorf("%w: there are no event types", ErrorInvalidEventDefinitions)
+	}
+
+	names := make(map[string]bool)
+	for _, definition := range definitions {
+		if err := definition.validate(); err != nil {
+			return nil, fmt.Errorf("%w: event type %q: %v", ErrorInvalidEventDefinitions, definition.Name, err)
+		}
+		if isBuiltInPath(configs.EventPath(definition.Name)) {
+			return nil, fmt.Errorf("%w: event type %q", ErrorReservedEventName, definition.Name)
+		}
+		if names[definition.Name] {
+			return nil, fmt.Errorf("%w: event type %q", ErrorDuplicatedEventName, definition.Name)
+		}
+		names[definition.Name] = true
+	}
+	return definitions, nil
+}
+
+// isBuiltInPath returns true if path is one of the configs.BuiltInPaths.
+func isBuiltInPath(path string) bool {
+	for _, builtInPath := range configs.BuiltInPaths {
+		if path == builtInPath {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns an error if definition is not valid.
+func (definition EventDefinition) validate() error {
+	if !namePattern.MatchString(definition.Name) {
+		return fmt.Errorf("the name has to contain only lowercase letters, digits and dashes")
+	}
+	if definition.LogGroup == "" {
+		return fmt.Errorf("the log group is missing")
+	}
+	if _, err := cloudwatch.QuoteField(definition.ProductNumberField); err != nil {
+		return fmt.Errorf("invalid product number field %q", definition.ProductNumberField)
+	}
+	if _, err := cloudwatch.QuoteField(definition.SerialNumberField); err != nil {
+		return fmt.Errorf("invalid serial number field %q", definition.SerialNumberField)
+	}
+
+	attributes := make(map[string]bool)
+	for _, field := range definition.Fields {
+		if field.Field == "" || field.Attribute == "" {
+			return fmt.Errorf("the fields need a field and an attribute")
+		}
+		if _, err := cloudwatch.QuoteField(field.Field); err != nil {
+			return fmt.Errorf("invalid field %q", field.Field)
+		}
+		if field.Attribute == timestampAttribute || attributes[field.Attribute] {
+			return fmt.Errorf("attribute %q is defined twice", field.Attribute)
+		}
+		attributes[field.Attribute] = true
+	}
+
+	for _, filter := range definition.Filters {
+		if _, err := cloudwatch.QuoteField(filter.Field); err != nil {
+			return fmt.Errorf("invalid filter field %q", filter.Field)
+		}
+		if !filterOperators[filter.Operator] {
+			return fmt.Errorf("unsupported operator %q", filter.Operator)
+		}
+	}
+	return nil
+}
+
+// predicate returns the cloudwatch.Predicate of filter.
+func (filter FilterDefinition) predicate() cloudwatch.Predicate {
+	if filter.Operator == "!=" {
+		return cloudwatch.NotEquals(filter.Field, filter.Value)
+	}
+	return cloudwatch.Equals(filter.Field, filter.Value)
+}
+
+// predicates returns the predicates satisfied by the logs of the event type of definition that belong to the printer
+// of productNumber and serialNumber.
+func (definition EventDefinition) predicates(productNumber, serialNumber string) []cloudwatch.Predicate {
+	var predicates []cloudwatch.Predicate
+	for _, field := range definition.Fields {
+		if field.Required {
+			predicates = append(predicates, cloudwatch.IsPresent(field.Field))
+		}
+	}
+	for _, filter := range definition.Filters {
+		predicates = append(predicates, filter.predicate())
+	}
+	if productNumber != "" {
+		predicates = append(predicates, cloudwatch.Equals(definition.ProductNumberField, productNumber))
+		if serialNumber != "" {
+			predicates = append(predicates, cloudwatch.Equals(definition.SerialNumberField, serialNumber))
+		}
+	}
+	return predicates
+}
+
+// fieldAttributes returns the name of the attribute of each field of definition.
+func (definition EventDefinition) fieldAttributes() map[string]string {
+	attributes := map[string]string{timestampField: timestampAttribute}
+	for _, field := range definition.Fields {
+		attributes[field.Field] = field.Attribute
+	}
+	return attributes
+}
@@ -0,0 +1,122 @@
+package datafetcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const (
+	// insightsTimestampLayout is the layout of the @timestamp field returned by AWS CloudWatch Insights (always in UTC).
+	insightsTimestampLayout = "2006-01-02 15:04:05.000"
+
+	// timestampField is the field of AWS CloudWatch Insights with the time of each log, which is
+	// returned in the timestampAttribute of every event.
+	timestampField     = "@timestamp"
+	timestampAttribute = "timestamp"
+)
+
+// metadataDateLayouts are the layouts accepted in the date of the metadata of the logs, which is written by the
+// printers. Times without a time zone are in UTC.
+var metadataDateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999"}
+
+// TimelineEvent is an event of the printer timeline (an OpenXML, a CloudJson, a Heartbeat, an RTA...) obtained
+// from the logs of Cloud Connector.
+type TimelineEvent struct {
+	Timestamp              time.Time  `json:"timestamp"`
+	ProductNumber          string     `json:"product_number,omitempty"`
+	SerialNumber           string     `json:"serial_number,omitempty"`
+	BucketRegion           string     `json:"bucket_region,omitempty"`
+	BucketName             string     `json:"bucket_name,omitempty"`
+	Key                    string     `json:"key,omitempty"`
+	Topic                  string     `json:"topic,omitempty"`
+	MetadataDate           *time.Time `json:"metadata_date,omitempty"`
+	XMLGeneratorObjectPath string     `json:"xml_generator_object_path,omitempty"`
+
+	// Attributes contains the fields of event types that do not correspond to any of the other attributes.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// setEventField stores value in the attribute of event called name (its JSON key), or in its Attributes if it is
+// unknown or a metadata date in an unknown format. It returns an error if value is malformed.
+func setEventField(event *TimelineEvent, name string, value string) error {
+	switch name {
+	case timestampAttribute:
+		timestamp, err := time.Parse(insightsTimestampLayout, value)
+		if err != nil {
+			return err
+		}
+		event.Timestamp = timestamp
+	case "product_number":
+		event.ProductNumber = value
+	case "serial_number":
+		event.SerialNumber = value
+	case "bucket_region":
+		event.BucketRegion = value
+	case "bucket_name":
+		event.BucketName = value
+	case "key":
+		event.Key = value
+	case "topic":
+		event.Topic = value
+	case "metadata_date":
+		event.MetadataDate = parseMetadataDate(value)
+		if event.MetadataDate == nil {
+			setAttribute(event, name, value)
+		}
+	case "xml_generator_object_path":
+		event.XMLGeneratorObjectPath = value
+	default:
+		setAttribute(event, name, value)
+	}
+	return nil
+}
+
+// setAttribute stores value in the attribute name of the Attributes of event.
+func setAttribute(event *TimelineEvent, name string, value string) {
+	if event.Attributes == nil {
+		event.Attributes = make(map[string]string)
+	}
+	event.Attributes[name] = value
+}
+
+// parseMetadataDate returns the time of value in any of the metadataDateLayouts, or nil if it has none of them.
+func parseMetadataDate(value string) *time.Time {
+	for _, layout := range metadataDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return &date
+		}
+	}
+	return nil
+}
+
+// parseQueryResults converts the rows returned by AWS CloudWatch Insights into TimelineEvents, storing each field
+// in the attribute of fieldAttributes with its name. It returns an error if any of the fields is malformed.
+func parseQueryResults(output *cloudwatchlogs.GetQueryResultsOutput, fieldAttributes map[string]string) ([]TimelineEvent, error) {
+	if output == nil {
+		return []TimelineEvent{}, nil
+	}
+
+	events := make([]TimelineEvent, 0, len(output.Results))
+	for _, row := range output.Results {
+		var event TimelineEvent
+		for _, resultField := range row {
+			if resultField == nil || resultField.Field == nil || resultField.Value == nil {
+				continue
+			}
+			attribute, ok := fieldAttributes[*resultField.Field]
+			if *resultField.Field == timestampField {
+				attribute, ok = timestampAttribute, true
+			}
+			if !ok {
+				continue
+			}
+			if err := setEventField(&event, attribute, *resultField.Value); err != nil {
+				return nil, fmt.Errorf("error parsing field %s of query results. cause: %w", *resultField.Field, err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
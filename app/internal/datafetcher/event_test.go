@@ -0,0 +1,193 @@
+package datafetcher
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	cloudJsonResponse = `{
+  "Results": [
+    [
+      {
+        "Field": "@timestamp",
+        "Value": "2020-09-16 09:25:00.347"
+      },
+      {
+        "Field": "fields.ProductNumber",
+        "Value": "Y0U23A"
+      },
+      {
+        "Field": "fields.SerialNumber",
+        "Value": "MY97F1T00H"
+      },
+      {
+        "Field": "fields.bucket_name",
+        "Value": "drp-cloudconnector-to-blacksea"
+      },
+      {
+        "Field": "fields.bucket_region",
+        "Value": "US_WEST_1"
+      },
+      {
+        "Field": "fields.key",
+        "Value": "Y0U23A!MY97F1T00H-7396e65a-f5f2-4db9-8d02-bd1a7d4c8132"
+      },
+      {
+        "Field": "fields.topic",
+        "Value": "json"
+      },
+      {
+        "Field": "fields.metadata.date",
+        "Value": "2020-09-16T09:24:59Z"
+      },
+      {
+        "Field": "fields.metadata.xml-generator-object-path",
+        "Value": "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16_09_24_57_813"
+      },
+      {
+        "Field": "@ptr",
+        "Value": "Cl8KJgoiMTAzNjkxMDEzODI3Oi9hd3MvbGFtYmRhL0FXU1BhcnNlchAFEjUaGAIF8qpFWAAAAACOybG5AAX2HZngAAAHgiABKLP57LHJLjCz9O2xyS44CED3E0jRSFDANxABGAE=n     "
+      }
+    ]
+  ],
+  "Statistics": {
+    "BytesScanned": 16792,
+    "RecordsMatched": 13,
+    "RecordsScanned": 52
+  },
+  "Status": "Complete"
+}`
+
+	rtaResponse = `{
+  "Results": [
+    [
+      {
+        "Field": "@timestamp",
+        "Value": "2020-09-16 09:25:01.000"
+      },
+      {
+        "Field": "fields.metadata.device-product-number",
+        "Value": "Y0U23A"
+      },
+      {
+        "Field": "fields.metadata.device-serial-number",
+        "Value": "MY97F1T00H"
+      },
+      {
+        "Field": "fields.topic",
+        "Value": "rta"
+      }
+    ]
+  ],
+  "Status": "Complete"
+}`
+)
+
+var _ = Describe("Query results parsing", func() {
+
+	parse := func(response string, eventType string) ([]TimelineEvent, error) {
+		var output *cloudwatchlogs.GetQueryResultsOutput
+		err := json.Unmarshal([]byte(response), &output)
+		Expect(err).To(BeNil())
+
+		definitions, err := LoadEventDefinitions("")
+		Expect(err).To(BeNil())
+		for _, definition := range definitions {
+			if definition.Name == eventType {
+				return parseQueryResults(output, definition.fieldAttributes())
+			}
+		}
+		return parseQueryResults(output, nil)
+	}
+
+	Context("When the results contain all the fields of a CloudJson", func() {
+		It("returns the typed events", func() {
+			events, err := parse(cloudJsonResponse, CloudJsonEvents)
+
+			Expect(err).To(BeNil())
+			Expect(events).To(HaveLen(1))
+
+			metadataDate := time.Date(2020, 9, 16, 9, 24, 59, 0, time.UTC)
+			Expect(events[0]).To(Equal(TimelineEvent{
+				Timestamp:              time.Date(2020, 9, 16, 9, 25, 0, 347000000, time.UTC),
+				ProductNumber:          "Y0U23A",
+				SerialNumber:           "MY97F1T00H",
+				BucketRegion:           "US_WEST_1",
+				BucketName:             "drp-cloudconnector-to-blacksea",
+				Key:                    "Y0U23A!MY97F1T00H-7396e65a-f5f2-4db9-8d02-bd1a7d4c8132",
+				Topic:                  "json",
+				MetadataDate:           &metadataDate,
+				XMLGeneratorObjectPath: "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16_09_24_57_813",
+			}))
+		})
+	})
+
+	Context("When the results use the RTA field names", func() {
+		It("normalizes the product number and serial number", func() {
+			events, err := parse(rtaResponse, RTAEvents)
+
+			Expect(err).To(BeNil())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].ProductNumber).To(Equal("Y0U23A"))
+			Expect(events[0].SerialNumber).To(Equal("MY97F1T00H"))
+			Expect(events[0].Topic).To(Equal("rta"))
+		})
+	})
+
+	Context("When the timestamp is malformed", func() {
+		It("returns an error", func() {
+			_, err := parse(`{"Results": [[{"Field": "@timestamp", "Value": "yesterday"}]]}`, OpenXMLEvents)
+
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Context("When the date of the metadata is not in RFC 3339 format", func() {
+		It("accepts it without time zone", func() {
+			events, err := parse(`{"Results": [[{"Field": "fields.metadata.date", "Value": "2020-09-16 09:24:59.813"}]]}`, CloudJsonEvents)
+
+			Expect(err).To(BeNil())
+			Expect(events).To(HaveLen(1))
+			Expect(*events[0].MetadataDate).To(Equal(time.Date(2020, 9, 16, 9, 24, 59, 813000000, time.UTC)))
+		})
+
+		It("leaves it empty and keeps the raw value in the attributes when it has an unknown format", func() {
+			events, err := parse(`{"Results": [[{"Field": "@timestamp", "Value": "2020-09-16 09:25:00.347"}, {"Field": "fields.metadata.date", "Value": "16/09/2020"}]]}`, CloudJsonEvents)
+
+			Expect(err).To(BeNil())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].MetadataDate).To(BeNil())
+			Expect(events[0].Attributes).To(Equal(map[string]string{"metadata_date": "16/09/2020"}))
+			Expect(events[0].Timestamp).To(Equal(time.Date(2020, 9, 16, 9, 25, 0, 347000000, time.UTC)))
+		})
+	})
+
+	Context("When there are no results", func() {
+		It("returns an empty list of events", func() {
+			events, err := parseQueryResults(nil, nil)
+
+			Expect(err).To(BeNil())
+			Expect(events).NotTo(BeNil())
+			Expect(events).To(BeEmpty())
+		})
+	})
+
+	Context("When the results contain fields without a known attribute", func() {
+		It("stores them in the attributes of the events", func() {
+			response := `{"Results": [[{"Field": "@timestamp", "Value": "2020-09-16 09:25:00.347"}, {"Field": "fields.status", "Value": "ok"}, {"Field": "@ptr", "Value": "ptr"}]]}`
+			var output *cloudwatchlogs.GetQueryResultsOutput
+			Expect(json.Unmarshal([]byte(response), &output)).To(Succeed())
+
+			events, err := parseQueryResults(output, map[string]string{"fields.status": "status"})
+
+			Expect(err).To(BeNil())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Attributes).To(Equal(map[string]string{"status": "ok"}))
+		})
+	})
+})
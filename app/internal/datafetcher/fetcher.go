@@ -0,0 +1,73 @@
+package datafetcher
+
+import (
+	"context"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+)
+
+// EventFetcher is the implementation of DataFetcher that uses a queryExecutor to perform the query described
+// by an EventDefinition and obtain its events.
+type EventFetcher struct {
+	definition    EventDefinition
+	queryExecutor cloudwatch.QueryExecutor
+}
+
+// NewEventFetcher creates a new EventFetcher of the events described by definition.
+func NewEventFetcher(definition EventDefinition, queryExecutor cloudwatch.QueryExecutor) EventFetcher {
+	return EventFetcher{definition, queryExecutor}
+}
+
+// Source is a DataFetcher together with the name of the event type it obtains.
+type Source struct {
+	Name    string
+	Fetcher DataFetcher
+}
+
+// NewSources creates an EventFetcher for each of the definitions, in the same order.
+func NewSources(definitions []EventDefinition, queryExecutor cloudwatch.QueryExecutor) []Source {
+	sources := make([]Source, 0, len(definitions))
+	for _, definition := range definitions {
+		sources = append(sources, Source{definition.Name, NewEventFetcher(definition, queryExecutor)})
+	}
+	return sources
+}
+
+// FindSource returns the DataFetcher of the source called name in sources. It returns ok as false if there is none.
+func FindSource(sources []Source, name string) (fetcher DataFetcher, ok bool) {
+	for _, source := range sources {
+		if source.Name == name {
+			return source.Fetcher, true
+		}
+	}
+	return nil, false
+}
+
+// GetLogGroupName returns the Log group in AWS CloudWatch of the event type.
+func (eventFetcher EventFetcher) GetLogGroupName() (logGroupName string) {
+	return eventFetcher.definition.LogGroup
+}
+
+// CreateQuery returns the query of the event type depending on the productNumber and serialNumber parameters,
+// limited to limit results. It also returns an error, if any.
+func (eventFetcher EventFetcher) CreateQuery(productNumber, serialNumber string, limit int) (query string, err error) {
+	definition := eventFetcher.definition
+
+	fields := []string{timestampField}
+	for _, field := range definition.Fields {
+		fields = append(fields, field.Field)
+	}
+
+	return cloudwatch.NewQueryBuilder().
+		Fields(fields...).
+		Filter(definition.predicates(productNumber, serialNumber)...).
+		Sort(timestampField, cloudwatch.Ascending).
+		Limit(limit).
+		Build()
+}
+
+// FetchData obtains a page of the events of the event type depending on requestQueryParams.
+// It also returns an error, if any.
+func (eventFetcher EventFetcher) FetchData(ctx context.Context, requestQueryParams map[string]string) (*EventsPage, error) {
+	return fetchEvents(ctx, eventFetcher.queryExecutor, requestQueryParams, eventFetcher, eventFetcher.definition.fieldAttributes())
+}
@@ -0,0 +1,161 @@
+package datafetcher_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+)
+
+var _ = Describe("Event definitions", func() {
+	Context("When no file is configured", func() {
+		It("loads the default event types in order", func() {
+			definitions, err := LoadEventDefinitions("")
+
+			Expect(err).To(BeNil())
+			var names []string
+			for _, definition := range definitions {
+				names = append(names, definition.Name)
+			}
+			Expect(names).To(Equal([]string{OpenXMLEvents, CloudJsonEvents, HeartbeatEvents, RTAEvents}))
+		})
+	})
+
+	Context("When a file is configured", func() {
+		It("loads the event types of the file", func() {
+			dir, err := ioutil.TempDir("", "definitions")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "events.json")
+			content := `[{"name": "firmware-update", "log_group": "/aws/lambda/AWSFirmware",
+				"product_number_field": "fields.pn", "serial_number_field": "fields.sn",
+				"fields": [{"field": "fields.version", "attribute": "version", "required": true}]}]`
+			Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+
+			definitions, err := LoadEventDefinitions(path)
+
+			Expect(err).To(BeNil())
+			Expect(definitions).To(HaveLen(1))
+			Expect(definitions[0].Name).To(Equal("firmware-update"))
+			Expect(definitions[0].LogGroup).To(Equal("/aws/lambda/AWSFirmware"))
+		})
+	})
+
+	Context("When the definitions are not valid", func() {
+		invalidDefinitions := []struct{ description, content string }{
+			{"malformed JSON", `[{"name": `},
+			{"no event types", `[]`},
+			{"name with spaces", `[{"name": "open xml", "log_group": "g", "product_number_field": "p", "serial_number_field": "s"}]`},
+			{"missing log group", `[{"name": "a", "product_number_field": "p", "serial_number_field": "s"}]`},
+			{"missing printer fields", `[{"name": "a", "log_group": "g"}]`},
+			{"repeated attribute", `[{"name": "a", "log_group": "g", "product_number_field": "p", "serial_number_field": "s",
+			"fields": [{"field": "f1", "attribute": "key"}, {"field": "f2", "attribute": "key"}]}]`},
+			{"unsupported operator", `[{"name": "a", "log_group": "g", "product_number_field": "p", "serial_number_field": "s",
+			"filters": [{"field": "fields.topic", "operator": "like", "value": "json"}]}]`},
+		}
+
+		for _, invalid := range invalidDefinitions {
+			content := invalid.content
+			It("returns invalid event definitions error for "+invalid.description, func() {
+				_, err := ParseEventDefinitions([]byte(content))
+
+				Expect(errors.Is(err, ErrorInvalidEventDefinitions)).To(BeTrue())
+			})
+		}
+	})
+
+	Context("When the name of an event type is the name of a built-in endpoint", func() {
+		for _, name := range []string{"timeline", "object", "subscriptions", "fleet", "heartbeat-analysis", "pipeline"} {
+			content := `[{"name": "` + name + `", "log_group": "g", "product_number_field": "p", "serial_number_field": "s"}]`
+			It("returns reserved event name error for "+name, func() {
+				_, err := ParseEventDefinitions([]byte(content))
+
+				Expect(errors.Is(err, ErrorReservedEventName)).To(BeTrue())
+			})
+		}
+	})
+
+	Context("When two event types have the same name", func() {
+		It("returns duplicated event name error", func() {
+			_, err := ParseEventDefinitions([]byte(`[{"name": "a", "log_group": "g", "product_number_field": "p", "serial_number_field": "s"},
+			{"name": "a", "log_group": "g2", "product_number_field": "p", "serial_number_field": "s"}]`))
+
+			Expect(errors.Is(err, ErrorDuplicatedEventName)).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("EventFetcher", func() {
+	var fetcher EventFetcher
+
+	BeforeEach(func() {
+		definitions, err := ParseEventDefinitions([]byte(`[{"name": "rta", "log_group": "/aws/lambda/AWSUploadRTA",
+			"product_number_field": "fields.metadata.device-product-number", "serial_number_field": "fields.metadata.device-serial-number",
+			"fields": [{"field": "fields.metadata.device-product-number", "attribute": "product_number", "required": true},
+				{"field": "fields.key", "attribute": "key"}],
+			"filters": [{"field": "fields.topic", "operator": "!=", "value": "say \"hi\""}]}]`))
+		Expect(err).To(BeNil())
+		fetcher = NewEventFetcher(definitions[0], nil)
+	})
+
+	It("returns the log group of the definition", func() {
+		Expect(fetcher.GetLogGroupName()).To(Equal("/aws/lambda/AWSUploadRTA"))
+	})
+
+	Context("When the product number and serial number are present", func() {
+		It("filters by both of them", func() {
+			query, err := fetcher.CreateQuery("pn", "sn", 100)
+
+			Expect(err).To(BeNil())
+			Expect(query).To(Equal("fields @timestamp, `fields.metadata.device-product-number`, fields.key\n" +
+				"| filter ispresent(`fields.metadata.device-product-number`) and fields.topic != \"say \\\"hi\\\"\"" +
+				" and `fields.metadata.device-product-number` = \"pn\" and `fields.metadata.device-serial-number` = \"sn\"\n" +
+				"| sort @timestamp asc\n| limit 100"))
+		})
+	})
+
+	Context("When only the product number is present", func() {
+		It("filters only by the product number", func() {
+			query, err := fetcher.CreateQuery("pn", "", 100)
+
+			Expect(err).To(BeNil())
+			Expect(query).To(Equal("fields @timestamp, `fields.metadata.device-product-number`, fields.key\n" +
+				"| filter ispresent(`fields.metadata.device-product-number`) and fields.topic != \"say \\\"hi\\\"\"" +
+				" and `fields.metadata.device-product-number` = \"pn\"\n" +
+				"| sort @timestamp asc\n| limit 100"))
+		})
+	})
+
+	Context("When the product number tries to break out of the filter", func() {
+		It("escapes it inside the string literal", func() {
+			query, err := fetcher.CreateQuery(`X" or 1=1 | stats count(*) by @logStream #`, "A&B'C", 100)
+
+			Expect(err).To(BeNil())
+			Expect(query).To(ContainSubstring("`fields.metadata.device-product-number` = \"X\\\" or 1=1 | stats count(*) by @logStream #\""))
+			Expect(query).To(ContainSubstring("`fields.metadata.device-serial-number` = \"A&B'C\""))
+		})
+	})
+
+	Context("When there are several definitions", func() {
+		It("creates a source for each one in the same order", func() {
+			definitions, err := LoadEventDefinitions("")
+			Expect(err).To(BeNil())
+
+			sources := NewSources(definitions, nil)
+
+			Expect(sources).To(HaveLen(len(definitions)))
+			Expect(sources[0].Name).To(Equal(OpenXMLEvents))
+			heartbeats, ok := FindSource(sources, HeartbeatEvents)
+			Expect(ok).To(BeTrue())
+			Expect(heartbeats.GetLogGroupName()).To(Equal("/aws/lambda/AWSUpload"))
+			_, ok = FindSource(sources, "unknown")
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
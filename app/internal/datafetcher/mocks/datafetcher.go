@@ -1,11 +1,12 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: ../datafetcher/datafetcher.go
+// Source: datafetcher/datafetcher.go
 
 // Package mocks is a generated GoMock package.
 package mocks
 
 import (
-	cloudwatchlogs "github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	datafetcher "bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 )
@@ -34,32 +35,33 @@ func (m *MockDataFetcher) EXPECT() *MockDataFetcherMockRecorder {
 }
 
 // FetchData mocks base method
-func (m *MockDataFetcher) FetchData(requestQueryParams map[string]string) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+func (m *MockDataFetcher) FetchData(ctx context.Context, requestQueryParams map[string]string) (*datafetcher.EventsPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FetchData", requestQueryParams)
-	ret0, _ := ret[0].(*cloudwatchlogs.GetQueryResultsOutput)
+	ret := m.ctrl.Call(m, "FetchData", ctx, requestQueryParams)
+	ret0, _ := ret[0].(*datafetcher.EventsPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FetchData indicates an expected call of FetchData
-func (mr *MockDataFetcherMockRecorder) FetchData(requestQueryParams interface{}) *gomock.Call {
+func (mr *MockDataFetcherMockRecorder) FetchData(ctx, requestQueryParams interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchData", reflect.TypeOf((*MockDataFetcher)(nil).FetchData), requestQueryParams)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchData", reflect.TypeOf((*MockDataFetcher)(nil).FetchData), ctx, requestQueryParams)
 }
 
-// CreateQueryTemplate mocks base method
-func (m *MockDataFetcher) CreateQueryTemplate(productNumber, serialNumber string) string {
+// CreateQuery mocks base method
+func (m *MockDataFetcher) CreateQuery(productNumber, serialNumber string, limit int) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateQueryTemplate", productNumber, serialNumber)
+	ret := m.ctrl.Call(m, "CreateQuery", productNumber, serialNumber, limit)
 	ret0, _ := ret[0].(string)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// CreateQueryTemplate indicates an expected call of CreateQueryTemplate
-func (mr *MockDataFetcherMockRecorder) CreateQueryTemplate(productNumber, serialNumber interface{}) *gomock.Call {
+// CreateQuery indicates an expected call of CreateQuery
+func (mr *MockDataFetcherMockRecorder) CreateQuery(productNumber, serialNumber, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateQueryTemplate", reflect.TypeOf((*MockDataFetcher)(nil).CreateQueryTemplate), productNumber, serialNumber)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateQuery", reflect.TypeOf((*MockDataFetcher)(nil).CreateQuery), productNumber, serialNumber, limit)
 }
 
 // GetLogGroupName mocks base method
@@ -75,3 +77,41 @@ func (mr *MockDataFetcherMockRecorder) GetLogGroupName() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLogGroupName", reflect.TypeOf((*MockDataFetcher)(nil).GetLogGroupName))
 }
+
+// MockFleetFetcher is a mock of FleetFetcher interface
+type MockFleetFetcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockFleetFetcherMockRecorder
+}
+
+// MockFleetFetcherMockRecorder is the mock recorder for MockFleetFetcher
+type MockFleetFetcherMockRecorder struct {
+	mock *MockFleetFetcher
+}
+
+// NewMockFleetFetcher creates a new mock instance
+func NewMockFleetFetcher(ctrl *gomock.Controller) *MockFleetFetcher {
+	mock := &MockFleetFetcher{ctrl: ctrl}
+	mock.recorder = &MockFleetFetcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockFleetFetcher) EXPECT() *MockFleetFetcherMockRecorder {
+	return m.recorder
+}
+
+// FetchFleet mocks base method
+func (m *MockFleetFetcher) FetchFleet(ctx context.Context, requestQueryParams map[string]string) (*datafetcher.FleetSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchFleet", ctx, requestQueryParams)
+	ret0, _ := ret[0].(*datafetcher.FleetSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchFleet indicates an expected call of FetchFleet
+func (mr *MockFleetFetcherMockRecorder) FetchFleet(ctx, requestQueryParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchFleet", reflect.TypeOf((*MockFleetFetcher)(nil).FetchFleet), ctx, requestQueryParams)
+}
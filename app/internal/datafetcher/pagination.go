@@ -0,0 +1,286 @@
+package datafetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+// QueryResultsLimit is the maximum number of results returned by a single query in AWS CloudWatch Insights.
+// All the queries of the fetchers are limited to this value.
+const QueryResultsLimit = cloudwatch.MaxQueryLimit
+
+// EventsPage is a page of the events of a time range, in chronological order.
+// NextCursor is empty when the page contains all the remaining events of the time range.
+type EventsPage struct {
+	Events     []TimelineEvent `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// timeRange is an interval of epoch seconds that includes start and excludes end.
+type timeRange struct {
+	start, end int64
+}
+
+// contains returns whether timestamp is inside r.
+func (r timeRange) contains(timestamp time.Time) bool {
+	return timestamp.Unix() >= r.start && timestamp.Unix() < r.end
+}
+
+// pageOptions are the limits used to obtain a page of events.
+type pageOptions struct {
+	// resultsLimit is the maximum number of results of a single query.
+	resultsLimit int
+	// pageSize is the maximum number of events of a page, after which no more queries are executed.
+	pageSize int
+	// windowSeconds is the maximum size of the time range of a single query.
+	windowSeconds int64
+	// concurrency is the maximum number of queries executed at the same time.
+	concurrency int
+	// scanBudgetBytes is the number of scanned bytes after which no more queries are executed. Zero means no budget.
+	scanBudgetBytes float64
+}
+
+// newPageOptions returns the pageOptions for requestQueryParams based on the configuration.
+// Chunked queries are split in windows of configs.GetMaxTimeDiffInMinutes() executed with configs.GetChunksConcurrency().
+func newPageOptions(requestQueryParams map[string]string) (pageOptions, error) {
+	chunked, err := queryparams.ExtractChunked(requestQueryParams)
+	if err != nil {
+		return pageOptions{}, err
+	}
+
+	options := pageOptions{
+		resultsLimit:    QueryResultsLimit,
+		pageSize:        QueryResultsLimit,
+		windowSeconds:   int64(configs.GetMaxTimeDiffInMinutes()) * 60,
+		concurrency:     1,
+		scanBudgetBytes: float64(configs.GetScanBudgetBytes()),
+	}
+	if chunked {
+		options.concurrency = configs.GetChunksConcurrency()
+	}
+	return options, nil
+}
+
+// ScanBudget is the amount of bytes that the queries are allowed to scan, shared by all the pages fetched with a
+// context (see WithScanBudget). A limit of zero means no budget. It is safe for concurrent use.
+type ScanBudget struct {
+	limit float64
+
+	mutex   sync.Mutex
+	scanned float64
+}
+
+type scanBudgetKey struct{}
+
+// WithScanBudget returns a copy of ctx where all the pages share a ScanBudget of limitBytes, which is also returned.
+func WithScanBudget(ctx context.Context, limitBytes int64) (context.Context, *ScanBudget) {
+	budget := &ScanBudget{limit: float64(limitBytes)}
+	return context.WithValue(ctx, scanBudgetKey{}, budget), budget
+}
+
+// ScanBudgetFromContext returns the ScanBudget of ctx, or nil if it has none.
+func ScanBudgetFromContext(ctx context.Context) *ScanBudget {
+	budget, _ := ctx.Value(scanBudgetKey{}).(*ScanBudget)
+	return budget
+}
+
+// Exhausted returns whether the queries have scanned all the bytes of the budget.
+func (budget *ScanBudget) Exhausted() bool {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	return budget.limit > 0 && budget.scanned >= budget.limit
+}
+
+// Add records that a query scanned bytes.
+func (budget *ScanBudget) Add(bytes float64) {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	budget.scanned += bytes
+}
+
+// pageSlot is a part of the time range of a page. Once its query has been executed (and it did not reach the
+// limit of results) it is done and contains its events.
+type pageSlot struct {
+	timeRange
+	done   bool
+	events []TimelineEvent
+}
+
+// fetchPage returns a page of the events of the time range of insightsQueryParams in chronological order, splitting
+// the windows whose query reaches options.resultsLimit. The fields are stored in the attributes of fieldAttributes.
+func fetchPage(ctx context.Context, queryExecutor cloudwatch.QueryExecutor, insightsQueryParams cloudwatch.InsightsQueryParams,
+	rangeStart int64, fieldAttributes map[string]string, options pageOptions) (*EventsPage, error) {
+
+	page := &EventsPage{Events: []TimelineEvent{}}
+	end := insightsQueryParams.EndTimeEpoch + 1
+	slots := splitInWindows(timeRange{insightsQueryParams.StartTimeEpoch, end}, options.windowSeconds)
+	budget := ScanBudgetFromContext(ctx)
+	if budget == nil {
+		budget = &ScanBudget{limit: options.scanBudgetBytes}
+	}
+
+	nextCursor := func(position int64) string {
+		return queryparams.EncodeCursor(time.Unix(position, 0), time.Unix(rangeStart, 0), time.Unix(insightsQueryParams.EndTimeEpoch, 0))
+	}
+
+	for {
+		for len(slots) > 0 && slots[0].done {
+			page.Events = append(page.Events, slots[0].events...)
+			slots = slots[1:]
+		}
+
+		if len(page.Events) > options.pageSize {
+			var nextStart int64
+			page.Events, nextStart = trimEvents(page.Events, options.pageSize)
+			if nextStart < end {
+				page.NextCursor = nextCursor(nextStart)
+			}
+			return page, nil
+		}
+		if len(slots) == 0 {
+			return page, nil
+		}
+
+		if len(page.Events) == options.pageSize || budget.Exhausted() {
+			page.NextCursor = nextCursor(slots[0].start)
+			return page, nil
+		}
+
+		var batch []int
+		for i := range slots {
+			if !slots[i].done {
+				batch = append(batch, i)
+			}
+			if len(batch) == options.concurrency {
+				break
+			}
+		}
+
+		results, err := executeConcurrently(ctx, queryExecutor, insightsQueryParams, slots, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []pageSlot
+		previous := 0
+		for j, i := range batch {
+			next = append(next, slots[previous:i]...)
+			previous = i + 1
+
+			result := results[j]
+			if result.Statistics != nil && result.Statistics.BytesScanned != nil {
+				budget.Add(*result.Statistics.BytesScanned)
+			}
+
+			current := slots[i]
+			events, err := parseQueryResults(result, fieldAttributes)
+			if err != nil {
+				return nil, err
+			}
+			events = eventsIn(events, current.timeRange)
+
+			if len(events) >= options.resultsLimit {
+				if current.end-current.start > 1 {
+					middle := current.start + (current.end-current.start)/2
+					next = append(next, pageSlot{timeRange: timeRange{current.start, middle}}, pageSlot{timeRange: timeRange{middle, current.end}})
+					continue
+				}
+				fmt.Println("WARNING: more than", options.resultsLimit, "results in second", current.start, "of log group",
+					insightsQueryParams.LogGroupName, "some events are missing")
+			}
+			next = append(next, pageSlot{timeRange: current.timeRange, done: true, events: events})
+		}
+		slots = append(next, slots[previous:]...)
+	}
+}
+
+// eventsIn returns the events of r. The end of the time range of a query is included, so its results can contain
+// events of the second r.end, which belong to the next time range.
+func eventsIn(events []TimelineEvent, r timeRange) []TimelineEvent {
+	filtered := events[:0]
+	for _, event := range events {
+		if r.contains(event.Timestamp) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// trimEvents returns the events of the seconds before the one of the event after the first pageSize ones, and that
+// second, where the next page starts. A single second with more than pageSize events is never split.
+func trimEvents(events []TimelineEvent, pageSize int) (trimmed []TimelineEvent, nextStart int64) {
+	nextStart = events[pageSize].Timestamp.Unix()
+	if nextStart == events[0].Timestamp.Unix() {
+		nextStart++
+	}
+
+	end := sort.Search(len(events), func(i int) bool { return events[i].Timestamp.Unix() >= nextStart })
+	return events[:end], nextStart
+}
+
+// splitInWindows splits r in consecutive time ranges of at most windowSeconds.
+func splitInWindows(r timeRange, windowSeconds int64) []pageSlot {
+	if windowSeconds <= 0 {
+		return []pageSlot{{timeRange: r}}
+	}
+
+	var slots []pageSlot
+	for start := r.start; start < r.end; start += windowSeconds {
+		end := start + windowSeconds
+		if end > r.end {
+			end = r.end
+		}
+		slots = append(slots, pageSlot{timeRange: timeRange{start, end}})
+	}
+	return slots
+}
+
+// executeConcurrently executes at the same time the query of insightsQueryParams for the slots in the indexes of batch.
+// If any of the queries fails, the others are cancelled and the error is returned.
+func executeConcurrently(ctx context.Context, queryExecutor cloudwatch.QueryExecutor, insightsQueryParams cloudwatch.InsightsQueryParams,
+	slots []pageSlot, batch []int) ([]*cloudwatchlogs.GetQueryResultsOutput, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*cloudwatchlogs.GetQueryResultsOutput, len(batch))
+	errs := make([]error, len(batch))
+
+	var wg sync.WaitGroup
+	for j, i := range batch {
+		rangeQueryParams := insightsQueryParams
+		rangeQueryParams.StartTimeEpoch = slots[i].start
+		rangeQueryParams.EndTimeEpoch = slots[i].end
+
+		wg.Add(1)
+		go func(j int, rangeQueryParams cloudwatch.InsightsQueryParams) {
+			defer wg.Done()
+			results[j], errs[j] = queryExecutor.ExecuteQuery(ctx, rangeQueryParams)
+			if errs[j] != nil {
+				cancel()
+			}
+		}(j, rangeQueryParams)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil && err != context.Canceled {
+			return nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
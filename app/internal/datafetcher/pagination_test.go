@@ -0,0 +1,272 @@
+package datafetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
+)
+
+// fakeQueryExecutor is a QueryExecutor with an event in each of the epochs (plus offsetMillis) that pages at most limit
+// results per query like Insights, including the whole end second of a query when wholeEndSecond is true.
+// Every query scans bytesPerQuery bytes, and the queries whose time range contains failingEpoch fail.
+type fakeQueryExecutor struct {
+	epochs         []int64
+	offsetMillis   int64
+	wholeEndSecond bool
+	limit          int
+	bytesPerQuery  float64
+	failingEpoch   int64
+
+	mutex   sync.Mutex
+	queries []timeRange
+}
+
+func (executor *fakeQueryExecutor) ExecuteQuery(ctx context.Context, insightsQueryParams cloudwatch.InsightsQueryParams) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	executor.mutex.Lock()
+	executor.queries = append(executor.queries, timeRange{insightsQueryParams.StartTimeEpoch, insightsQueryParams.EndTimeEpoch})
+	executor.mutex.Unlock()
+
+	if executor.failingEpoch != 0 && executor.failingEpoch >= insightsQueryParams.StartTimeEpoch && executor.failingEpoch < insightsQueryParams.EndTimeEpoch {
+		return nil, errors.New("query failed")
+	}
+
+	endMillis := insightsQueryParams.EndTimeEpoch * 1000
+	if executor.wholeEndSecond {
+		endMillis += 999
+	}
+
+	output := &cloudwatchlogs.GetQueryResultsOutput{
+		Status:     aws.String(cloudwatchlogs.QueryStatusComplete),
+		Statistics: &cloudwatchlogs.QueryStatistics{BytesScanned: aws.Float64(executor.bytesPerQuery)},
+	}
+	for _, epoch := range executor.epochs {
+		millis := epoch*1000 + executor.offsetMillis
+		if millis < insightsQueryParams.StartTimeEpoch*1000 || millis > endMillis {
+			continue
+		}
+		if len(output.Results) == executor.limit {
+			break
+		}
+		timestamp := time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(insightsTimestampLayout)
+		output.Results = append(output.Results, []*cloudwatchlogs.ResultField{
+			{Field: aws.String("@timestamp"), Value: aws.String(timestamp)},
+		})
+	}
+	return output, nil
+}
+
+func eventEpochs(page *EventsPage) []int64 {
+	var epochs []int64
+	for _, event := range page.Events {
+		epochs = append(epochs, event.Timestamp.Unix())
+	}
+	return epochs
+}
+
+var _ = Describe("Pagination", func() {
+	var params cloudwatch.InsightsQueryParams
+	var options pageOptions
+
+	BeforeEach(func() {
+		params = cloudwatch.InsightsQueryParams{StartTimeEpoch: 100, EndTimeEpoch: 199}
+		options = pageOptions{resultsLimit: 4, pageSize: 10, concurrency: 1}
+	})
+
+	Context("When the query returns less results than the limit", func() {
+		It("executes a single query and returns all the events", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 150, 199}, limit: 4}
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100, 150, 199}))
+			Expect(page.NextCursor).To(BeEmpty())
+			Expect(executor.queries).To(Equal([]timeRange{{100, 200}}))
+		})
+	})
+
+	Context("When the query reaches the limit", func() {
+		It("splits the time range until no query reaches the limit and stitches the results", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 110, 120, 130, 160, 170, 190}, limit: 4}
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100, 110, 120, 130, 160, 170, 190}))
+			Expect(page.NextCursor).To(BeEmpty())
+			Expect(executor.queries).To(Equal([]timeRange{{100, 200}, {100, 150}, {100, 125}, {125, 150}, {150, 200}}))
+		})
+	})
+
+	for _, wholeEndSecond := range []bool{true, false} {
+		wholeEndSecond := wholeEndSecond
+
+		Context(fmt.Sprintf("When the events have milliseconds and the end of a query includes the whole second is %v", wholeEndSecond), func() {
+			It("returns every event once when the time range is split", func() {
+				executor := &fakeQueryExecutor{epochs: []int64{100, 124, 125, 149, 150, 160, 199}, offsetMillis: 500,
+					wholeEndSecond: wholeEndSecond, limit: 4}
+
+				page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+				Expect(err).To(BeNil())
+				Expect(eventEpochs(page)).To(Equal([]int64{100, 124, 125, 149, 150, 160, 199}))
+				Expect(page.Events[0].Timestamp.Nanosecond()).To(Equal(500 * int(time.Millisecond)))
+			})
+		})
+	}
+
+	Context("When there are more events than fit in a page", func() {
+		It("returns the cursor of the first time range not queried", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 110, 120, 130, 160, 170, 190}, limit: 4}
+
+			options.pageSize = 3
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100, 110, 120}))
+			Expect(page.NextCursor).To(Equal(queryparams.EncodeCursor(time.Unix(125, 0), time.Unix(100, 0), time.Unix(199, 0))))
+		})
+	})
+
+	Context("When a single query returns more events than fit in a page", func() {
+		It("trims the page at the start of a second and returns the cursor of that second", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 110, 110, 120, 130}, limit: 10}
+
+			options.resultsLimit = 10
+			options.pageSize = 2
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100}))
+			Expect(page.NextCursor).To(Equal(queryparams.EncodeCursor(time.Unix(110, 0), time.Unix(100, 0), time.Unix(199, 0))))
+		})
+
+		It("keeps the whole first second when it has more events than fit in a page", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 100, 100, 120}, limit: 10}
+
+			options.resultsLimit = 10
+			options.pageSize = 2
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100, 100, 100}))
+			Expect(page.NextCursor).To(Equal(queryparams.EncodeCursor(time.Unix(101, 0), time.Unix(100, 0), time.Unix(199, 0))))
+		})
+	})
+
+	Context("When the page starts at a cursor", func() {
+		It("keeps the start of the whole time range in the next cursor", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{150, 160, 170}, limit: 10}
+			options.resultsLimit = 10
+			options.pageSize = 2
+			params.StartTimeEpoch = 150
+
+			page, err := fetchPage(context.Background(), executor, params, 100, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{150, 160}))
+			Expect(page.NextCursor).To(Equal(queryparams.EncodeCursor(time.Unix(170, 0), time.Unix(100, 0), time.Unix(199, 0))))
+		})
+	})
+
+	Context("When a single second has more events than the limit", func() {
+		It("returns the events of that second it could obtain", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 100, 100, 100, 100}, limit: 4}
+			params.EndTimeEpoch = 100
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(page.Events).To(HaveLen(4))
+		})
+	})
+
+	Context("When the time range is bigger than the window", func() {
+		BeforeEach(func() {
+			options.windowSeconds = 25
+		})
+
+		It("queries each window separately and returns the events in order", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 130, 160, 190}, limit: 4}
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100, 130, 160, 190}))
+			Expect(page.NextCursor).To(BeEmpty())
+			Expect(executor.queries).To(Equal([]timeRange{{100, 125}, {125, 150}, {150, 175}, {175, 200}}))
+		})
+
+		It("queries the windows concurrently keeping the chronological order", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 101, 120, 121, 130, 160, 190}, limit: 4}
+			options.concurrency = 3
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100, 101, 120, 121, 130, 160, 190}))
+			Expect(page.NextCursor).To(BeEmpty())
+			Expect(executor.queries).To(ConsistOf([]timeRange{{100, 125}, {125, 150}, {150, 175}, {175, 200}, {100, 112}, {112, 125}}))
+		})
+
+		It("returns every event once when the events are in the last millisecond of a window", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{124, 125, 149, 150}, offsetMillis: 999, wholeEndSecond: true, limit: 4}
+			options.concurrency = 4
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{124, 125, 149, 150}))
+		})
+
+		It("stops querying when the scan budget is exhausted and returns the cursor of the first window not queried", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 130, 160, 190}, limit: 4, bytesPerQuery: 100}
+			options.concurrency = 2
+			options.scanBudgetBytes = 150
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100, 130}))
+			Expect(page.NextCursor).To(Equal(queryparams.EncodeCursor(time.Unix(150, 0), time.Unix(100, 0), time.Unix(199, 0))))
+			Expect(executor.queries).To(HaveLen(2))
+		})
+
+		It("shares the scan budget of the context with the previous pages", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 130, 160, 190}, limit: 4, bytesPerQuery: 100}
+			options.scanBudgetBytes = 1000
+			ctx, budget := WithScanBudget(context.Background(), 150)
+			budget.Add(100)
+
+			page, err := fetchPage(ctx, executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(BeNil())
+			Expect(eventEpochs(page)).To(Equal([]int64{100}))
+			Expect(page.NextCursor).To(Equal(queryparams.EncodeCursor(time.Unix(125, 0), time.Unix(100, 0), time.Unix(199, 0))))
+			Expect(budget.Exhausted()).To(BeTrue())
+		})
+
+		It("returns an error when any of the windows fails", func() {
+			executor := &fakeQueryExecutor{epochs: []int64{100, 130, 160, 190}, limit: 4, failingEpoch: 160}
+			options.concurrency = 4
+
+			page, err := fetchPage(context.Background(), executor, params, params.StartTimeEpoch, nil, options)
+
+			Expect(err).To(MatchError("query failed"))
+			Expect(page).To(BeNil())
+		})
+	})
+})
@@ -2,29 +2,60 @@ package db
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/pkg/errors"
 )
 
+// PrinterSubscriptionFetcher stores, retrieves and removes the subscriptions of the printers.
+// Every Put and Delete records the change in the history of the subscriptions of the printer.
 type PrinterSubscriptionFetcher interface {
+	Put(ctx context.Context, subscription *CCPrinterSubscriptionModel) error
+	Get(ctx context.Context, printerId string, accountId string) (CCPrinterSubscriptionModel, error)
 	GetPrinterSubscriptions(ctx context.Context, printerId string) ([]*CCPrinterSubscriptionModel, error)
+	QueryPrinterSubscriptions(ctx context.Context, printerId string, options QueryOptions) (*SubscriptionsPage, error)
+	GetPrinterSubscriptionHistory(ctx context.Context, printerId string, startTime, endTime time.Time) ([]*CCPrinterSubscriptionChangeModel, error)
+	GetSubscriptionsByAccount(ctx context.Context, accountId string, limit int64, pageToken string) (*SubscriptionsPage, error)
+	GetSubscriptionsByService(ctx context.Context, service Service, limit int64, pageToken string) (*SubscriptionsPage, error)
+	Delete(ctx context.Context, printerId string, accountId string) error
 }
 
+// Default names of the global secondary indexes of the CCPrinterSubscription table. The account index has AccountID
+// as partition key and the service index ServiceID, both with PrinterID as sort key and all the attributes projected.
+const (
+	DefaultAccountIndexName = "AccountID-PrinterID-index"
+	DefaultServiceIndexName = "ServiceID-PrinterID-index"
+)
+
+// DefaultHistoryTableName is the default name of the table where the changes of the subscriptions are recorded,
+// with PrinterID as partition key and ChangeKey as sort key.
+const DefaultHistoryTableName = "CCPrinterSubscriptionHistory"
+
+// MaxDeleteAttempts is the number of times that Delete reads and deletes a subscription that is modified between
+// the read and the deletion, before failing with ConcurrentDelErr.
+const MaxDeleteAttempts = 3
+
 type CCPrinterSubscriptionCollection struct {
-	*dynamodb.DynamoDB
-	tableName string
+	dynamodbiface.DynamoDBAPI
+	tableName        string
+	historyTableName string
+	accountIndexName string
+	serviceIndexName string
 }
 
-// NewCCPrinterSubscriptionCollection configures a Collection to connect to dynamo CCPrinterSubscription table
-// given a session and based on the environment variable table name
+// NewCCPrinterSubscriptionCollectionWithSession configures a Collection to connect to dynamo CCPrinterSubscription table
+// given a session and based on the environment variable table name. The names of its indexes and history table
+// default to DefaultAccountIndexName, DefaultServiceIndexName and DefaultHistoryTableName.
 func NewCCPrinterSubscriptionCollectionWithSession(s *session.Session) (*CCPrinterSubscriptionCollection, error) {
 	envVar := "TABLE_CC_PRINTER_SUBSCRIPTION"
 	tableName, exist := os.LookupEnv(envVar)
@@ -32,13 +63,34 @@ func NewCCPrinterSubscriptionCollectionWithSession(s *session.Session) (*CCPrint
 		return nil, errors.Errorf("you have to define the environment variable %s to work with dynamo", envVar)
 	}
 
+	return NewCCPrinterSubscriptionCollection(dynamodb.New(s), tableName,
+		lookupName(envVar+"_HISTORY", DefaultHistoryTableName),
+		lookupName(envVar+"_ACCOUNT_INDEX", DefaultAccountIndexName),
+		lookupName(envVar+"_SERVICE_INDEX", DefaultServiceIndexName)), nil
+}
+
+// NewCCPrinterSubscriptionCollection creates a Collection of the subscriptions stored in the dynamo table tableName,
+// with its indexes by account and by service, that records their changes in the table historyTableName.
+func NewCCPrinterSubscriptionCollection(svc dynamodbiface.DynamoDBAPI, tableName, historyTableName, accountIndexName, serviceIndexName string) *CCPrinterSubscriptionCollection {
 	return &CCPrinterSubscriptionCollection{
-		DynamoDB:  dynamodb.New(s),
-		tableName: tableName,
-	}, nil
+		DynamoDBAPI:      svc,
+		tableName:        tableName,
+		historyTableName: historyTableName,
+		accountIndexName: accountIndexName,
+		serviceIndexName: serviceIndexName,
+	}
 }
 
-// Put stores a subscription in dynamo
+// lookupName returns the name of the table or index in the environment variable envVar, or defaultName if it is
+// not defined or empty.
+func lookupName(envVar string, defaultName string) string {
+	if name, exist := os.LookupEnv(envVar); exist && name != "" {
+		return name
+	}
+	return defaultName
+}
+
+// Put stores a subscription in dynamo, together with its creation in the history, in a transaction
 func (col *CCPrinterSubscriptionCollection) Put(ctx context.Context, subscription *CCPrinterSubscriptionModel) error {
 
 	newSubscription, err := dynamodbattribute.MarshalMap(subscription)
@@ -47,30 +99,58 @@ func (col *CCPrinterSubscriptionCollection) Put(ctx context.Context, subscriptio
 	}
 	condition := aws.String("attribute_not_exists(PrinterID) AND attribute_not_exists(AccountID)")
 
-	input := &dynamodb.PutItemInput{
-		Item:                newSubscription,
-		ConditionExpression: condition,
-		TableName:           aws.String(col.tableName),
+	change, err := col.putChangeItem(newSubscriptionChange(ctx, SubscriptionCreated, subscription.PrinterID, subscription.AccountID, nil, subscription))
+	if err != nil {
+		return err
 	}
 
-	_, err = col.PutItemWithContext(ctx, input)
+	put := &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			Item:                newSubscription,
+			ConditionExpression: condition,
+			TableName:           aws.String(col.tableName),
+		},
+	}
 
-	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			switch awsErr.Code() {
-			case dynamodb.ErrCodeConditionalCheckFailedException:
-				return ConditionalPutErr
-			default:
-				return err
-			}
+	return col.writeTransaction(ctx, ConditionalPutErr, put, change)
+}
+
+// GetPrinterSubscriptions queries all subscriptions in dynamo for the specified printerID, following the pages of the
+// query until the last one.
+func (col *CCPrinterSubscriptionCollection) GetPrinterSubscriptions(ctx context.Context, printerId string) ([]*CCPrinterSubscriptionModel, error) {
+	var subscriptionsArr []*CCPrinterSubscriptionModel
+
+	options := QueryOptions{}
+	for {
+		page, err := col.QueryPrinterSubscriptions(ctx, printerId, options)
+		if err != nil {
+			return nil, err
+		}
+		subscriptionsArr = append(subscriptionsArr, page.Subscriptions...)
+
+		if page.NextPageToken == "" {
+			break
 		}
+		options.PageToken = page.NextPageToken
 	}
-	return nil
+
+	if len(subscriptionsArr) == 0 {
+		return nil, NotFoundErr
+	}
+	return subscriptionsArr, nil
 }
 
-// GetPrinterSubscriptions queries all subscriptions in dynamo for the specified printerID
-func (col *CCPrinterSubscriptionCollection) GetPrinterSubscriptions(ctx context.Context, printerId string) ([]*CCPrinterSubscriptionModel, error) {
+// QueryOptions are the options of the queries of pages of subscriptions. A Limit of 0 returns as many as fit in a
+// response of dynamo, and an empty PageToken the first page.
+type QueryOptions struct {
+	Limit          int64
+	PageToken      string
+	ConsistentRead bool
+}
 
+// QueryPrinterSubscriptions queries a page of the subscriptions in dynamo for the specified printerID, ordered by
+// accountID. The page may be empty even if it is not the last one.
+func (col *CCPrinterSubscriptionCollection) QueryPrinterSubscriptions(ctx context.Context, printerId string, options QueryOptions) (*SubscriptionsPage, error) {
 	queryInput := &dynamodb.QueryInput{
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":printerId": {
@@ -80,33 +160,159 @@ func (col *CCPrinterSubscriptionCollection) GetPrinterSubscriptions(ctx context.
 		KeyConditionExpression: aws.String("PrinterID = :printerId"),
 		TableName:              aws.String(col.tableName),
 	}
+	if options.ConsistentRead {
+		queryInput.ConsistentRead = aws.Bool(true)
+	}
+
+	return col.queryPage(ctx, queryInput, printerId, options)
+}
+
+// SubscriptionsPage is a page of the subscriptions of a query. NextPageToken is empty in the last page, otherwise
+// it is the token to get the following page.
+type SubscriptionsPage struct {
+	Subscriptions []*CCPrinterSubscriptionModel `json:"subscriptions"`
+	NextPageToken string                        `json:"next_page_token,omitempty"`
+}
+
+// GetSubscriptionsByAccount queries a page of up to limit subscriptions of the specified accountID, ordered by
+// printerID, with the index by account.
+func (col *CCPrinterSubscriptionCollection) GetSubscriptionsByAccount(ctx context.Context, accountId string, limit int64, pageToken string) (*SubscriptionsPage, error) {
+	return col.queryIndex(ctx, col.accountIndexName, "AccountID", accountId, limit, pageToken)
+}
+
+// GetSubscriptionsByService queries a page of up to limit subscriptions to the specified service, ordered by
+// printerID, with the index by service.
+func (col *CCPrinterSubscriptionCollection) GetSubscriptionsByService(ctx context.Context, service Service, limit int64, pageToken string) (*SubscriptionsPage, error) {
+	return col.queryIndex(ctx, col.serviceIndexName, "ServiceID", string(service), limit, pageToken)
+}
+
+// queryIndex queries a page of the subscriptions whose attribute (the partition key of indexName) is value.
+func (col *CCPrinterSubscriptionCollection) queryIndex(ctx context.Context, indexName string, attribute string, value string, limit int64, pageToken string) (*SubscriptionsPage, error) {
+	queryInput := &dynamodb.QueryInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#key": aws.String(attribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":value": {
+				S: aws.String(value),
+			},
+		},
+		KeyConditionExpression: aws.String("#key = :value"),
+		IndexName:              aws.String(indexName),
+		TableName:              aws.String(col.tableName),
+	}
+
+	return col.queryPage(ctx, queryInput, value, QueryOptions{Limit: limit, PageToken: pageToken})
+}
+
+// queryPage runs queryInput, the query of the partition key value partition, starting at the page token of options
+// and with its limit, and returns the page of subscriptions of the result.
+func (col *CCPrinterSubscriptionCollection) queryPage(ctx context.Context, queryInput *dynamodb.QueryInput, partition string, options QueryOptions) (*SubscriptionsPage, error) {
+	indexName := aws.StringValue(queryInput.IndexName)
+	if options.Limit > 0 {
+		queryInput.Limit = aws.Int64(options.Limit)
+	}
+	if options.PageToken != "" {
+		startKey, err := decodePageToken(options.PageToken, indexName, partition)
+		if err != nil {
+			return nil, err
+		}
+		queryInput.ExclusiveStartKey = startKey
+	}
 
 	result, err := col.QueryWithContext(ctx, queryInput)
 	if err != nil {
 		return nil, err
 	}
-	if len(result.Items) == 0 {
-		return nil, NotFoundErr
-	}
-
-	var subscriptionsArr []*CCPrinterSubscriptionModel
 
+	page := &SubscriptionsPage{Subscriptions: make([]*CCPrinterSubscriptionModel, 0, len(result.Items))}
 	for _, item := range result.Items {
 		subscription := CCPrinterSubscriptionModel{}
-		err := dynamodbattribute.UnmarshalMap(item, &subscription)
+		if err := dynamodbattribute.UnmarshalMap(item, &subscription); err != nil {
+			return nil, fmt.Errorf("error unmarshalling printer subscription. cause: %w", err)
+		}
+		page.Subscriptions = append(page.Subscriptions, &subscription)
+	}
+
+	if len(result.LastEvaluatedKey) > 0 {
+		page.NextPageToken, err = encodePageToken(result.LastEvaluatedKey, indexName, partition)
 		if err != nil {
 			return nil, err
 		}
-		subscriptionsArr = append(subscriptionsArr, &subscription)
 	}
+	return page, nil
+}
 
-	return subscriptionsArr, nil
+// pageToken is the content of the page tokens: the LastEvaluatedKey of a query (its attributes are strings), with
+// the index and the partition key value of the query, so the token can't be used in another query.
+type pageToken struct {
+	Index     string            `json:"index"`
+	Partition string            `json:"partition"`
+	Key       map[string]string `json:"key"`
+}
+
+// encodePageToken returns the LastEvaluatedKey of a query of the partition of indexName as an opaque token.
+func encodePageToken(lastEvaluatedKey map[string]*dynamodb.AttributeValue, indexName string, partition string) (string, error) {
+	token := pageToken{Index: indexName, Partition: partition, Key: make(map[string]string, len(lastEvaluatedKey))}
+	if err := dynamodbattribute.UnmarshalMap(lastEvaluatedKey, &token.Key); err != nil {
+		return "", fmt.Errorf("error unmarshalling last evaluated key. cause: %w", err)
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageToken returns the ExclusiveStartKey of the token of encodePageToken, or InvalidPageTokenErr if it is not
+// a valid token of a query of the partition of indexName.
+func decodePageToken(encoded string, indexName string, partition string) (map[string]*dynamodb.AttributeValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, InvalidPageTokenErr
+	}
+
+	var token pageToken
+	if err := json.Unmarshal(data, &token); err != nil || len(token.Key) == 0 {
+		return nil, InvalidPageTokenErr
+	}
+	if token.Index != indexName || token.Partition != partition {
+		return nil, InvalidPageTokenErr
+	}
+
+	startKey, err := dynamodbattribute.MarshalMap(token.Key)
+	if err != nil {
+		return nil, InvalidPageTokenErr
+	}
+	return startKey, nil
 }
 
 // Get retrieves the subscription from dynamo for the specified printerID and accountID
 func (col *CCPrinterSubscriptionCollection) Get(ctx context.Context, printerId string, accountId string) (CCPrinterSubscriptionModel, error) {
+	return col.get(ctx, printerId, accountId, false)
+}
+
+// get retrieves the subscription for the specified printerID and accountID, with a strongly consistent read if
+// consistentRead is true.
+func (col *CCPrinterSubscriptionCollection) get(ctx context.Context, printerId string, accountId string, consistentRead bool) (CCPrinterSubscriptionModel, error) {
+	item, err := col.getItem(ctx, printerId, accountId, consistentRead)
+	if err != nil {
+		return CCPrinterSubscriptionModel{}, err
+	}
+
 	subscription := CCPrinterSubscriptionModel{}
+	err = dynamodbattribute.UnmarshalMap(item, &subscription)
+	if err != nil {
+		return CCPrinterSubscriptionModel{}, fmt.Errorf("error unmarshalling printer subscription. cause: %w", err)
+	}
 
+	return subscription, err
+}
+
+// getItem retrieves the item of the subscription for the specified printerID and accountID, with a strongly
+// consistent read if consistentRead is true.
+func (col *CCPrinterSubscriptionCollection) getItem(ctx context.Context, printerId string, accountId string, consistentRead bool) (map[string]*dynamodb.AttributeValue, error) {
 	result, err := col.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(col.tableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -117,52 +323,97 @@ func (col *CCPrinterSubscriptionCollection) Get(ctx context.Context, printerId s
 				S: aws.String(accountId),
 			},
 		},
+		ConsistentRead: aws.Bool(consistentRead),
 	})
 
 	if err != nil {
-		return CCPrinterSubscriptionModel{}, err
+		return nil, err
 	}
 
 	if len(result.Item) == 0 {
-		return CCPrinterSubscriptionModel{}, NotFoundErr
+		return nil, NotFoundErr
 	}
 
-	err = dynamodbattribute.UnmarshalMap(result.Item, &subscription)
+	return result.Item, nil
+}
+
+// Delete removes a row of CCPrinterSubscriptions table based on the printerID and accountID specified, and records
+// the deleted subscription in the history, in a transaction. It retries up to MaxDeleteAttempts times on conflicts.
+func (col *CCPrinterSubscriptionCollection) Delete(ctx context.Context, printerId string, accountId string) error {
+	for attempt := 1; ; attempt++ {
+		err := col.deleteUnchanged(ctx, printerId, accountId)
+		if err != ConcurrentDelErr || attempt == MaxDeleteAttempts {
+			return err
+		}
+	}
+}
+
+// deleteUnchanged reads the subscription and deletes it, recording it in the history, in a transaction with the
+// condition that the subscription still has the attributes read. It returns ConcurrentDelErr if it doesn't.
+func (col *CCPrinterSubscriptionCollection) deleteUnchanged(ctx context.Context, printerId string, accountId string) error {
+	item, err := col.getItem(ctx, printerId, accountId, true)
+	if err == NotFoundErr {
+		return ConditionalDelErr
+	}
 	if err != nil {
-		return CCPrinterSubscriptionModel{}, fmt.Errorf("error unmarshalling printer subscription. cause: %w", err)
+		return err
 	}
 
-	return subscription, err
-}
+	previous := CCPrinterSubscriptionModel{}
+	if err := dynamodbattribute.UnmarshalMap(item, &previous); err != nil {
+		return fmt.Errorf("error unmarshalling printer subscription. cause: %w", err)
+	}
 
-// Delete removes a row of CCPrinterSubscriptions table based on the printerID and accountID specified
-func (col *CCPrinterSubscriptionCollection) Delete(ctx context.Context, printerId string, accountId string) error {
+	change, err := col.putChangeItem(newSubscriptionChange(ctx, SubscriptionDeleted, printerId, accountId, &previous, nil))
+	if err != nil {
+		return err
+	}
 
-	condition := aws.String("attribute_exists(PrinterID) AND attribute_exists(AccountID)")
-	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String(col.tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"PrinterID": {
-				S: aws.String(printerId),
-			},
-			"AccountID": {
-				S: aws.String(accountId),
+	condition, names, values := unchangedItemCondition(item)
+	del := &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName: aws.String(col.tableName),
+			Key: map[string]*dynamodb.AttributeValue{
+				"PrinterID": {
+					S: aws.String(printerId),
+				},
+				"AccountID": {
+					S: aws.String(accountId),
+				},
 			},
+			ConditionExpression:       condition,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
 		},
-		ConditionExpression: condition,
 	}
 
-	_, err := col.DeleteItemWithContext(ctx, input)
+	return col.writeTransaction(ctx, ConcurrentDelErr, del, change)
+}
 
-	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			switch awsErr.Code() {
-			case dynamodb.ErrCodeConditionalCheckFailedException:
-				return ConditionalDelErr
-			default:
-				return err
-			}
+// unchangedItemCondition returns the condition expression, with its attribute names and values, that an item still
+// exists with the same attributes as item.
+func unchangedItemCondition(item map[string]*dynamodb.AttributeValue) (*string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	attributes := make([]string, 0, len(item))
+	for attribute := range item {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+
+	condition := "attribute_exists(PrinterID) AND attribute_exists(AccountID)"
+	names := make(map[string]*string)
+	values := make(map[string]*dynamodb.AttributeValue)
+	for i, attribute := range attributes {
+		if attribute == "PrinterID" || attribute == "AccountID" {
+			continue
 		}
+		name, value := fmt.Sprintf("#attr%d", i), fmt.Sprintf(":attr%d", i)
+		names[name] = aws.String(attribute)
+		values[value] = item[attribute]
+		condition += " AND " + name + " = " + value
+	}
+
+	if len(values) == 0 {
+		return aws.String(condition), nil, nil
 	}
-	return nil
+	return aws.String(condition), names, values
 }
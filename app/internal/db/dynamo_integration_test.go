@@ -1,3 +1,6 @@
+//go:build integration
+// +build integration
+
 package db_test
 
 import (
@@ -73,6 +76,37 @@ var _ = Describe("CCPrinterSubscription integration tests", func() {
 			Expect(len(subscriptions)).To(BeEquivalentTo(2))
 		})
 
+		It("Should query the printer subscriptions page by page", func() {
+			firstPage, err := ccPrinterSubscriptionCollection.QueryPrinterSubscriptions(ctx, printerId2, QueryOptions{Limit: 1})
+			Expect(err).To(BeNil())
+			Expect(firstPage.Subscriptions).To(HaveLen(1))
+			Expect(firstPage.NextPageToken).NotTo(BeEmpty())
+
+			secondPage, err := ccPrinterSubscriptionCollection.QueryPrinterSubscriptions(ctx, printerId2,
+				QueryOptions{Limit: 1, PageToken: firstPage.NextPageToken, ConsistentRead: true})
+			Expect(err).To(BeNil())
+			Expect(secondPage.Subscriptions).To(HaveLen(1))
+			Expect(secondPage.Subscriptions[0].AccountID).NotTo(Equal(firstPage.Subscriptions[0].AccountID))
+
+			lastPage, err := ccPrinterSubscriptionCollection.QueryPrinterSubscriptions(ctx, printerId2,
+				QueryOptions{Limit: 1, PageToken: secondPage.NextPageToken})
+			Expect(err).To(BeNil())
+			Expect(lastPage.Subscriptions).To(BeEmpty())
+			Expect(lastPage.NextPageToken).To(BeEmpty())
+		})
+
+		It("Should read the subscription just added with a consistent query", func() {
+			tempSubscription := createSubscription(printerIDFake, accFake, fakeServId)
+			Expect(ccPrinterSubscriptionCollection.Put(ctx, tempSubscription)).To(BeNil())
+			defer ccPrinterSubscriptionCollection.Delete(ctx, tempSubscription.PrinterID, tempSubscription.AccountID)
+
+			page, err := ccPrinterSubscriptionCollection.QueryPrinterSubscriptions(ctx, printerIDFake, QueryOptions{ConsistentRead: true})
+
+			Expect(err).To(BeNil())
+			Expect(page.Subscriptions).To(HaveLen(1))
+			Expect(page.Subscriptions[0].AccountID).To(BeEquivalentTo(accFake))
+		})
+
 		It("Should return error while attempted to retrieve non existing printer subscriptions", func() {
 			_, err := ccPrinterSubscriptionCollection.GetPrinterSubscriptions(ctx, "fakePrinterId")
 
@@ -101,6 +135,70 @@ var _ = Describe("CCPrinterSubscription integration tests", func() {
 
 		})
 
+		It("Should get the subscriptions of an account", func() {
+			page, err := ccPrinterSubscriptionCollection.GetSubscriptionsByAccount(ctx, accountId2, 0, "")
+
+			Expect(err).To(BeNil())
+			Expect(page.Subscriptions).To(HaveLen(1))
+			Expect(page.Subscriptions[0].PrinterID).To(BeEquivalentTo(printerId2))
+			Expect(page.NextPageToken).To(BeEmpty())
+		})
+
+		It("Should get the subscriptions to a service page by page", func() {
+			extraSubscription := createSubscription(printerId1, accountId2, ServiceSeals)
+			Expect(ccPrinterSubscriptionCollection.Put(ctx, extraSubscription)).To(BeNil())
+			defer ccPrinterSubscriptionCollection.Delete(ctx, extraSubscription.PrinterID, extraSubscription.AccountID)
+
+			firstPage, err := ccPrinterSubscriptionCollection.GetSubscriptionsByService(ctx, ServiceSeals, 1, "")
+			Expect(err).To(BeNil())
+			Expect(firstPage.Subscriptions).To(HaveLen(1))
+			Expect(firstPage.NextPageToken).NotTo(BeEmpty())
+
+			secondPage, err := ccPrinterSubscriptionCollection.GetSubscriptionsByService(ctx, ServiceSeals, 1, firstPage.NextPageToken)
+			Expect(err).To(BeNil())
+			Expect(secondPage.Subscriptions).To(HaveLen(1))
+			Expect(secondPage.Subscriptions[0].PrinterID).NotTo(Equal(firstPage.Subscriptions[0].PrinterID))
+		})
+
+		It("Should return error with an invalid page token", func() {
+			_, err := ccPrinterSubscriptionCollection.GetSubscriptionsByAccount(ctx, accountId1, 0, "not a token")
+
+			Expect(err).To(BeEquivalentTo(InvalidPageTokenErr))
+		})
+
+		It("Should record the creation and the deletion of a subscription in the history", func() {
+			startTime := time.Now().Add(-time.Second)
+			actorCtx := WithActor(ctx, "integration-test")
+			tempSubscription := createSubscription(printerIDFake, accFake, fakeServId)
+
+			Expect(ccPrinterSubscriptionCollection.Put(actorCtx, tempSubscription)).To(BeNil())
+			Expect(ccPrinterSubscriptionCollection.Delete(actorCtx, tempSubscription.PrinterID, tempSubscription.AccountID)).To(BeNil())
+
+			changes, err := ccPrinterSubscriptionCollection.GetPrinterSubscriptionHistory(ctx, printerIDFake, startTime, time.Now())
+			Expect(err).To(BeNil())
+			Expect(changes).To(HaveLen(2))
+
+			Expect(changes[0].Action).To(Equal(SubscriptionCreated))
+			Expect(changes[0].Actor).To(Equal("integration-test"))
+			Expect(changes[0].Previous).To(BeNil())
+			Expect(changes[0].Current).To(Equal(tempSubscription))
+
+			Expect(changes[1].Action).To(Equal(SubscriptionDeleted))
+			Expect(changes[1].Previous).To(Equal(tempSubscription))
+			Expect(changes[1].Current).To(BeNil())
+		})
+
+		It("Should not record a failed deletion in the history", func() {
+			startTime := time.Now().Add(-time.Second)
+
+			err := ccPrinterSubscriptionCollection.Delete(ctx, printerIDFake, accFake)
+			Expect(err).To(BeEquivalentTo(ConditionalDelErr))
+
+			changes, err := ccPrinterSubscriptionCollection.GetPrinterSubscriptionHistory(ctx, printerIDFake, startTime, time.Now())
+			Expect(err).To(BeNil())
+			Expect(changes).To(BeEmpty())
+		})
+
 		It("Should return error retrieving unexistent item", func() {
 			err := ccPrinterSubscriptionCollection.Delete(ctx, printerIDFake, accFake)
 			Expect(err).NotTo(BeNil())
@@ -0,0 +1,172 @@
+package db_test
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+)
+
+// fakeSubscriptionTable is a dynamo subscription table that always returns item, cancels the first cancellations
+// transactions by a failed condition, and answers every query with a page ending at lastEvaluatedKey.
+type fakeSubscriptionTable struct {
+	dynamodbiface.DynamoDBAPI
+	item             map[string]*dynamodb.AttributeValue
+	cancellations    int
+	gets             int
+	transactions     []*dynamodb.TransactWriteItemsInput
+	lastEvaluatedKey map[string]*dynamodb.AttributeValue
+	queries          []*dynamodb.QueryInput
+}
+
+func (table *fakeSubscriptionTable) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, options ...request.Option) (*dynamodb.QueryOutput, error) {
+	table.queries = append(table.queries, input)
+	return &dynamodb.QueryOutput{LastEvaluatedKey: table.lastEvaluatedKey}, nil
+}
+
+func (table *fakeSubscriptionTable) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, options ...request.Option) (*dynamodb.GetItemOutput, error) {
+	table.gets++
+	return &dynamodb.GetItemOutput{Item: table.item}, nil
+}
+
+func (table *fakeSubscriptionTable) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, options ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	table.transactions = append(table.transactions, input)
+	if len(table.transactions) <= table.cancellations {
+		return nil, &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}, {Code: aws.String("None")}},
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+var _ = Describe("CCPrinterSubscriptionCollection Delete", func() {
+	var table *fakeSubscriptionTable
+	var collection *CCPrinterSubscriptionCollection
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		table = &fakeSubscriptionTable{
+			item: map[string]*dynamodb.AttributeValue{
+				"PrinterID":             {S: aws.String("Y0U23A!MY97F1T00H")},
+				"AccountID":             {S: aws.String("account")},
+				"ServiceID":             {S: aws.String(string(ServicePrintOS))},
+				"RegistrationTimeEpoch": {N: aws.String("1600000000")},
+			},
+		}
+		collection = NewCCPrinterSubscriptionCollection(table, "subscriptions", "history", DefaultAccountIndexName, DefaultServiceIndexName)
+	})
+
+	It("deletes the subscription only if it still has the attributes read", func() {
+		Expect(collection.Delete(ctx, "Y0U23A!MY97F1T00H", "account")).To(Succeed())
+
+		Expect(table.transactions).To(HaveLen(1))
+		del := table.transactions[0].TransactItems[0].Delete
+		Expect(aws.StringValue(del.ConditionExpression)).To(ContainSubstring("attribute_exists(PrinterID)"))
+		conditions := make(map[string]string)
+		for name, attribute := range del.ExpressionAttributeNames {
+			value := del.ExpressionAttributeValues[":"+name[1:]]
+			Expect(aws.StringValue(del.ConditionExpression)).To(ContainSubstring(name + " = :" + name[1:]))
+			conditions[aws.StringValue(attribute)] = aws.StringValue(value.S) + aws.StringValue(value.N)
+		}
+		Expect(conditions).To(Equal(map[string]string{"ServiceID": string(ServicePrintOS), "RegistrationTimeEpoch": "1600000000"}))
+		Expect(aws.StringValue(table.transactions[0].TransactItems[1].Put.TableName)).To(Equal("history"))
+	})
+
+	It("reads and deletes again the subscription modified after reading it", func() {
+		table.cancellations = 1
+
+		Expect(collection.Delete(ctx, "Y0U23A!MY97F1T00H", "account")).To(Succeed())
+
+		Expect(table.gets).To(Equal(2))
+		Expect(table.transactions).To(HaveLen(2))
+	})
+
+	It("fails with a conflict when the subscription keeps being modified", func() {
+		table.cancellations = MaxDeleteAttempts
+
+		err := collection.Delete(ctx, "Y0U23A!MY97F1T00H", "account")
+
+		Expect(err).To(Equal(ConcurrentDelErr))
+		Expect(table.transactions).To(HaveLen(MaxDeleteAttempts))
+	})
+
+	It("fails when the subscription doesn't exist", func() {
+		table.item = nil
+
+		err := collection.Delete(ctx, "Y0U23A!MY97F1T00H", "account")
+
+		Expect(err).To(Equal(ConditionalDelErr))
+		Expect(table.transactions).To(BeEmpty())
+	})
+})
+
+var _ = Describe("CCPrinterSubscriptionCollection page tokens", func() {
+	var table *fakeSubscriptionTable
+	var collection *CCPrinterSubscriptionCollection
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		table = &fakeSubscriptionTable{
+			lastEvaluatedKey: map[string]*dynamodb.AttributeValue{
+				"PrinterID": {S: aws.String("Y0U23A!MY97F1T00H")},
+				"AccountID": {S: aws.String("account")},
+			},
+		}
+		collection = NewCCPrinterSubscriptionCollection(table, "subscriptions", "history", DefaultAccountIndexName, DefaultServiceIndexName)
+	})
+
+	It("continues the query of the token at its last evaluated key", func() {
+		page, err := collection.GetSubscriptionsByAccount(ctx, "account", 1, "")
+		Expect(err).To(BeNil())
+		Expect(page.NextPageToken).NotTo(BeEmpty())
+
+		_, err = collection.GetSubscriptionsByAccount(ctx, "account", 1, page.NextPageToken)
+
+		Expect(err).To(BeNil())
+		Expect(table.queries).To(HaveLen(2))
+		Expect(table.queries[1].ExclusiveStartKey).To(Equal(table.lastEvaluatedKey))
+	})
+
+	It("rejects the token of a query of another partition", func() {
+		page, err := collection.GetSubscriptionsByAccount(ctx, "account", 1, "")
+		Expect(err).To(BeNil())
+
+		_, err = collection.GetSubscriptionsByAccount(ctx, "other-account", 1, page.NextPageToken)
+
+		Expect(err).To(Equal(InvalidPageTokenErr))
+		Expect(table.queries).To(HaveLen(1))
+	})
+
+	It("rejects the token of a query of another index", func() {
+		page, err := collection.GetSubscriptionsByAccount(ctx, string(ServicePrintOS), 1, "")
+		Expect(err).To(BeNil())
+
+		_, err = collection.GetSubscriptionsByService(ctx, ServicePrintOS, 1, page.NextPageToken)
+
+		Expect(err).To(Equal(InvalidPageTokenErr))
+		Expect(table.queries).To(HaveLen(1))
+	})
+
+	It("rejects the token of a query of the printers in a query of an index", func() {
+		page, err := collection.QueryPrinterSubscriptions(ctx, "account", QueryOptions{Limit: 1})
+		Expect(err).To(BeNil())
+
+		_, err = collection.GetSubscriptionsByAccount(ctx, "account", 1, page.NextPageToken)
+
+		Expect(err).To(Equal(InvalidPageTokenErr))
+		Expect(table.queries).To(HaveLen(1))
+	})
+
+	It("rejects a malformed token", func() {
+		_, err := collection.GetSubscriptionsByAccount(ctx, "account", 1, "???")
+
+		Expect(err).To(Equal(InvalidPageTokenErr))
+		Expect(table.queries).To(BeEmpty())
+	})
+})
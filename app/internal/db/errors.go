@@ -8,6 +8,13 @@ const (
 	NotFoundErr       = ConstError("element not found in database")
 	ConditionalPutErr = ConstError("ConstError trying to add duplicated item")
 	ConditionalDelErr = ConstError("ConstError deleting Item. It not exist")
+	ConcurrentDelErr  = ConstError("ConstError deleting Item. It was modified concurrently")
+
+	MalformedSubscriptionErr = ConstError("malformed printer subscription")
+	InvalidPrinterIDErr      = ConstError("invalid printer id of the printer subscription")
+	MissingAccountIDErr      = ConstError("missing account id of the printer subscription")
+	UnsupportedServiceErr    = ConstError("unsupported service of the printer subscription")
+	InvalidPageTokenErr      = ConstError("invalid page token")
 
 	ExpressionBuilderErr = ConstError("element not found in database")
 	MarshallErr          = ConstError("ConstError marshalling data")
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Actions of the changes of the subscriptions.
+const (
+	SubscriptionCreated = "created"
+	SubscriptionDeleted = "deleted"
+)
+
+// UnknownActor is the actor of the changes made with a context without actor.
+const UnknownActor = "unknown"
+
+// CCPrinterSubscriptionChangeModel is an immutable record of a creation or deletion of a subscription of a printer.
+// ChangeKey is the zero padded epoch in milliseconds of the change followed by the account and the action.
+type CCPrinterSubscriptionChangeModel struct {
+	PrinterID            string                      `json:"PrinterID"` // Primary Key
+	ChangeKey            string                      `json:"ChangeKey"` // Sort Key
+	AccountID            string                      `json:"AccountID"`
+	Action               string                      `json:"Action"`
+	Actor                string                      `json:"Actor"`
+	ChangedAtEpochMillis int64                       `json:"ChangedAtEpochMillis"`
+	Previous             *CCPrinterSubscriptionModel `json:"Previous,omitempty"`
+	Current              *CCPrinterSubscriptionModel `json:"Current,omitempty"`
+}
+
+// ChangedAt returns the time of the change.
+func (change *CCPrinterSubscriptionChangeModel) ChangedAt() time.Time {
+	return time.Unix(0, change.ChangedAtEpochMillis*int64(time.Millisecond)).UTC()
+}
+
+// newSubscriptionChange returns the change made now by the actor of ctx to the subscription of the printer with the
+// account, from previous to current.
+func newSubscriptionChange(ctx context.Context, action string, printerId string, accountId string, previous, current *CCPrinterSubscriptionModel) *CCPrinterSubscriptionChangeModel {
+	changedAt := time.Now().UnixNano() / int64(time.Millisecond)
+	return &CCPrinterSubscriptionChangeModel{
+		PrinterID:            printerId,
+		ChangeKey:            changeKeyPrefix(changedAt) + "#" + accountId + "#" + action,
+		AccountID:            accountId,
+		Action:               action,
+		Actor:                ActorFromContext(ctx),
+		ChangedAtEpochMillis: changedAt,
+		Previous:             previous,
+		Current:              current,
+	}
+}
+
+// changeKeyPrefix returns the beginning of the ChangeKey of the changes made at epochMillis.
+func changeKeyPrefix(epochMillis int64) string {
+	return fmt.Sprintf("%013d", epochMillis)
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx whose changes to the subscriptions are recorded as made by actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of ctx, or UnknownActor if it has none.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return UnknownActor
+}
+
+// putChangeItem returns the item of the transactions that stores change in the history table. It fails if there is
+// already a change with its keys, so the changes are never overwritten.
+func (col *CCPrinterSubscriptionCollection) putChangeItem(change *CCPrinterSubscriptionChangeModel) (*dynamodb.TransactWriteItem, error) {
+	item, err := dynamodbattribute.MarshalMap(change)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling printer subscription change. cause: %w", err)
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(ChangeKey)"),
+			TableName:           aws.String(col.historyTableName),
+		},
+	}, nil
+}
+
+// writeTransaction writes items in a transaction. It returns conditionalErr if any of their conditions fails.
+func (col *CCPrinterSubscriptionCollection) writeTransaction(ctx context.Context, conditionalErr error, items ...*dynamodb.TransactWriteItem) error {
+	_, err := col.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err == nil {
+		return nil
+	}
+
+	if cancelled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+		for _, reason := range cancelled.CancellationReasons {
+			if aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+				return conditionalErr
+			}
+		}
+	}
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return conditionalErr
+	}
+	return err
+}
+
+// GetPrinterSubscriptionHistory queries in the history table the changes of the subscriptions of the specified
+// printerID between startTime and endTime (both included), in chronological order.
+func (col *CCPrinterSubscriptionCollection) GetPrinterSubscriptionHistory(ctx context.Context, printerId string, startTime, endTime time.Time) ([]*CCPrinterSubscriptionChangeModel, error) {
+	queryInput := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":printerId": {
+				S: aws.String(printerId),
+			},
+			":from": {
+				S: aws.String(changeKeyPrefix(startTime.UnixNano() / int64(time.Millisecond))),
+			},
+			":to": {
+				// "~" is after the separator "#", so the changes of the last millisecond are included
+				S: aws.String(changeKeyPrefix(endTime.UnixNano()/int64(time.Millisecond)) + "~"),
+			},
+		},
+		KeyConditionExpression: aws.String("PrinterID = :printerId AND ChangeKey BETWEEN :from AND :to"),
+		TableName:              aws.String(col.historyTableName),
+	}
+
+	changes := make([]*CCPrinterSubscriptionChangeModel, 0)
+	var unmarshalErr error
+	err := col.QueryPagesWithContext(ctx, queryInput, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			change := CCPrinterSubscriptionChangeModel{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &change); unmarshalErr != nil {
+				return false
+			}
+			changes = append(changes, &change)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("error unmarshalling printer subscription change. cause: %w", unmarshalErr)
+	}
+	return changes, nil
+}
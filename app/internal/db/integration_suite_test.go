@@ -0,0 +1,31 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+)
+
+var ccPrinterSubscriptionCollection *db.CCPrinterSubscriptionCollection
+
+var _ = BeforeSuite(func() {
+
+	var err error
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			Region: aws.String(endpoints.UsEast1RegionID),
+		},
+	}))
+
+	ccPrinterSubscriptionCollection, err = db.NewCCPrinterSubscriptionCollectionWithSession(sess)
+	Expect(err).To(BeNil())
+})
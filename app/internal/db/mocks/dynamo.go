@@ -9,6 +9,7 @@ import (
 	context "context"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockPrinterSubscriptionFetcher is a mock of PrinterSubscriptionFetcher interface
@@ -34,6 +35,35 @@ func (m *MockPrinterSubscriptionFetcher) EXPECT() *MockPrinterSubscriptionFetche
 	return m.recorder
 }
 
+// Put mocks base method
+func (m *MockPrinterSubscriptionFetcher) Put(ctx context.Context, subscription *db.CCPrinterSubscriptionModel) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", ctx, subscription)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put
+func (mr *MockPrinterSubscriptionFetcherMockRecorder) Put(ctx, subscription interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).Put), ctx, subscription)
+}
+
+// Get mocks base method
+func (m *MockPrinterSubscriptionFetcher) Get(ctx context.Context, printerId, accountId string) (db.CCPrinterSubscriptionModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, printerId, accountId)
+	ret0, _ := ret[0].(db.CCPrinterSubscriptionModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockPrinterSubscriptionFetcherMockRecorder) Get(ctx, printerId, accountId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).Get), ctx, printerId, accountId)
+}
+
 // GetPrinterSubscriptions mocks base method
 func (m *MockPrinterSubscriptionFetcher) GetPrinterSubscriptions(ctx context.Context, printerId string) ([]*db.CCPrinterSubscriptionModel, error) {
 	m.ctrl.T.Helper()
@@ -48,3 +78,77 @@ func (mr *MockPrinterSubscriptionFetcherMockRecorder) GetPrinterSubscriptions(ct
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPrinterSubscriptions", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).GetPrinterSubscriptions), ctx, printerId)
 }
+
+// QueryPrinterSubscriptions mocks base method
+func (m *MockPrinterSubscriptionFetcher) QueryPrinterSubscriptions(ctx context.Context, printerId string, options db.QueryOptions) (*db.SubscriptionsPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryPrinterSubscriptions", ctx, printerId, options)
+	ret0, _ := ret[0].(*db.SubscriptionsPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryPrinterSubscriptions indicates an expected call of QueryPrinterSubscriptions
+func (mr *MockPrinterSubscriptionFetcherMockRecorder) QueryPrinterSubscriptions(ctx, printerId, options interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryPrinterSubscriptions", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).QueryPrinterSubscriptions), ctx, printerId, options)
+}
+
+// GetPrinterSubscriptionHistory mocks base method
+func (m *MockPrinterSubscriptionFetcher) GetPrinterSubscriptionHistory(ctx context.Context, printerId string, startTime, endTime time.Time) ([]*db.CCPrinterSubscriptionChangeModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPrinterSubscriptionHistory", ctx, printerId, startTime, endTime)
+	ret0, _ := ret[0].([]*db.CCPrinterSubscriptionChangeModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPrinterSubscriptionHistory indicates an expected call of GetPrinterSubscriptionHistory
+func (mr *MockPrinterSubscriptionFetcherMockRecorder) GetPrinterSubscriptionHistory(ctx, printerId, startTime, endTime interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPrinterSubscriptionHistory", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).GetPrinterSubscriptionHistory), ctx, printerId, startTime, endTime)
+}
+
+// GetSubscriptionsByAccount mocks base method
+func (m *MockPrinterSubscriptionFetcher) GetSubscriptionsByAccount(ctx context.Context, accountId string, limit int64, pageToken string) (*db.SubscriptionsPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscriptionsByAccount", ctx, accountId, limit, pageToken)
+	ret0, _ := ret[0].(*db.SubscriptionsPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptionsByAccount indicates an expected call of GetSubscriptionsByAccount
+func (mr *MockPrinterSubscriptionFetcherMockRecorder) GetSubscriptionsByAccount(ctx, accountId, limit, pageToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptionsByAccount", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).GetSubscriptionsByAccount), ctx, accountId, limit, pageToken)
+}
+
+// GetSubscriptionsByService mocks base method
+func (m *MockPrinterSubscriptionFetcher) GetSubscriptionsByService(ctx context.Context, service db.Service, limit int64, pageToken string) (*db.SubscriptionsPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscriptionsByService", ctx, service, limit, pageToken)
+	ret0, _ := ret[0].(*db.SubscriptionsPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptionsByService indicates an expected call of GetSubscriptionsByService
+func (mr *MockPrinterSubscriptionFetcherMockRecorder) GetSubscriptionsByService(ctx, service, limit, pageToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptionsByService", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).GetSubscriptionsByService), ctx, service, limit, pageToken)
+}
+
+// Delete mocks base method
+func (m *MockPrinterSubscriptionFetcher) Delete(ctx context.Context, printerId, accountId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, printerId, accountId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockPrinterSubscriptionFetcherMockRecorder) Delete(ctx, printerId, accountId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPrinterSubscriptionFetcher)(nil).Delete), ctx, printerId, accountId)
+}
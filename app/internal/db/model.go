@@ -1,5 +1,7 @@
 package db
 
+import "strings"
+
 const PrinterIdSeparator = "!"
 
 type CCPrinterSubscriptionModel struct {
@@ -11,6 +13,30 @@ type CCPrinterSubscriptionModel struct {
 	RegistrationTimeEpoch int64   `json:"RegistrationTimeEpoch,omitempty"`
 }
 
+// Validate returns an error if the subscription can't be stored: its PrinterID has to be a product number and
+// a serial number joined by PrinterIdSeparator, it needs an AccountID and its ServiceID has to be one of Services.
+func (subscription *CCPrinterSubscriptionModel) Validate() error {
+	parts := strings.Split(subscription.PrinterID, PrinterIdSeparator)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return InvalidPrinterIDErr
+	}
+	if subscription.ProductNumber != "" && subscription.ProductNumber != parts[0] {
+		return InvalidPrinterIDErr
+	}
+	if subscription.SerialNumber != "" && subscription.SerialNumber != parts[1] {
+		return InvalidPrinterIDErr
+	}
+
+	if strings.TrimSpace(subscription.AccountID) == "" {
+		return MissingAccountIDErr
+	}
+
+	if !subscription.ServiceID.IsValid() {
+		return UnsupportedServiceErr
+	}
+	return nil
+}
+
 type Service string
 
 const (
@@ -21,3 +47,16 @@ const (
 	ServiceFibo24          = "fibo24"
 	ServicePPU             = "HP-PPU"
 )
+
+// Services are the services a printer can be subscribed to.
+var Services = []Service{ServicePrintOS, ServiceLatexGO, ServiceSeals, ServiceFibo24, ServicePPU}
+
+// IsValid returns true if service is one of Services (they are case sensitive).
+func (service Service) IsValid() bool {
+	for _, valid := range Services {
+		if service == valid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+)
+
+// Attributes of the items of the query cache table. The table has CacheKey as partition key and ExpiresAt
+// configured as its TTL attribute, so dynamo deletes the expired entries. Encoding is gzip when Value is compressed.
+const (
+	queryCacheKeyAttribute       = "CacheKey"
+	queryCacheValueAttribute     = "Value"
+	queryCacheEncodingAttribute  = "Encoding"
+	queryCacheExpiresAtAttribute = "ExpiresAt"
+
+	queryCacheGzipEncoding = "gzip"
+)
+
+// MaxQueryCacheValueBytes is the maximum size of the (compressed) values stored in the query cache table. Dynamo
+// items can't be bigger than 400 KB, and the rest of the attributes need some room.
+const MaxQueryCacheValueBytes = 390 * 1024
+
+// QueryCacheCollection stores the results of the queries of AWS CloudWatch Insights in a dynamo table.
+// It satisfies the interface cloudwatch.QueryCache.
+type QueryCacheCollection struct {
+	dynamodbiface.DynamoDBAPI
+	tableName string
+	ttl       time.Duration
+}
+
+// NewQueryCacheCollectionWithSession configures a Collection to connect to dynamo query cache table
+// given a session and based on the environment variable table name. The stored entries expire after ttl.
+func NewQueryCacheCollectionWithSession(s *session.Session, ttl time.Duration) (*QueryCacheCollection, error) {
+	envVar := "TABLE_QUERY_CACHE"
+	tableName, exist := os.LookupEnv(envVar)
+	if !exist {
+		return nil, errors.Errorf("you have to define the environment variable %s to work with dynamo", envVar)
+	}
+
+	return NewQueryCacheCollection(dynamodb.New(s), tableName, ttl), nil
+}
+
+// NewQueryCacheCollection configures a Collection that uses svc to connect to the dynamo table tableName.
+// The stored entries expire after ttl.
+func NewQueryCacheCollection(svc dynamodbiface.DynamoDBAPI, tableName string, ttl time.Duration) *QueryCacheCollection {
+	return &QueryCacheCollection{
+		DynamoDBAPI: svc,
+		tableName:   tableName,
+		ttl:         ttl,
+	}
+}
+
+// Get retrieves the value stored in dynamo for key. It returns ok as false when there is no value or it has expired
+// (dynamo deletes the expired items some time after their expiration). It also returns an error, if any.
+func (col *QueryCacheCollection) Get(ctx context.Context, key string) (value []byte, ok bool, err error) {
+	result, err := col.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(col.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			queryCacheKeyAttribute: {
+				S: aws.String(key),
+			},
+		},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	valueAttribute, ok := result.Item[queryCacheValueAttribute]
+	if !ok || valueAttribute.B == nil {
+		return nil, false, nil
+	}
+	value = valueAttribute.B
+
+	if expiresAtAttribute, ok := result.Item[queryCacheExpiresAtAttribute]; ok && expiresAtAttribute.N != nil {
+		expiresAt, err := strconv.ParseInt(*expiresAtAttribute.N, 10, 64)
+		if err != nil {
+			return nil, false, UnmarshallErr
+		}
+		if time.Now().Unix() >= expiresAt {
+			return nil, false, nil
+		}
+	}
+
+	if encodingAttribute, ok := result.Item[queryCacheEncodingAttribute]; ok && aws.StringValue(encodingAttribute.S) == queryCacheGzipEncoding {
+		if value, err = gunzip(value); err != nil {
+			return nil, false, UnmarshallErr
+		}
+	}
+	return value, true, nil
+}
+
+// Put stores value compressed with gzip in dynamo for key. It returns cloudwatch.ErrorCacheValueTooBig when the
+// compressed value is bigger than MaxQueryCacheValueBytes.
+func (col *QueryCacheCollection) Put(ctx context.Context, key string, value []byte) error {
+	expiresAt := time.Now().Add(col.ttl).Unix()
+
+	compressed, err := gzipValue(value)
+	if err != nil {
+		return err
+	}
+	if len(compressed) > MaxQueryCacheValueBytes {
+		return cloudwatch.ErrorCacheValueTooBig
+	}
+
+	_, err = col.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(col.tableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			queryCacheKeyAttribute: {
+				S: aws.String(key),
+			},
+			queryCacheValueAttribute: {
+				B: compressed,
+			},
+			queryCacheEncodingAttribute: {
+				S: aws.String(queryCacheGzipEncoding),
+			},
+			queryCacheExpiresAtAttribute: {
+				N: aws.String(strconv.FormatInt(expiresAt, 10)),
+			},
+		},
+	})
+	return err
+}
+
+// gzipValue returns value compressed with gzip.
+func gzipValue(value []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(value); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// gunzip returns the decompression of the gzip compressed value.
+func gunzip(value []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,79 @@
+package db_test
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
+)
+
+// fakeQueryCacheTable is a dynamo table in memory that supports the operations used by QueryCacheCollection.
+type fakeQueryCacheTable struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (table *fakeQueryCacheTable) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, options ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: table.items[aws.StringValue(input.Key["CacheKey"].S)]}, nil
+}
+
+func (table *fakeQueryCacheTable) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, options ...request.Option) (*dynamodb.PutItemOutput, error) {
+	table.items[aws.StringValue(input.Item["CacheKey"].S)] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+var _ = Describe("QueryCacheCollection", func() {
+	var table *fakeQueryCacheTable
+	var cache *QueryCacheCollection
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		table = &fakeQueryCacheTable{items: make(map[string]map[string]*dynamodb.AttributeValue)}
+		cache = NewQueryCacheCollection(table, "query-cache", time.Hour)
+	})
+
+	It("stores the values compressed and returns them decompressed", func() {
+		value := []byte(`{"results":[` + string(make([]byte, 100000)) + `]}`)
+
+		Expect(cache.Put(ctx, "key", value)).To(Succeed())
+		stored, ok, err := cache.Get(ctx, "key")
+
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		Expect(stored).To(Equal(value))
+		Expect(len(table.items["key"]["Value"].B)).To(BeNumerically("<", len(value)))
+	})
+
+	It("returns the values stored without compression", func() {
+		table.items["key"] = map[string]*dynamodb.AttributeValue{
+			"CacheKey": {S: aws.String("key")},
+			"Value":    {B: []byte("plain")},
+		}
+
+		stored, ok, err := cache.Get(ctx, "key")
+
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		Expect(stored).To(Equal([]byte("plain")))
+	})
+
+	It("does not store the values that don't fit in a dynamo item once compressed", func() {
+		value := make([]byte, 2*MaxQueryCacheValueBytes)
+		_, err := rand.Read(value)
+		Expect(err).To(BeNil())
+
+		err = cache.Put(ctx, "key", value)
+
+		Expect(err).To(Equal(cloudwatch.ErrorCacheValueTooBig))
+		Expect(table.items).To(BeEmpty())
+	})
+})
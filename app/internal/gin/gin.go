@@ -1,17 +1,22 @@
 package gin
 
 import (
+	"context"
 	"net/http"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/api"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/cloudwatch"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/datafetcher"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/db"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/maputil"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/queryparams"
 	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 )
 
 // ExtractGinPrinterQueryParams is responsible of extracting the query parameters from the gin context
@@ -23,6 +28,20 @@ func ExtractGinPrinterQueryParams(c *gin.Context) map[string]string {
 	}
 }
 
+// ExtractGinSubscriptionQueryParams is responsible of extracting the query parameters of the subscriptions
+// from the gin context and returns a maputil with them.
+func ExtractGinSubscriptionQueryParams(c *gin.Context) map[string]string {
+	return map[string]string{
+		configs.ProductNumberQueryParam: c.Query(configs.ProductNumberQueryParam),
+		configs.SerialNumberQueryParam:  c.Query(configs.SerialNumberQueryParam),
+		configs.AccountIDQueryParam:     c.Query(configs.AccountIDQueryParam),
+		configs.ServiceQueryParam:       c.Query(configs.ServiceQueryParam),
+		configs.LimitQueryParam:         c.Query(configs.LimitQueryParam),
+		configs.PageTokenQueryParam:     c.Query(configs.PageTokenQueryParam),
+		configs.ConsistentQueryParam:    c.Query(configs.ConsistentQueryParam),
+	}
+}
+
 // ExtractGinQueryParams is responsible of extracting the query parameters from the gin context
 // and returns a maputil with those query parameters.
 func extractSpecificQueryParams(c *gin.Context) map[string]string {
@@ -33,6 +52,14 @@ func extractSpecificQueryParams(c *gin.Context) map[string]string {
 		configs.OffsetValueQueryParam: c.Query(configs.OffsetValueQueryParam),
 		configs.StartTimeQueryParam:   c.Query(configs.StartTimeQueryParam),
 		configs.EndTimeQueryParam:     c.Query(configs.EndTimeQueryParam),
+		configs.DurationQueryParam:    c.Query(configs.DurationQueryParam),
+		configs.AnchorTimeQueryParam:  c.Query(configs.AnchorTimeQueryParam),
+		configs.BeforeQueryParam:      c.Query(configs.BeforeQueryParam),
+		configs.AfterQueryParam:       c.Query(configs.AfterQueryParam),
+		configs.CursorQueryParam:      c.Query(configs.CursorQueryParam),
+		configs.ChunkedQueryParam:     c.Query(configs.ChunkedQueryParam),
+		configs.IntervalQueryParam:    c.Query(configs.IntervalQueryParam),
+		configs.IncludeQueryParam:     c.Query(configs.IncludeQueryParam),
 	}
 }
 
@@ -49,9 +76,26 @@ func ExtractGinQueryParams(c *gin.Context) map[string]string {
 // and returns a maputil with those query parameters. It is used in the GetStoredObject endpoint.
 func ExtractGinStorageQueryParams(c *gin.Context) map[string]string {
 	return map[string]string{
-		configs.BucketRegionQueryParam: c.Query(configs.BucketRegionQueryParam),
-		configs.BucketNameQueryParam:   c.Query(configs.BucketNameQueryParam),
-		configs.ObjectKeyQueryParam:    c.Query(configs.ObjectKeyQueryParam),
+		configs.BucketRegionQueryParam:  c.Query(configs.BucketRegionQueryParam),
+		configs.BucketNameQueryParam:    c.Query(configs.BucketNameQueryParam),
+		configs.ObjectKeyQueryParam:     c.Query(configs.ObjectKeyQueryParam),
+		configs.ObjectModeQueryParam:    c.Query(configs.ObjectModeQueryParam),
+		configs.ObjectFormatQueryParam:  c.Query(configs.ObjectFormatQueryParam),
+		configs.ProductNumberQueryParam: c.Query(configs.ProductNumberQueryParam),
+		configs.SerialNumberQueryParam:  c.Query(configs.SerialNumberQueryParam),
+	}
+}
+
+// ExtractGinActor returns who makes the request of the gin context, to record it in the history of the subscriptions:
+// the address of the client, as the development server has no authentication.
+func ExtractGinActor(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// setHeaders sets all the headers in the response of c.
+func setHeaders(c *gin.Context, headers map[string]string) {
+	for name, value := range headers {
+		c.Header(name, value)
 	}
 }
 
@@ -62,7 +106,74 @@ func ExtractGinStorageQueryParams(c *gin.Context) map[string]string {
 func Handler(dataFetcher datafetcher.DataFetcher) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		queryparams := ExtractGinQueryParams(c)
-		status, result, err := api.GetData(queryparams, dataFetcher)
+		ctx, cacheStats := cloudwatch.WithCacheStats(c.Request.Context())
+		status, result, err := api.GetData(ctx, queryparams, dataFetcher)
+		setHeaders(c, cacheStats.Headers())
+
+		if err != nil {
+			c.JSON(status, err.Error())
+		} else {
+			c.JSON(status, result)
+		}
+	}
+}
+
+// TimelineHandler returns a gin handler function that obtains the events of all the sources and merges them in
+// chronological order.
+func TimelineHandler(sources []datafetcher.Source, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryparams := ExtractGinQueryParams(c)
+		ctx, cacheStats := cloudwatch.WithCacheStats(c.Request.Context())
+		status, result, err := api.GetTimeline(ctx, queryparams, sources, printerSubscriptionFetcher)
+		setHeaders(c, cacheStats.Headers())
+
+		if err != nil {
+			c.JSON(status, err.Error())
+		} else {
+			c.JSON(status, result)
+		}
+	}
+}
+
+// FleetHandler returns a gin handler function that obtains the summary of the printers of a product number.
+func FleetHandler(fleetFetcher datafetcher.FleetFetcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryparams := ExtractGinQueryParams(c)
+		ctx, cacheStats := cloudwatch.WithCacheStats(c.Request.Context())
+		status, result, err := api.GetFleet(ctx, queryparams, fleetFetcher)
+		setHeaders(c, cacheStats.Headers())
+
+		if err != nil {
+			c.JSON(status, err.Error())
+		} else {
+			c.JSON(status, result)
+		}
+	}
+}
+
+// HeartbeatAnalysisHandler returns a gin handler function that analyses the heartbeats of a printer.
+func HeartbeatAnalysisHandler(heartbeatFetcher datafetcher.DataFetcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryparams := ExtractGinQueryParams(c)
+		ctx, cacheStats := cloudwatch.WithCacheStats(c.Request.Context())
+		status, result, err := api.GetHeartbeatAnalysis(ctx, queryparams, heartbeatFetcher)
+		setHeaders(c, cacheStats.Headers())
+
+		if err != nil {
+			c.JSON(status, err.Error())
+		} else {
+			c.JSON(status, result)
+		}
+	}
+}
+
+// PipelineHandler returns a gin handler function that correlates the OpenXMLs and CloudJsons of a printer.
+func PipelineHandler(openXMLFetcher, cloudJsonFetcher datafetcher.DataFetcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryparams := ExtractGinQueryParams(c)
+		ctx, cacheStats := cloudwatch.WithCacheStats(c.Request.Context())
+		status, result, err := api.GetPipelineReport(ctx, queryparams, openXMLFetcher, cloudJsonFetcher)
+		setHeaders(c, cacheStats.Headers())
 
 		if err != nil {
 			c.JSON(status, err.Error())
@@ -74,63 +185,197 @@ func Handler(dataFetcher datafetcher.DataFetcher) gin.HandlerFunc {
 
 // StorageHandler is the responsible to handle the request of get a specific object.
 // It returns a gin handler function that handles all the logic behind the http request.
-// It uses an s3fetcher interface that is responsible of fetching the stored objects (Openxml, CloudJson, HB, RTA, etc.).
-// It calls GetStoredObject that is responsible of obtaiing the objects.
-func StorageHandler(s3FetcherUsEast1 storage.S3Fetcher, s3FetcherUsWest1 storage.S3Fetcher) gin.HandlerFunc {
+// It uses a registry of s3fetchers (one per region) that are responsible of fetching the stored objects (Openxml, CloudJson, HB, RTA, etc.).
+// It streams the objects rendered in the requested format, as they are stored, or returns their pre-signed URL.
+func StorageHandler(s3Registry storage.S3Registry) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		queryParams := ExtractGinStorageQueryParams(c)
 
-		status, result, err := api.GetStoredObject(queryParams, s3FetcherUsEast1, s3FetcherUsWest1)
+		mode, err := queryparams.ExtractObjectMode(queryParams)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		if mode == queryparams.PresignObjectMode {
+			status, result, err := api.PresignStoredObject(queryParams, configs.GetStoragePresignTTL(), s3Registry)
+			if err != nil {
+				writeError(c, err)
+			} else {
+				c.JSON(status, result)
+			}
+			return
+		}
 
-		mimeType := "text"
+		format, err := queryparams.ExtractObjectFormat(queryParams)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		if format != queryparams.RawObjectFormat && c.GetHeader("Range") == "" {
+			status, result, err := api.RenderStoredObject(c.Request.Context(), queryParams, format, s3Registry)
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+			defer result.Body.Close()
 
+			c.DataFromReader(status, result.ContentLength, result.ContentType, result.Body, nil)
+			return
+		}
+
+		status, result, err := api.OpenStoredObject(c.Request.Context(), queryParams, c.GetHeader("Range"), s3Registry)
 		if err != nil {
-			c.Data(status, mimeType, []byte(err.Error()))
-		} else {
-			c.Data(status, mimeType, result)
+			writeError(c, err)
+			return
+		}
+		defer result.Body.Close()
+
+		headers := map[string]string{"Accept-Ranges": "bytes"}
+		if result.ContentRange != nil {
+			headers["Content-Range"] = *result.ContentRange
 		}
+
+		contentLength := int64(-1)
+		if result.ContentLength != nil {
+			contentLength = *result.ContentLength
+		}
+		c.DataFromReader(status, contentLength, aws.StringValue(result.ContentType), result.Body, headers)
 	}
 }
 
-// SubscriptionHandler is the responsible to handle requests to retrieve data from Subscriptions
+// SubscriptionHandler is the responsible to handle requests to retrieve data from Subscriptions.
+// With an account_id it returns a single subscription, and with limit or page_token a page of them.
 func SubscriptionHandler(fetcher db.PrinterSubscriptionFetcher) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		queryparams := ExtractGinPrinterQueryParams(c)
-		status, result, err := api.GetPrinterSubscriptions(queryparams, fetcher)
+		queryparams := ExtractGinSubscriptionQueryParams(c)
+		if queryparams[configs.AccountIDQueryParam] != "" {
+			_, result, err := api.GetPrinterSubscription(c.Request.Context(), queryparams, fetcher)
+			if err != nil {
+				writeError(c, err)
+			} else {
+				c.JSON(http.StatusOK, result)
+			}
+			return
+		}
+		if api.IsPaginated(queryparams) {
+			SubscriptionsPageHandler(fetcher, api.QueryPrinterSubscriptions)(c)
+			return
+		}
+
+		_, result, err := api.GetPrinterSubscriptions(c.Request.Context(), queryparams, fetcher)
+
+		if err != nil {
+			writeError(c, err)
+		} else {
+			c.JSON(http.StatusOK, result)
+		}
+	}
+}
+
+// CreateSubscriptionHandler creates a Subscription from the JSON of the body on behalf of the client.
+func CreateSubscriptionHandler(fetcher db.PrinterSubscriptionFetcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := c.GetRawData()
+		if err != nil {
+			writeError(c, db.MalformedSubscriptionErr)
+			return
+		}
 
+		ctx := db.WithActor(c.Request.Context(), ExtractGinActor(c))
+		status, result, err := api.CreatePrinterSubscription(ctx, body, fetcher)
 		if err != nil {
-			c.JSON(status, err.Error())
+			writeError(c, err)
+		} else {
+			c.JSON(status, result)
+		}
+	}
+}
+
+// DeleteSubscriptionHandler removes a Subscription on behalf of the client.
+func DeleteSubscriptionHandler(fetcher db.PrinterSubscriptionFetcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryparams := ExtractGinSubscriptionQueryParams(c)
+		ctx := db.WithActor(c.Request.Context(), ExtractGinActor(c))
+		status, err := api.DeletePrinterSubscription(ctx, queryparams, fetcher)
+		if err != nil {
+			writeError(c, err)
+		} else {
+			c.Status(status)
+		}
+	}
+}
+
+// SubscriptionsPageHandler retrieves pages of Subscriptions with getPage.
+func SubscriptionsPageHandler(fetcher db.PrinterSubscriptionFetcher,
+	getPage func(context.Context, map[string]string, db.PrinterSubscriptionFetcher) (int, *db.SubscriptionsPage, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryparams := ExtractGinSubscriptionQueryParams(c)
+		_, result, err := getPage(c.Request.Context(), queryparams, fetcher)
+
+		if err != nil {
+			writeError(c, err)
 		} else {
 			c.JSON(http.StatusOK, result)
 		}
 	}
 }
 
+// SubscriptionHistoryHandler retrieves the changes of the Subscriptions of a printer in a time range.
+func SubscriptionHistoryHandler(fetcher db.PrinterSubscriptionFetcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queryparams := ExtractGinQueryParams(c)
+		_, result, err := api.GetPrinterSubscriptionHistory(c.Request.Context(), queryparams, fetcher)
+
+		if err != nil {
+			writeError(c, err)
+		} else {
+			c.JSON(http.StatusOK, result)
+		}
+	}
+}
+
+// writeError writes the error response to err, with the http status of api.SelectHTTPStatus.
+func writeError(c *gin.Context, err error) {
+	c.JSON(api.SelectHTTPStatus(err), err.Error())
+}
+
 // InitRouter initialize a gin router with all the routes for the different endpoints, request types and functions
 // that are responsible of handling each request to specific endpoints.
-func InitRouter(s3FetcherUsEast1 storage.S3Fetcher, s3FetcherUsWest1 storage.S3Fetcher,
-	xmlsFetcher datafetcher.DataFetcher, cloudJsonsFetcher datafetcher.DataFetcher,
-	heartbeatsFetcher datafetcher.DataFetcher, rtaFetcher datafetcher.DataFetcher,
-	printerSubscriptionFetcher db.PrinterSubscriptionFetcher) *gin.Engine {
+func InitRouter(s3Registry storage.S3Registry, sources []datafetcher.Source,
+	fleetFetcher datafetcher.FleetFetcher, printerSubscriptionFetcher db.PrinterSubscriptionFetcher) *gin.Engine {
 
 	router := gin.Default()
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"OPTIONS", "GET", "PUT", "PATCH"},
-		AllowHeaders:     []string{"access-control-allow-origin, access-control-allow-headers, Content-Type, x-api-key"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"OPTIONS", "GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"access-control-allow-origin, access-control-allow-headers, Content-Type, x-api-key", "Range"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Accept-Ranges", cloudwatch.CacheHitsHeader, cloudwatch.CacheMissesHeader},
 		AllowCredentials: true,
 		AllowWildcard:    true,
 		MaxAge:           50 * time.Hour,
 	}))
 
-	router.GET(configs.StorageObjectPath, StorageHandler(s3FetcherUsEast1, s3FetcherUsWest1))
-	router.GET(configs.OpenXMLPath, Handler(xmlsFetcher))
-	router.GET(configs.CloudJsonPath, Handler(cloudJsonsFetcher))
-	router.GET(configs.HeartbeatPath, Handler(heartbeatsFetcher))
-	router.GET(configs.RTAPath, Handler(rtaFetcher))
+	router.GET(configs.StorageObjectPath, StorageHandler(s3Registry))
+	for _, source := range sources {
+		router.GET(configs.EventPath(source.Name), Handler(source.Fetcher))
+	}
 	router.GET(configs.SubscriptionsPath, SubscriptionHandler(printerSubscriptionFetcher))
+	router.POST(configs.SubscriptionsPath, CreateSubscriptionHandler(printerSubscriptionFetcher))
+	router.DELETE(configs.SubscriptionsPath, DeleteSubscriptionHandler(printerSubscriptionFetcher))
+	router.GET(configs.SubscriptionsByAccountPath, SubscriptionsPageHandler(printerSubscriptionFetcher, api.GetSubscriptionsByAccount))
+	router.GET(configs.SubscriptionsByServicePath, SubscriptionsPageHandler(printerSubscriptionFetcher, api.GetSubscriptionsByService))
+	router.GET(configs.SubscriptionsHistoryPath, SubscriptionHistoryHandler(printerSubscriptionFetcher))
+	router.GET(configs.TimelinePath, TimelineHandler(sources, printerSubscriptionFetcher))
+	router.GET(configs.FleetPath, FleetHandler(fleetFetcher))
+	if heartbeatFetcher, ok := datafetcher.FindSource(sources, datafetcher.HeartbeatEvents); ok {
+		router.GET(configs.HeartbeatAnalysisPath, HeartbeatAnalysisHandler(heartbeatFetcher))
+	}
+	openXMLFetcher, openXMLFound := datafetcher.FindSource(sources, datafetcher.OpenXMLEvents)
+	cloudJsonFetcher, cloudJsonFound := datafetcher.FindSource(sources, datafetcher.CloudJsonEvents)
+	if openXMLFound && cloudJsonFound {
+		router.GET(configs.PipelinePath, PipelineHandler(openXMLFetcher, cloudJsonFetcher))
+	}
 
 	return router
 }
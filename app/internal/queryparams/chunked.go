@@ -0,0 +1,36 @@
+package queryparams
+
+import (
+	"strconv"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+// ExtractChunked extracts from the query parameters whether the time range has to be split in chunks.
+// It also returns an error if any.
+func ExtractChunked(queryParameters map[string]string) (chunked bool, err error) {
+	chunkedString := queryParameters[configs.ChunkedQueryParam]
+	if chunkedString == "" {
+		return false, nil
+	}
+
+	chunked, err = strconv.ParseBool(chunkedString)
+	if err != nil {
+		return false, ErrorQueryStringUnsupportedChunked
+	}
+	return chunked, nil
+}
+
+// ExtractMaxTimeDiffInMinutes returns the maximum difference between start time and end time allowed for
+// the query parameters, larger for chunked queries. It also returns an error if any.
+func ExtractMaxTimeDiffInMinutes(queryParameters map[string]string) (maxTimeDiffInMinutes int, err error) {
+	chunked, err := ExtractChunked(queryParameters)
+	if err != nil {
+		return 0, err
+	}
+
+	if chunked {
+		return configs.GetMaxChunkedTimeDiffInMinutes(), nil
+	}
+	return configs.GetMaxTimeDiffInMinutes(), nil
+}
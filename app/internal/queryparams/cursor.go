@@ -0,0 +1,111 @@
+package queryparams
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+// cursorSeparator separates the epochs of the position and the time range in a cursor.
+const cursorSeparator = ":"
+
+// Cursor identifies a page of events that starts at Position, inside the time range resolved for the first page.
+// StartTime and EndTime are zero for the cursors that only contain the position.
+type Cursor struct {
+	Position  time.Time
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// hasTimeRange returns whether the cursor contains the time range of the pages.
+func (cursor Cursor) hasTimeRange() bool {
+	return !cursor.StartTime.IsZero() && !cursor.EndTime.IsZero()
+}
+
+// EncodeCursor returns the opaque cursor that identifies a page of events starting at position, inside the absolute
+// time range between startTime and endTime.
+func EncodeCursor(position, startTime, endTime time.Time) string {
+	epochs := []string{
+		strconv.FormatInt(position.Unix(), 10),
+		strconv.FormatInt(startTime.Unix(), 10),
+		strconv.FormatInt(endTime.Unix(), 10),
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(epochs, cursorSeparator)))
+}
+
+// DecodeCursor returns the page of events identified by cursor.
+// It returns an error if cursor is malformed.
+func DecodeCursor(cursor string) (Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Cursor{}, ErrorQueryStringUnsupportedCursor
+	}
+
+	epochs := strings.Split(string(decoded), cursorSeparator)
+	if len(epochs) != 1 && len(epochs) != 3 {
+		return Cursor{}, ErrorQueryStringUnsupportedCursor
+	}
+
+	times := make([]time.Time, len(epochs))
+	for i, epoch := range epochs {
+		if times[i], err = stringEpochToUTCTime(epoch); err != nil {
+			return Cursor{}, ErrorQueryStringUnsupportedCursor
+		}
+	}
+
+	if len(times) == 1 {
+		return Cursor{Position: times[0]}, nil
+	}
+	return Cursor{Position: times[0], StartTime: times[1], EndTime: times[2]}, nil
+}
+
+// ExtractCursor extracts from the query parameters the page of events identified by the cursor.
+// If there is no cursor, ok is false. It also returns an error if any.
+func ExtractCursor(queryParameters map[string]string, startTime, endTime time.Time) (cursor Cursor, ok bool, err error) {
+	encoded := queryParameters[configs.CursorQueryParam]
+	if encoded == "" {
+		return Cursor{}, false, nil
+	}
+
+	cursor, err = DecodeCursor(encoded)
+	if err != nil {
+		return Cursor{}, false, err
+	}
+
+	if cursor.hasTimeRange() {
+		startTime, endTime = cursor.StartTime, cursor.EndTime
+	}
+	if cursor.Position.Before(startTime.Truncate(time.Second)) || cursor.Position.After(endTime) {
+		return Cursor{}, false, ErrorQueryStringUnsupportedCursor
+	}
+
+	return cursor, true, nil
+}
+
+// ExtractPageTimeRange extracts from the query parameters the time range of the pages of events and the start of
+// the page identified by the cursor. It also returns an error if any.
+func ExtractPageTimeRange(queryParameters map[string]string, maxTimeDiffInMinutes int) (startTime, endTime, pageStart time.Time, err error) {
+	startTime, endTime, err = ExtractTimeRange(queryParameters, maxTimeDiffInMinutes)
+	if err != nil {
+		return time.Time{}, time.Time{}, time.Time{}, err
+	}
+
+	cursor, ok, err := ExtractCursor(queryParameters, startTime, endTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, time.Time{}, err
+	}
+	if !ok {
+		return startTime, endTime, startTime, nil
+	}
+
+	if cursor.hasTimeRange() {
+		if cursor.EndTime.Before(cursor.StartTime) || cursor.EndTime.Sub(cursor.StartTime) > time.Duration(maxTimeDiffInMinutes)*time.Minute {
+			return time.Time{}, time.Time{}, time.Time{}, ErrorQueryStringUnsupportedCursor
+		}
+		startTime, endTime = cursor.StartTime, cursor.EndTime
+	}
+	return startTime, endTime, cursor.Position, nil
+}
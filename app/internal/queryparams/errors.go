@@ -22,15 +22,38 @@ const (
 	ErrorQueryStringMissingStartTime     = ConstError("query string missing start time error")
 	ErrorQueryStringUnsupportedStartTime = ConstError("query string unsupported start time error")
 
+	ErrorQueryStringUnsupportedDuration = ConstError("query string unsupported duration error")
+	ErrorQueryStringDurationConflict    = ConstError("query string duration together with end time or offset error")
+
+	ErrorQueryStringMissingAnchorTime     = ConstError("query string missing anchor time when time range is around error")
+	ErrorQueryStringUnsupportedAnchorTime = ConstError("query string unsupported anchor time error")
+	ErrorQueryStringMissingAroundOffsets  = ConstError("query string missing before and after when time range is around error")
+
 	ErrorQueryStringTimeDifferenceTooBig         = ConstError("query string difference between start_time and end_time is too big error")
 	ErrorQueryStringEndTimePreviousThanStartTime = ConstError("query string end time is previous in time than start time error")
 
-	ErrorQueryStringPnSn = ConstError("query string Product Number missing but Serial Number present error")
+	ErrorQueryStringMissingProductNumber   = ConstError("query string missing Product Number error")
+	ErrorQueryStringMissingSerialNumber    = ConstError("query string missing Serial Number error")
+	ErrorQueryStringPnSn                   = ConstError("query string Product Number missing but Serial Number present error")
+	ErrorQueryStringMalformedProductNumber = ConstError("query string malformed Product Number error")
+	ErrorQueryStringMalformedSerialNumber  = ConstError("query string malformed Serial Number error")
+	ErrorQueryStringMissingAccountID       = ConstError("query string missing account id error")
+	ErrorQueryStringMissingService         = ConstError("query string missing service error")
+
+	ErrorQueryStringUnsupportedInterval   = ConstError("query string unsupported interval error")
+	ErrorQueryStringUnsupportedCursor     = ConstError("query string unsupported cursor error")
+	ErrorQueryStringUnsupportedChunked    = ConstError("query string unsupported chunked error")
+	ErrorQueryStringUnsupportedLimit      = ConstError("query string unsupported limit error")
+	ErrorQueryStringUnsupportedConsistent = ConstError("query string unsupported consistent error")
+	ErrorQueryStringUnsupportedInclude    = ConstError("query string unsupported include error")
 
 	ErrorQueryStringMissingBucketRegion     = ConstError("query string missing bucket region error")
 	ErrorQueryStringMissingBucketName       = ConstError("query string missing bucket name error")
 	ErrorQueryStringMissingObjectKey        = ConstError("query string missing object key error")
 	ErrorQueryStringUnsupportedBucketRegion = ConstError("query string unsupported bucket region error")
+	ErrorQueryStringUnsupportedObjectMode   = ConstError("query string unsupported object mode error")
+	ErrorQueryStringUnsupportedObjectFormat = ConstError("query string unsupported object format error")
 
 	ErrorNotValidEndpoint = ConstError("invalid endpoint reached")
+	ErrorNotAllowedMethod = ConstError("method not allowed in the endpoint")
 )
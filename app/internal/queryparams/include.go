@@ -0,0 +1,29 @@
+package queryparams
+
+import (
+	"strings"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+// IncludeSubscriptions is the value of the query parameter include that adds the registrations of the subscriptions
+// of the printer to the timeline.
+const IncludeSubscriptions = "subscriptions"
+
+// ExtractInclude extracts from the query parameters the comma separated data to include in the response, as a set.
+// It returns ErrorQueryStringUnsupportedInclude if any of them is not supported (only IncludeSubscriptions is).
+func ExtractInclude(queryParameters map[string]string) (map[string]bool, error) {
+	include := make(map[string]bool)
+	for _, value := range strings.Split(queryParameters[configs.IncludeQueryParam], ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch value {
+		case "":
+			continue
+		case IncludeSubscriptions:
+			include[value] = true
+		default:
+			return nil, ErrorQueryStringUnsupportedInclude
+		}
+	}
+	return include, nil
+}
@@ -0,0 +1,22 @@
+package queryparams
+
+import (
+	"time"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+// ExtractInterval extracts from the query parameters the expected time between two consecutive events, or returns
+// defaultInterval if it is not present. It also returns an error if any.
+func ExtractInterval(queryParameters map[string]string, defaultInterval time.Duration) (time.Duration, error) {
+	intervalString := queryParameters[configs.IntervalQueryParam]
+	if intervalString == "" {
+		return defaultInterval, nil
+	}
+
+	interval, err := ParseDuration(intervalString)
+	if err != nil || interval < time.Second || interval%time.Second != 0 {
+		return 0, ErrorQueryStringUnsupportedInterval
+	}
+	return interval, nil
+}
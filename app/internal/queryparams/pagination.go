@@ -0,0 +1,45 @@
+package queryparams
+
+import (
+	"strconv"
+	"strings"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+// Number of items of the pages of the paginated endpoints when the query parameter limit is not present,
+// and the maximum it can be.
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// ExtractLimit extracts from the query parameters the maximum number of items of a page, or returns DefaultPageLimit
+// if it is not present. It returns ErrorQueryStringUnsupportedLimit if it is not an integer between 1 and MaxPageLimit.
+func ExtractLimit(queryParameters map[string]string) (int64, error) {
+	limitString := strings.TrimSpace(queryParameters[configs.LimitQueryParam])
+	if limitString == "" {
+		return DefaultPageLimit, nil
+	}
+
+	limit, err := strconv.ParseInt(limitString, 10, 64)
+	if err != nil || limit < 1 || limit > MaxPageLimit {
+		return 0, ErrorQueryStringUnsupportedLimit
+	}
+	return limit, nil
+}
+
+// ExtractConsistent extracts from the query parameters whether the reads have to be strongly consistent
+// (false if it is not present). It returns ErrorQueryStringUnsupportedConsistent if it is not a boolean.
+func ExtractConsistent(queryParameters map[string]string) (bool, error) {
+	consistentString := queryParameters[configs.ConsistentQueryParam]
+	if consistentString == "" {
+		return false, nil
+	}
+
+	consistent, err := strconv.ParseBool(consistentString)
+	if err != nil {
+		return false, ErrorQueryStringUnsupportedConsistent
+	}
+	return consistent, nil
+}
@@ -2,16 +2,92 @@
 // Is the controller of the query parameters.
 package queryparams
 
-import "bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+import (
+	"regexp"
+	"strings"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+var (
+	// productNumberPattern are the valid HP product numbers: 5 to 10 letters and digits, optionally followed by
+	// an option suffix of '#' and 3 letters and digits (like Y0U23A#B19).
+	productNumberPattern = regexp.MustCompile(`^[A-Z0-9]{5,10}(#[A-Z0-9]{3})?$`)
+
+	// serialNumberPattern are the valid HP serial numbers: 8 to 14 letters and digits (like SG4491P001).
+	serialNumberPattern = regexp.MustCompile(`^[A-Z0-9]{8,14}$`)
+)
 
 // ExtractPrinterInfo extracts the printer information from the query parameters argument and
-// returns the appropiate data and an error, if any.
+// returns the appropiate data, normalized, and an error, if any.
 func ExtractPrinterInfo(queryParameters map[string]string) (productNumber string, serialNumber string, err error) {
-	productNumber = queryParameters[configs.ProductNumberQueryParam]
-	serialNumber = queryParameters[configs.SerialNumberQueryParam]
+	productNumber = strings.TrimSpace(queryParameters[configs.ProductNumberQueryParam])
+	serialNumber = strings.TrimSpace(queryParameters[configs.SerialNumberQueryParam])
 	if productNumber == "" && serialNumber != "" {
 		err = ErrorQueryStringPnSn
 		return
 	}
+
+	if productNumber != "" {
+		if productNumber, err = NormalizeProductNumber(productNumber); err != nil {
+			return "", "", err
+		}
+	}
+	if serialNumber != "" {
+		if serialNumber, err = NormalizeSerialNumber(serialNumber); err != nil {
+			return "", "", err
+		}
+	}
 	return productNumber, serialNumber, nil
 }
+
+// ExtractPrinterKey extracts the printer and the account of a subscription from the query parameters. The product
+// number, the serial number (normalized as in ExtractPrinterInfo) and the account id are required.
+func ExtractPrinterKey(queryParameters map[string]string) (productNumber string, serialNumber string, accountId string, err error) {
+	productNumber, serialNumber, err = ExtractPrinterInfo(queryParameters)
+	if err != nil {
+		return "", "", "", err
+	}
+	if productNumber == "" {
+		return "", "", "", ErrorQueryStringMissingProductNumber
+	}
+	if serialNumber == "" {
+		return "", "", "", ErrorQueryStringMissingSerialNumber
+	}
+
+	accountId, err = ExtractAccountID(queryParameters)
+	if err != nil {
+		return "", "", "", err
+	}
+	return productNumber, serialNumber, accountId, nil
+}
+
+// ExtractAccountID extracts the account id (without surrounding spaces) from the query parameters.
+// It returns ErrorQueryStringMissingAccountID if it is not present.
+func ExtractAccountID(queryParameters map[string]string) (string, error) {
+	accountId := strings.TrimSpace(queryParameters[configs.AccountIDQueryParam])
+	if accountId == "" {
+		return "", ErrorQueryStringMissingAccountID
+	}
+	return accountId, nil
+}
+
+// NormalizeProductNumber returns productNumber without surrounding spaces and in uppercase.
+// It returns ErrorQueryStringMalformedProductNumber if it is not a valid HP product number.
+func NormalizeProductNumber(productNumber string) (string, error) {
+	productNumber = strings.ToUpper(strings.TrimSpace(productNumber))
+	if !productNumberPattern.MatchString(productNumber) {
+		return "", ErrorQueryStringMalformedProductNumber
+	}
+	return productNumber, nil
+}
+
+// NormalizeSerialNumber returns serialNumber without surrounding spaces and in uppercase.
+// It returns ErrorQueryStringMalformedSerialNumber if it is not a valid HP serial number.
+func NormalizeSerialNumber(serialNumber string) (string, error) {
+	serialNumber = strings.ToUpper(strings.TrimSpace(serialNumber))
+	if !serialNumberPattern.MatchString(serialNumber) {
+		return "", ErrorQueryStringMalformedSerialNumber
+	}
+	return serialNumber, nil
+}
@@ -103,11 +103,11 @@ var _ = Describe("Query Parameters controller", func() {
 				})
 			})
 
-			Context("and offset units is unsupported (days)", func() {
+			Context("and offset units is unsupported (weeks)", func() {
 				It("returns unsupported offset units error", func() {
 					queryParams := map[string]string{
 						configs.TimeTypeQueryParam:    "relative",
-						configs.OffsetUnitsQueryParam: "days",
+						configs.OffsetUnitsQueryParam: "weeks",
 					}
 					_, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
 					Expect(err).To(Equal(ErrorQueryStringUnsupportedOffsetUnits))
@@ -760,6 +760,293 @@ var _ = Describe("Query Parameters controller", func() {
 			})
 		})
 
+		Context("When the times are in other formats", func() {
+			It("accepts times in RFC 3339 format with timezone offsets", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:  "absolute",
+					configs.StartTimeQueryParam: "2020-05-29T13:31:58+02:00",
+					configs.EndTimeQueryParam:   "2020-05-29T12:01:58.500Z",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(time.Unix(1590751918, 0).UTC()))
+				Expect(endTime).To(Equal(time.Unix(1590753718, int64(500*time.Millisecond)).UTC()))
+				Expect(startTime.Location()).To(Equal(time.UTC))
+			})
+
+			It("accepts timezone offsets whose '+' was decoded as a space", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:  "absolute",
+					configs.StartTimeQueryParam: "2020-05-29T13:31:58 02:00",
+					configs.EndTimeQueryParam:   "1590755518",
+				}
+				startTime, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(time.Unix(1590751918, 0).UTC()))
+			})
+
+			It("accepts epochs in milliseconds", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:  "absolute",
+					configs.StartTimeQueryParam: "1590751918250",
+					configs.EndTimeQueryParam:   "1590755518",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(time.Unix(1590751918, int64(250*time.Millisecond)).UTC()))
+				Expect(endTime).To(Equal(time.Unix(1590755518, 0).UTC()))
+			})
+
+			It("returns unsupported start time and end time errors if they are not in any format", func() {
+				for _, invalid := range []string{"2020-05-29", "2020-05-29T13:31:58", "29/05/2020 13:31", "1590751918.5"} {
+					_, _, err := ExtractTimeRange(map[string]string{
+						configs.TimeTypeQueryParam:  "absolute",
+						configs.StartTimeQueryParam: invalid,
+						configs.EndTimeQueryParam:   "1590755518",
+					}, maxTimeDiffInMinutes)
+					Expect(err).To(Equal(ErrorQueryStringUnsupportedStartTime))
+
+					_, _, err = ExtractTimeRange(map[string]string{
+						configs.TimeTypeQueryParam:  "absolute",
+						configs.StartTimeQueryParam: "1590751918",
+						configs.EndTimeQueryParam:   invalid,
+					}, maxTimeDiffInMinutes)
+					Expect(err).To(Equal(ErrorQueryStringUnsupportedEndTime))
+				}
+			})
+		})
+
+		Context("When the offset is in hours or days", func() {
+			It("returns the range ending now", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:    "relative",
+					configs.OffsetUnitsQueryParam: "hours",
+					configs.OffsetValueQueryParam: "6",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, 24*60)
+
+				Expect(err).To(BeNil())
+				Expect(endTime).To(BeTemporally("~", time.Now(), time.Second))
+				Expect(endTime.Sub(startTime)).To(Equal(6 * time.Hour))
+			})
+
+			It("returns unsupported offset value error if it is longer than the maximum", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:    "relative",
+					configs.OffsetUnitsQueryParam: "days",
+					configs.OffsetValueQueryParam: "2",
+				}
+				_, _, err := ExtractTimeRange(queryParams, 24*60)
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedOffsetValue))
+
+				queryParams[configs.OffsetValueQueryParam] = "1"
+				startTime, endTime, err := ExtractTimeRange(queryParams, 24*60)
+				Expect(err).To(BeNil())
+				Expect(endTime.Sub(startTime)).To(Equal(24 * time.Hour))
+			})
+		})
+
+		Context("When there is a duration", func() {
+			durations := []struct {
+				value    string
+				duration time.Duration
+			}{
+				{"PT6H", 6 * time.Hour},
+				{"P1DT12H", 36 * time.Hour},
+				{"PT1H30M15.5S", time.Hour + 30*time.Minute + 15500*time.Millisecond},
+				{"P1W", 7 * 24 * time.Hour},
+				{"2h30m", 2*time.Hour + 30*time.Minute},
+				{"1d12h", 36 * time.Hour},
+				{"45s", 45 * time.Second},
+			}
+
+			for _, d := range durations {
+				d := d
+				It("parses "+d.value, func() {
+					Expect(ParseDuration(d.value)).To(Equal(d.duration))
+				})
+			}
+
+			It("returns unsupported duration error if it is not a positive duration", func() {
+				for _, invalid := range []string{"P", "PT", "P1Y", "P1M", "PT-1H", "6", "0s", "-2h", "1d-2h", "two hours"} {
+					_, err := ParseDuration(invalid)
+					Expect(err).To(Equal(ErrorQueryStringUnsupportedDuration))
+				}
+			})
+
+			It("uses it as offset of the relative ranges", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam: "relative",
+					configs.DurationQueryParam: "PT30M",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(endTime.Sub(startTime)).To(Equal(30 * time.Minute))
+			})
+
+			It("uses it to obtain the end time of the absolute ranges", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:  "absolute",
+					configs.StartTimeQueryParam: "2020-05-29T11:31:58Z",
+					configs.DurationQueryParam:  "45m",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(time.Unix(1590751918, 0).UTC()))
+				Expect(endTime).To(Equal(time.Unix(1590754618, 0).UTC()))
+			})
+
+			It("returns duration conflict error together with offsets or end time", func() {
+				_, _, err := ExtractTimeRange(map[string]string{
+					configs.TimeTypeQueryParam:    "relative",
+					configs.OffsetUnitsQueryParam: "minutes",
+					configs.OffsetValueQueryParam: "5",
+					configs.DurationQueryParam:    "PT5M",
+				}, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringDurationConflict))
+
+				_, _, err = ExtractTimeRange(map[string]string{
+					configs.TimeTypeQueryParam:  "absolute",
+					configs.StartTimeQueryParam: "1590751918",
+					configs.EndTimeQueryParam:   "1590755518",
+					configs.DurationQueryParam:  "PT5M",
+				}, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringDurationConflict))
+			})
+
+			It("returns time difference too big error if it is longer than the maximum", func() {
+				_, _, err := ExtractTimeRange(map[string]string{
+					configs.TimeTypeQueryParam: "relative",
+					configs.DurationQueryParam: "PT61M",
+				}, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringTimeDifferenceTooBig))
+			})
+
+			It("returns unsupported duration error if it is not valid", func() {
+				_, _, err := ExtractTimeRange(map[string]string{
+					configs.TimeTypeQueryParam:  "absolute",
+					configs.StartTimeQueryParam: "1590751918",
+					configs.DurationQueryParam:  "P1M",
+				}, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedDuration))
+			})
+		})
+
+		Context("When time range is relative with an anchor time", func() {
+			It("returns the range ending at the anchor time", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:    "relative",
+					configs.OffsetUnitsQueryParam: "minutes",
+					configs.OffsetValueQueryParam: "30",
+					configs.AnchorTimeQueryParam:  "2020-05-29T12:31:58Z",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(time.Unix(1590753718, 0).UTC()))
+				Expect(endTime).To(Equal(time.Unix(1590755518, 0).UTC()))
+			})
+
+			It("returns unsupported anchor time error if it is not valid", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:   "relative",
+					configs.DurationQueryParam:   "PT30M",
+					configs.AnchorTimeQueryParam: "yesterday",
+				}
+				_, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedAnchorTime))
+			})
+		})
+
+		Context("When time range is around an anchor time", func() {
+			It("returns the range from before the anchor time to after it", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:   "around",
+					configs.AnchorTimeQueryParam: "1590755518",
+					configs.BeforeQueryParam:     "15m",
+					configs.AfterQueryParam:      "PT15M",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(time.Unix(1590754618, 0).UTC()))
+				Expect(endTime).To(Equal(time.Unix(1590756418, 0).UTC()))
+			})
+
+			It("uses zero for the missing offset", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:   "around",
+					configs.AnchorTimeQueryParam: "1590755518",
+					configs.AfterQueryParam:      "10m",
+				}
+				startTime, endTime, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(time.Unix(1590755518, 0).UTC()))
+				Expect(endTime).To(Equal(time.Unix(1590756118, 0).UTC()))
+			})
+
+			It("returns missing anchor time error if there is no anchor time", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam: "around",
+					configs.BeforeQueryParam:   "15m",
+				}
+				_, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringMissingAnchorTime))
+			})
+
+			It("returns missing around offsets error if there is neither before nor after", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:   "around",
+					configs.AnchorTimeQueryParam: "1590755518",
+				}
+				_, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringMissingAroundOffsets))
+			})
+
+			It("returns start time and end time should not appear errors", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:   "around",
+					configs.AnchorTimeQueryParam: "1590755518",
+					configs.BeforeQueryParam:     "15m",
+					configs.StartTimeQueryParam:  "1590755518",
+				}
+				_, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringStartTimeAppears))
+
+				delete(queryParams, configs.StartTimeQueryParam)
+				queryParams[configs.EndTimeQueryParam] = "1590755518"
+				_, _, err = ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringEndTimeAppears))
+			})
+
+			It("returns time difference too big error if the window is longer than the maximum", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:   "around",
+					configs.AnchorTimeQueryParam: "1590755518",
+					configs.BeforeQueryParam:     "31m",
+					configs.AfterQueryParam:      "30m",
+				}
+				_, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringTimeDifferenceTooBig))
+			})
+
+			It("returns unsupported duration error if an offset is not valid", func() {
+				queryParams := map[string]string{
+					configs.TimeTypeQueryParam:   "around",
+					configs.AnchorTimeQueryParam: "1590755518",
+					configs.BeforeQueryParam:     "-15m",
+				}
+				_, _, err := ExtractTimeRange(queryParams, maxTimeDiffInMinutes)
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedDuration))
+			})
+		})
+
 	})
 
 	Describe("Extract Printer number and Serial number from query parameters", func() {
@@ -861,6 +1148,318 @@ var _ = Describe("Query Parameters controller", func() {
 				Expect(err).To(BeNil())
 			})
 		})
+
+		Context("When Product number and Serial number have spaces, lowercase letters or an option suffix", func() {
+			It("returns them normalized", func() {
+				queryParams := map[string]string{
+					configs.ProductNumberQueryParam: " y0u23a#b19 ",
+					configs.SerialNumberQueryParam:  "\tmy97f1t00h",
+				}
+				productNumber, serialNumber, err := ExtractPrinterInfo(queryParams)
+
+				Expect(productNumber).To(Equal("Y0U23A#B19"))
+				Expect(serialNumber).To(Equal("MY97F1T00H"))
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("When Product number is malformed", func() {
+			It("returns malformed product number error", func() {
+				for _, productNumber := range []string{"CZ0", "CZ056A#", "CZ056A#B1", "CZ056A\" OR \"1\"=\"1", "CZ056A!SG4491P001", "CZ056ACZ056A"} {
+					queryParams := map[string]string{
+						configs.ProductNumberQueryParam: productNumber,
+					}
+					_, _, err := ExtractPrinterInfo(queryParams)
+
+					Expect(err).To(Equal(ErrorQueryStringMalformedProductNumber), productNumber)
+				}
+			})
+		})
+
+		Context("When Serial number is malformed", func() {
+			It("returns malformed serial number error", func() {
+				for _, serialNumber := range []string{"SG44", "SG4491P001SG4491P001", "SG4491-P001", "SG4491P001&x=1"} {
+					queryParams := map[string]string{
+						configs.ProductNumberQueryParam: "CZ056A",
+						configs.SerialNumberQueryParam:  serialNumber,
+					}
+					_, _, err := ExtractPrinterInfo(queryParams)
+
+					Expect(err).To(Equal(ErrorQueryStringMalformedSerialNumber), serialNumber)
+				}
+			})
+		})
+	})
+
+	Describe("Extract cursor from query parameters", func() {
+		startTime := time.Date(2020, 9, 16, 9, 0, 0, 0, time.UTC)
+		endTime := time.Date(2020, 9, 16, 10, 0, 0, 0, time.UTC)
+
+		Context("When the cursor is not present", func() {
+			It("returns no cursor and no error", func() {
+				_, ok, err := ExtractCursor(map[string]string{}, startTime, endTime)
+
+				Expect(ok).To(BeFalse())
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("When the cursor is inside the time range", func() {
+			It("returns the time of the cursor", func() {
+				cursorTime := time.Date(2020, 9, 16, 9, 30, 0, 0, time.UTC)
+				queryParams := map[string]string{
+					configs.CursorQueryParam: EncodeCursor(cursorTime, startTime, endTime),
+				}
+				result, ok, err := ExtractCursor(queryParams, startTime, endTime)
+
+				Expect(ok).To(BeTrue())
+				Expect(err).To(BeNil())
+				Expect(result.Position).To(Equal(cursorTime))
+				Expect(result.StartTime).To(Equal(startTime))
+				Expect(result.EndTime).To(Equal(endTime))
+			})
+		})
+
+		Context("When the cursor is outside the time range", func() {
+			It("returns unsupported cursor error", func() {
+				queryParams := map[string]string{
+					configs.CursorQueryParam: EncodeCursor(endTime.Add(time.Minute), startTime, endTime),
+				}
+				_, _, err := ExtractCursor(queryParams, startTime, endTime)
+
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedCursor))
+			})
+		})
+
+		Context("When the cursor is malformed", func() {
+			It("returns unsupported cursor error", func() {
+				queryParams := map[string]string{
+					configs.CursorQueryParam: "not a cursor!",
+				}
+				_, _, err := ExtractCursor(queryParams, startTime, endTime)
+
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedCursor))
+			})
+		})
+	})
+
+	Describe("Extract the time range of a page from query parameters", func() {
+		BeforeEach(func() {
+			configs.Init()
+		})
+
+		relativeQueryParams := func() map[string]string {
+			return map[string]string{
+				configs.TimeTypeQueryParam:    "relative",
+				configs.OffsetUnitsQueryParam: "minutes",
+				configs.OffsetValueQueryParam: "30",
+			}
+		}
+
+		Context("When there is no cursor", func() {
+			It("returns the time range and the page starts at its start", func() {
+				startTime, endTime, pageStart, err := ExtractPageTimeRange(relativeQueryParams(), configs.GetMaxTimeDiffInMinutes())
+
+				Expect(err).To(BeNil())
+				Expect(endTime.Sub(startTime)).To(Equal(30 * time.Minute))
+				Expect(pageStart).To(Equal(startTime))
+			})
+		})
+
+		Context("When the cursor contains the time range of the first page", func() {
+			It("returns the time range of the cursor instead of resolving the relative time range again", func() {
+				firstStart := time.Now().Add(-2 * time.Hour).Truncate(time.Second).UTC()
+				firstEnd := firstStart.Add(30 * time.Minute)
+				position := firstStart.Add(10 * time.Minute)
+				queryParams := relativeQueryParams()
+				queryParams[configs.CursorQueryParam] = EncodeCursor(position, firstStart, firstEnd)
+
+				startTime, endTime, pageStart, err := ExtractPageTimeRange(queryParams, configs.GetMaxTimeDiffInMinutes())
+
+				Expect(err).To(BeNil())
+				Expect(startTime).To(Equal(firstStart))
+				Expect(endTime).To(Equal(firstEnd))
+				Expect(pageStart).To(Equal(position))
+			})
+		})
+
+		Context("When the time range of the cursor is too big", func() {
+			It("returns unsupported cursor error", func() {
+				firstStart := time.Now().Add(-48 * time.Hour).Truncate(time.Second).UTC()
+				firstEnd := firstStart.Add(24 * time.Hour)
+				queryParams := relativeQueryParams()
+				queryParams[configs.CursorQueryParam] = EncodeCursor(firstStart, firstStart, firstEnd)
+
+				_, _, _, err := ExtractPageTimeRange(queryParams, configs.GetMaxTimeDiffInMinutes())
+
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedCursor))
+			})
+		})
+	})
+
+	Describe("Extract chunked from query parameters", func() {
+		BeforeEach(func() {
+			configs.Init()
+		})
+
+		Context("When chunked is not present", func() {
+			It("returns not chunked and the max time difference of a single query", func() {
+				chunked, err := ExtractChunked(map[string]string{})
+				Expect(chunked).To(BeFalse())
+				Expect(err).To(BeNil())
+
+				maxTimeDiff, err := ExtractMaxTimeDiffInMinutes(map[string]string{})
+				Expect(maxTimeDiff).To(Equal(configs.GetMaxTimeDiffInMinutes()))
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("When chunked is true", func() {
+			It("returns chunked and the max time difference of chunked queries", func() {
+				queryParams := map[string]string{
+					configs.ChunkedQueryParam: "true",
+				}
+
+				chunked, err := ExtractChunked(queryParams)
+				Expect(chunked).To(BeTrue())
+				Expect(err).To(BeNil())
+
+				maxTimeDiff, err := ExtractMaxTimeDiffInMinutes(queryParams)
+				Expect(maxTimeDiff).To(Equal(configs.GetMaxChunkedTimeDiffInMinutes()))
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("When chunked is not a boolean", func() {
+			It("returns unsupported chunked error", func() {
+				queryParams := map[string]string{
+					configs.ChunkedQueryParam: "maybe",
+				}
+
+				_, err := ExtractChunked(queryParams)
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedChunked))
+
+				_, err = ExtractMaxTimeDiffInMinutes(queryParams)
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedChunked))
+			})
+		})
+	})
+
+	Describe("Extract the object mode from query parameters", func() {
+		Context("When the mode is not present", func() {
+			It("returns the download mode", func() {
+				mode, err := ExtractObjectMode(map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(mode).To(Equal(DownloadObjectMode))
+			})
+		})
+
+		Context("When the mode is presign", func() {
+			It("returns the presign mode", func() {
+				mode, err := ExtractObjectMode(map[string]string{configs.ObjectModeQueryParam: "presign"})
+				Expect(err).To(BeNil())
+				Expect(mode).To(Equal(PresignObjectMode))
+			})
+		})
+
+		Context("When the mode is not supported", func() {
+			It("returns unsupported object mode error", func() {
+				_, err := ExtractObjectMode(map[string]string{configs.ObjectModeQueryParam: "upload"})
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedObjectMode))
+			})
+		})
+	})
+
+	Describe("Extract the object format from query parameters", func() {
+		Context("When the format is not present", func() {
+			It("returns the decoded format", func() {
+				format, err := ExtractObjectFormat(map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(format).To(Equal(DecodedObjectFormat))
+			})
+		})
+
+		Context("When the format is not supported", func() {
+			It("returns unsupported object format error", func() {
+				_, err := ExtractObjectFormat(map[string]string{configs.ObjectFormatQueryParam: "yaml"})
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedObjectFormat))
+			})
+		})
+	})
+
+	Describe("Extract the limit from query parameters", func() {
+		Context("When the limit is not present", func() {
+			It("returns the default limit", func() {
+				limit, err := ExtractLimit(map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(limit).To(BeEquivalentTo(DefaultPageLimit))
+			})
+		})
+
+		Context("When the limit is valid", func() {
+			It("returns it", func() {
+				limit, err := ExtractLimit(map[string]string{configs.LimitQueryParam: "25"})
+				Expect(err).To(BeNil())
+				Expect(limit).To(BeEquivalentTo(25))
+			})
+		})
+
+		for _, invalid := range []string{"0", "-3", "1001", "ten"} {
+			invalid := invalid
+			It("returns unsupported limit error when the limit is "+invalid, func() {
+				_, err := ExtractLimit(map[string]string{configs.LimitQueryParam: invalid})
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedLimit))
+			})
+		}
 	})
 
+	Describe("Extract consistent from query parameters", func() {
+		Context("When consistent is not present", func() {
+			It("returns not consistent", func() {
+				consistent, err := ExtractConsistent(map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(consistent).To(BeFalse())
+			})
+		})
+
+		Context("When consistent is true", func() {
+			It("returns consistent", func() {
+				consistent, err := ExtractConsistent(map[string]string{configs.ConsistentQueryParam: "true"})
+				Expect(err).To(BeNil())
+				Expect(consistent).To(BeTrue())
+			})
+		})
+
+		Context("When consistent is not a boolean", func() {
+			It("returns unsupported consistent error", func() {
+				_, err := ExtractConsistent(map[string]string{configs.ConsistentQueryParam: "strong"})
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedConsistent))
+			})
+		})
+	})
+
+	Describe("Extract include from query parameters", func() {
+		Context("When include is not present", func() {
+			It("returns that nothing is included", func() {
+				include, err := ExtractInclude(map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(include).To(BeEmpty())
+			})
+		})
+
+		Context("When include contains the subscriptions", func() {
+			It("returns that the subscriptions are included", func() {
+				include, err := ExtractInclude(map[string]string{configs.IncludeQueryParam: " Subscriptions, "})
+				Expect(err).To(BeNil())
+				Expect(include).To(Equal(map[string]bool{IncludeSubscriptions: true}))
+			})
+		})
+
+		Context("When include contains unsupported data", func() {
+			It("returns unsupported include error", func() {
+				_, err := ExtractInclude(map[string]string{configs.IncludeQueryParam: "subscriptions,accounts"})
+				Expect(err).To(Equal(ErrorQueryStringUnsupportedInclude))
+			})
+		})
+	})
 })
@@ -1,10 +1,31 @@
 package queryparams
 
+import (
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
+)
+
+// Names of the regions of the buckets of the printers. The standard names of the regions (us-east-1) are also
+// supported, as well as any region configured in configs.GetS3Regions.
 const (
 	UsEast1S3Region = "US_EAST_1"
 	UsWest1S3Region = "US_WEST_1"
 )
 
+// Modes of the object endpoint: the object itself, or a pre-signed URL to get it from S3.
+const (
+	DownloadObjectMode = "download"
+	PresignObjectMode  = "presign"
+)
+
+// Formats of the objects of the object endpoint: as they are stored, decompressed, pretty printed (XML and JSON)
+// or converted to JSON (XML).
+const (
+	RawObjectFormat     = "raw"
+	DecodedObjectFormat = "decoded"
+	PrettyObjectFormat  = "pretty"
+	JSONObjectFormat    = "json"
+)
+
 // ExtractS3Info  extracts the AWS S3 information from the query parameters and
 // returns the appropiate data and an error, if any.
 func ExtractS3Info(queryParameters map[string]string) (bucketRegion string, bucketName string, objectKey string, err error) {
@@ -17,11 +38,6 @@ func ExtractS3Info(queryParameters map[string]string) (bucketRegion string, buck
 		return
 	}
 
-	if bucketRegion != UsEast1S3Region && bucketRegion != UsWest1S3Region {
-		err = ErrorQueryStringUnsupportedBucketRegion
-		return
-	}
-
 	if bucketName == "" {
 		err = ErrorQueryStringMissingBucketName
 		return
@@ -34,3 +50,31 @@ func ExtractS3Info(queryParameters map[string]string) (bucketRegion string, buck
 
 	return bucketRegion, bucketName, objectKey, nil
 }
+
+// ExtractObjectMode extracts the mode of the object endpoint from the query parameters (DownloadObjectMode by default)
+// and returns it and an error, if any.
+func ExtractObjectMode(queryParameters map[string]string) (mode string, err error) {
+	mode = queryParameters[configs.ObjectModeQueryParam]
+	switch mode {
+	case "":
+		return DownloadObjectMode, nil
+	case DownloadObjectMode, PresignObjectMode:
+		return mode, nil
+	default:
+		return "", ErrorQueryStringUnsupportedObjectMode
+	}
+}
+
+// ExtractObjectFormat extracts the format of the object from the query parameters (DecodedObjectFormat by default)
+// and returns it and an error, if any.
+func ExtractObjectFormat(queryParameters map[string]string) (format string, err error) {
+	format = queryParameters[configs.ObjectFormatQueryParam]
+	switch format {
+	case "":
+		return DecodedObjectFormat, nil
+	case RawObjectFormat, DecodedObjectFormat, PrettyObjectFormat, JSONObjectFormat:
+		return format, nil
+	default:
+		return "", ErrorQueryStringUnsupportedObjectFormat
+	}
+}
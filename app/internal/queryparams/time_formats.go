@@ -0,0 +1,106 @@
+package queryparams
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// millisecondsEpochThreshold is the smallest epoch that is interpreted in milliseconds instead of seconds.
+// In seconds it is more than 3000 years in the future, and in milliseconds it is March 1973.
+const millisecondsEpochThreshold = 100000000000
+
+var (
+	// epochPattern are the epochs (in seconds or milliseconds).
+	epochPattern = regexp.MustCompile(`^-?[0-9]+$`)
+
+	// iso8601DurationPattern are the ISO 8601 durations with weeks, days, hours, minutes and seconds (like PT6H or P1DT12H).
+	// Years and months are not supported because their length is not fixed.
+	iso8601DurationPattern = regexp.MustCompile(`^P(?:([0-9]+)W)?(?:([0-9]+)D)?(?:T(?:([0-9]+)H)?(?:([0-9]+)M)?(?:([0-9]+(?:\.[0-9]+)?)S)?)?$`)
+
+	// daysDurationPattern are the durations in Go format optionally preceded by a number of days (like 1d12h).
+	daysDurationPattern = regexp.MustCompile(`^([0-9]+)d(.*)$`)
+)
+
+// parseTime converts s to the corresponding time in UTC. s can be an epoch in seconds, an epoch in milliseconds or
+// a time in RFC 3339 format (with any timezone offset, like 2020-09-16T11:25:00+02:00).
+func parseTime(s string) (time.Time, error) {
+	if epochPattern.MatchString(s) {
+		epoch, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if epoch >= millisecondsEpochThreshold || epoch <= -millisecondsEpochThreshold {
+			return time.Unix(epoch/1000, (epoch%1000)*int64(time.Millisecond)).UTC(), nil
+		}
+		return time.Unix(epoch, 0).UTC(), nil
+	}
+
+	// A '+' of a timezone offset that is not URL encoded arrives as a space.
+	t, err := time.Parse(time.RFC3339Nano, strings.Replace(s, " ", "+", 1))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// ParseDuration converts s, an ISO 8601 duration (like PT6H) or a Go duration with optional days (like 1d12h),
+// to a positive duration. It also returns an error if any.
+func ParseDuration(s string) (time.Duration, error) {
+	duration, err := parseDurationFormats(s)
+	if err != nil || duration <= 0 {
+		return 0, ErrorQueryStringUnsupportedDuration
+	}
+	return duration, nil
+}
+
+func parseDurationFormats(s string) (time.Duration, error) {
+	if strings.HasPrefix(s, "P") {
+		return parseISO8601Duration(s)
+	}
+
+	if matches := daysDurationPattern.FindStringSubmatch(s); matches != nil {
+		days, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || days > math.MaxInt64/int64(24*time.Hour) {
+			return 0, ErrorQueryStringUnsupportedDuration
+		}
+		duration := time.Duration(days) * 24 * time.Hour
+		if matches[2] == "" {
+			return duration, nil
+		}
+		rest, err := time.ParseDuration(matches[2])
+		if err != nil || rest < 0 {
+			return 0, ErrorQueryStringUnsupportedDuration
+		}
+		return duration + rest, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+func parseISO8601Duration(s string) (time.Duration, error) {
+	matches := iso8601DurationPattern.FindStringSubmatch(s)
+	if matches == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, ErrorQueryStringUnsupportedDuration
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var seconds float64
+	for i, unit := range units {
+		if matches[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0, ErrorQueryStringUnsupportedDuration
+		}
+		seconds += value * unit.Seconds()
+	}
+
+	if seconds > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, ErrorQueryStringUnsupportedDuration
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -3,6 +3,8 @@ package queryparams
 import (
 	"strconv"
 	"time"
+
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/configs"
 )
 
 // stringEpochToUTCTime converts an epoch string to the corresponding time in UTC.
@@ -16,46 +18,99 @@ func stringEpochToUTCTime(s string) (time.Time, error) {
 	return t.In(loc), nil
 }
 
-// processOffset returns an start time and end time based in offsetUnits and offsetValue.
-// It is used for the relative time in the api.
-// It also returns an error if any.
-func processOffset(offsetUnits, offsetValue string, maxTimeDiffInMinutes int) (startTime time.Time, endTime time.Time, err error) {
+// offsetUnits are the supported units of the relative time offsets.
+var offsetUnits = map[string]time.Duration{
+	"seconds": time.Second,
+	"minutes": time.Minute,
+	"hours":   time.Hour,
+	"days":    24 * time.Hour,
+}
+
+// processOffset returns the duration of offsetValue offsetUnits.
+// It returns ErrorQueryStringUnsupportedOffsetValue if it is not positive or it is longer than maxTimeDiffInMinutes.
+func processOffset(offsetUnits time.Duration, offsetValue string, maxTimeDiffInMinutes int) (offset time.Duration, err error) {
 	if offsetValue == "" {
-		return time.Time{}, time.Time{}, ErrorQueryStringMissingOffsetValue
+		return 0, ErrorQueryStringMissingOffsetValue
 	}
 
 	offsetValueInt, err := strconv.Atoi(offsetValue)
 	if err != nil {
-		return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedOffsetValue
+		return 0, ErrorQueryStringUnsupportedOffsetValue
 	}
 
-	var duration time.Duration
-	if offsetUnits == "minutes" {
-		if offsetValueInt > maxTimeDiffInMinutes {
-			return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedOffsetValue
+	if offsetValueInt < 1 || int64(offsetValueInt) > int64(maxTimeDiffInMinutes)*int64(time.Minute)/int64(offsetUnits) {
+		return 0, ErrorQueryStringUnsupportedOffsetValue
+	}
+	return offsetUnits * time.Duration(offsetValueInt), nil
+}
+
+// processDuration returns the duration of the duration query parameter.
+// It returns ErrorQueryStringTimeDifferenceTooBig if it is longer than maxTimeDiffInMinutes.
+func processDuration(duration string, maxTimeDiffInMinutes int) (time.Duration, error) {
+	d, err := ParseDuration(duration)
+	if err != nil {
+		return 0, err
+	}
+	if d > time.Duration(maxTimeDiffInMinutes)*time.Minute {
+		return 0, ErrorQueryStringTimeDifferenceTooBig
+	}
+	return d, nil
+}
+
+// processAnchorTime returns the time of the anchor_time query parameter, or now if it is empty.
+func processAnchorTime(anchorTime string) (time.Time, error) {
+	if anchorTime == "" {
+		return time.Now().UTC(), nil
+	}
+	anchor, err := parseTime(anchorTime)
+	if err != nil {
+		return time.Time{}, ErrorQueryStringUnsupportedAnchorTime
+	}
+	return anchor, nil
+}
+
+// processRelativeTime receives and start and end time as strings, ofsset untis and value (or a duration) and returns the appropiate start and end time.
+// It also returns an error if any.
+func processRelativeTime(startTimeEpoch, endTimeEpoch, units, offsetValue, duration, anchorTime string, maxTimeDiffInMinutes int) (startTime time.Time, endTime time.Time, err error) {
+	if startTimeEpoch != "" {
+		return time.Time{}, time.Time{}, ErrorQueryStringStartTimeAppears
+	}
+
+	if endTimeEpoch != "" {
+		return time.Time{}, time.Time{}, ErrorQueryStringEndTimeAppears
+	}
+
+	var offset time.Duration
+	if duration != "" {
+		if units != "" || offsetValue != "" {
+			return time.Time{}, time.Time{}, ErrorQueryStringDurationConflict
+		}
+		offset, err = processDuration(duration, maxTimeDiffInMinutes)
+	} else {
+		if units == "" {
+			return time.Time{}, time.Time{}, ErrorQueryStringMissingOffsetUnits
 		}
-		duration = time.Minute
 
-	} else if offsetUnits == "seconds" {
-		if offsetValueInt > 3600 {
-			return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedOffsetValue
+		unit, ok := offsetUnits[units]
+		if !ok {
+			return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedOffsetUnits
 		}
-		duration = time.Second
+		offset, err = processOffset(unit, offsetValue, maxTimeDiffInMinutes)
 	}
-
-	if offsetValueInt < 1 {
-		return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedOffsetValue
+	if err != nil {
+		return time.Time{}, time.Time{}, err
 	}
 
-	endTime = time.Now()
-	durationOffset := duration * time.Duration(offsetValueInt)
-	startTime = endTime.Add(-durationOffset)
-	return startTime.UTC(), endTime.UTC(), nil
+	endTime, err = processAnchorTime(anchorTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return endTime.Add(-offset), endTime, nil
 }
 
-// processRelativeTime receives and start and end time as strings, ofsset untis and value and returns the appropiate start and end time.
+// processAroundTime receives the anchor time and the durations before and after it and returns the appropiate start and end time.
 // It also returns an error if any.
-func processRelativeTime(startTimeEpoch, endTimeEpoch, offsetUnits, offsetValue string, maxTimeDiffInMinutes int) (startTime time.Time, endTime time.Time, err error) {
+func processAroundTime(startTimeEpoch, endTimeEpoch, anchorTime, before, after string, maxTimeDiffInMinutes int) (startTime time.Time, endTime time.Time, err error) {
 	if startTimeEpoch != "" {
 		return time.Time{}, time.Time{}, ErrorQueryStringStartTimeAppears
 	}
@@ -64,32 +119,66 @@ func processRelativeTime(startTimeEpoch, endTimeEpoch, offsetUnits, offsetValue
 		return time.Time{}, time.Time{}, ErrorQueryStringEndTimeAppears
 	}
 
-	if offsetUnits == "" {
-		return time.Time{}, time.Time{}, ErrorQueryStringMissingOffsetUnits
+	if anchorTime == "" {
+		return time.Time{}, time.Time{}, ErrorQueryStringMissingAnchorTime
+	}
+
+	anchor, err := processAnchorTime(anchorTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if before == "" && after == "" {
+		return time.Time{}, time.Time{}, ErrorQueryStringMissingAroundOffsets
+	}
+
+	var beforeDuration, afterDuration time.Duration
+	if before != "" {
+		if beforeDuration, err = ParseDuration(before); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if after != "" {
+		if afterDuration, err = ParseDuration(after); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
 	}
 
-	if offsetUnits != "minutes" && offsetUnits != "seconds" {
-		return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedOffsetUnits
+	maxTimeDiff := time.Duration(maxTimeDiffInMinutes) * time.Minute
+	if beforeDuration > maxTimeDiff || afterDuration > maxTimeDiff || beforeDuration+afterDuration > maxTimeDiff {
+		return time.Time{}, time.Time{}, ErrorQueryStringTimeDifferenceTooBig
 	}
-	return processOffset(offsetUnits, offsetValue, maxTimeDiffInMinutes)
+
+	return anchor.Add(-beforeDuration), anchor.Add(afterDuration), nil
 }
 
-// processRelativeTime receives and start and end timeas strings and returns the appropiate start and end time variables.
+// processAbsoluteTime receives and start and end time as strings (or a duration instead of the end time) and returns the appropiate start and end time variables.
 // It also returns an error if any.
-func processAbsoluteTime(startTimeEpoch, endTimeEpoch string, maxTimeDiffInMinutes int) (startTime time.Time, endTime time.Time, err error) {
+func processAbsoluteTime(startTimeEpoch, endTimeEpoch, duration string, maxTimeDiffInMinutes int) (startTime time.Time, endTime time.Time, err error) {
 	if startTimeEpoch == "" {
 		return time.Time{}, time.Time{}, ErrorQueryStringMissingStartTime
 	}
 
-	startTime, err = stringEpochToUTCTime(startTimeEpoch)
+	startTime, err = parseTime(startTimeEpoch)
 	if err != nil {
 		return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedStartTime
 	}
 
+	if duration != "" {
+		if endTimeEpoch != "" {
+			return time.Time{}, time.Time{}, ErrorQueryStringDurationConflict
+		}
+		d, err := processDuration(duration, maxTimeDiffInMinutes)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return startTime, startTime.Add(d), nil
+	}
+
 	if endTimeEpoch == "" {
 		return time.Time{}, time.Time{}, ErrorQueryStringMissingEndTime
 	}
-	endTime, err = stringEpochToUTCTime(endTimeEpoch)
+	endTime, err = parseTime(endTimeEpoch)
 	if err != nil {
 		return time.Time{}, time.Time{}, ErrorQueryStringUnsupportedEndTime
 	}
@@ -106,29 +195,41 @@ func processAbsoluteTime(startTimeEpoch, endTimeEpoch string, maxTimeDiffInMinut
 }
 
 // ExtractTimeRange extracts from the query parameters the appropiate start time and end time based in some
-// logic using start_time, end_time, offset_units and offset_value.
+// logic using start_time, end_time, offset_units, offset_value, duration, anchor_time, before and after.
 // It also returns an error if any.
 func ExtractTimeRange(queryParameters map[string]string, maxTimeDiffInMinutes int) (startTime time.Time, endTime time.Time, err error) {
-	timeType := queryParameters["time_type"]
+	timeType := queryParameters[configs.TimeTypeQueryParam]
 	if timeType == "" {
 		return time.Time{}, time.Time{}, ErrorQueryStringMissingTimeRangeType
 	}
 
-	startTimeEpoch := queryParameters["start_time"]
-	endTimeEpoch := queryParameters["end_time"]
+	startTimeEpoch := queryParameters[configs.StartTimeQueryParam]
+	endTimeEpoch := queryParameters[configs.EndTimeQueryParam]
+	duration := queryParameters[configs.DurationQueryParam]
+	anchorTime := queryParameters[configs.AnchorTimeQueryParam]
 	switch timeType {
 	case "relative":
-		offsetUnits := queryParameters["offset_units"]
-		offsetValue := queryParameters["offset_value"]
+		offsetUnits := queryParameters[configs.OffsetUnitsQueryParam]
+		offsetValue := queryParameters[configs.OffsetValueQueryParam]
 
-		startTime, endTime, err = processRelativeTime(startTimeEpoch, endTimeEpoch, offsetUnits, offsetValue, maxTimeDiffInMinutes)
+		startTime, endTime, err = processRelativeTime(startTimeEpoch, endTimeEpoch, offsetUnits, offsetValue, duration, anchorTime, maxTimeDiffInMinutes)
 		if err != nil {
 			return time.Time{}, time.Time{}, err
 		}
 		return startTime, endTime, nil
 
 	case "absolute":
-		startTime, endTime, err = processAbsoluteTime(startTimeEpoch, endTimeEpoch, maxTimeDiffInMinutes)
+		startTime, endTime, err = processAbsoluteTime(startTimeEpoch, endTimeEpoch, duration, maxTimeDiffInMinutes)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return startTime, endTime, nil
+
+	case "around":
+		before := queryParameters[configs.BeforeQueryParam]
+		after := queryParameters[configs.AfterQueryParam]
+
+		startTime, endTime, err = processAroundTime(startTimeEpoch, endTimeEpoch, anchorTime, before, after, maxTimeDiffInMinutes)
 		if err != nil {
 			return time.Time{}, time.Time{}, err
 		}
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encodings of the stored objects. IdentityEncoding is the encoding of the objects that are not compressed.
+const (
+	IdentityEncoding = "identity"
+	GzipEncoding     = "gzip"
+	ZipEncoding      = "zip"
+)
+
+// Types of the content of the stored objects (once decompressed). ZipContent is the type of the zip archives
+// with more than one file, which are not decompressed.
+const (
+	XMLContent    = "xml"
+	JSONContent   = "json"
+	TextContent   = "text"
+	BinaryContent = "binary"
+	ZipContent    = "zip"
+)
+
+// sniffLength is the amount of bytes used to detect the encoding and the type of the content.
+const sniffLength = 512
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+	utf8BOM   = []byte("\xef\xbb\xbf")
+)
+
+// DecodedContent is the content of a stored object, decompressed if it was compressed with Encoding.
+type DecodedContent struct {
+	Reader   io.Reader
+	Encoding string
+	Type     string
+}
+
+// MimeType returns the MIME type of the content.
+func (content *DecodedContent) MimeType() string {
+	return MimeType(content.Type)
+}
+
+// MimeType returns the MIME type of the type of content contentType.
+func MimeType(contentType string) string {
+	switch contentType {
+	case XMLContent:
+		return "application/xml"
+	case JSONContent:
+		return "application/json"
+	case TextContent:
+		return "text/plain; charset=utf-8"
+	case ZipContent:
+		return "application/zip"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// IsTextMimeType returns true if mimeType (optionally with parameters, like charset) is the MIME type of text:
+// text/*, JSON or XML (including their +json and +xml variants).
+func IsTextMimeType(mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return true
+	case mimeType == "application/json", mimeType == "application/xml":
+		return true
+	case strings.HasSuffix(mimeType, "+json"), strings.HasSuffix(mimeType, "+xml"):
+		return true
+	default:
+		return false
+	}
+}
+
+// DetectEncoding returns the encoding of the content starting with head: GzipEncoding, ZipEncoding or IdentityEncoding.
+func DetectEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return GzipEncoding
+	case bytes.HasPrefix(head, zipMagic):
+		return ZipEncoding
+	default:
+		return IdentityEncoding
+	}
+}
+
+// DetectType returns the type of the (not compressed) content starting with head: XMLContent, JSONContent,
+// TextContent or BinaryContent. head may be truncated, so JSON is detected by its first character.
+func DetectType(head []byte) string {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, utf8BOM), " \t\r\n")
+	if len(trimmed) == 0 {
+		return TextContent
+	}
+
+	if !isText(head) {
+		return BinaryContent
+	}
+	switch trimmed[0] {
+	case '<':
+		return XMLContent
+	case '{', '[':
+		return JSONContent
+	default:
+		return TextContent
+	}
+}
+
+// isText returns true if head is UTF-8 without control characters (other than whitespace).
+// The last rune of head may be truncated.
+func isText(head []byte) bool {
+	for len(head) > 0 {
+		r, size := utf8.DecodeRune(head)
+		if r == utf8.RuneError && size == 1 {
+			return len(head) < utf8.UTFMax && !utf8.FullRune(head)
+		}
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+		head = head[size:]
+	}
+	return true
+}
+
+// DecodeContent detects the encoding of body and returns its content decompressed, and its type.
+// Zip archives are read whole, up to maxBytes.
+func DecodeContent(body io.Reader, maxBytes int64) (*DecodedContent, error) {
+	reader := bufio.NewReaderSize(body, sniffLength)
+	head, err := reader.Peek(sniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	content := &DecodedContent{Reader: reader, Encoding: DetectEncoding(head)}
+	switch content.Encoding {
+	case GzipEncoding:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, ErrorMalformedContent
+		}
+		content.Reader = gzipReader
+	case ZipEncoding:
+		data, err := readAll(reader, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, ErrorMalformedContent
+		}
+
+		files := make([]*zip.File, 0, len(archive.File))
+		for _, file := range archive.File {
+			if !file.FileInfo().IsDir() {
+				files = append(files, file)
+			}
+		}
+		if len(files) != 1 {
+			content.Reader = bytes.NewReader(data)
+			content.Type = ZipContent
+			return content, nil
+		}
+
+		fileReader, err := files[0].Open()
+		if err != nil {
+			return nil, ErrorMalformedContent
+		}
+		content.Reader = fileReader
+	default:
+		content.Type = DetectType(head)
+		return content, nil
+	}
+
+	decoded := bufio.NewReaderSize(content.Reader, sniffLength)
+	head, err = decoded.Peek(sniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, ErrorMalformedContent
+	}
+	content.Reader = decoded
+	content.Type = DetectType(head)
+	return content, nil
+}
+
+// readAll reads reader until EOF, failing with ErrorObjectTooBig if there are more than maxBytes.
+func readAll(reader io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrorObjectTooBig
+	}
+	return data, nil
+}
+
+// ReadContent reads the whole content, failing with ErrorObjectTooBig if there are more than maxBytes.
+func ReadContent(content *DecodedContent, maxBytes int64) ([]byte, error) {
+	data, err := readAll(content.Reader, maxBytes)
+	if err != nil && err != ErrorObjectTooBig && content.Encoding != IdentityEncoding {
+		return nil, ErrorMalformedContent
+	}
+	return data, err
+}
+
+// PrettyPrint returns the XML or JSON data indented. Other types of content can't be pretty printed.
+func PrettyPrint(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case JSONContent:
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, bytes.TrimPrefix(data, utf8BOM), "", "  "); err != nil {
+			return nil, ErrorMalformedContent
+		}
+		return indented.Bytes(), nil
+	case XMLContent:
+		return indentXML(data)
+	default:
+		return nil, ErrorContentNotConvertible
+	}
+}
+
+// indentXML returns the XML data indented. The namespace prefixes are kept as they are.
+func indentXML(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	var indented bytes.Buffer
+	encoder := xml.NewEncoder(&indented)
+	encoder.Indent("", "  ")
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrorMalformedContent
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := xml.StartElement{Name: rawName(t.Name), Attr: make([]xml.Attr, 0, len(t.Attr))}
+			for _, attr := range t.Attr {
+				element.Attr = append(element.Attr, xml.Attr{Name: rawName(attr.Name), Value: attr.Value})
+			}
+			token = element
+		case xml.EndElement:
+			token = xml.EndElement{Name: rawName(t.Name)}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		}
+
+		if err := encoder.EncodeToken(xml.CopyToken(token)); err != nil {
+			return nil, ErrorMalformedContent
+		}
+		if _, ok := token.(xml.ProcInst); ok {
+			// the encoder only indents elements, so the declaration is followed by a new line here
+			if err := encoder.Flush(); err != nil {
+				return nil, err
+			}
+			indented.WriteByte('\n')
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+// rawName returns name with its namespace prefix as part of the local name, so the encoder writes it as it was.
+func rawName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+// xmlElement is an element of an XML document being converted to JSON.
+type xmlElement struct {
+	attributes map[string]string
+	children   map[string][]*xmlElement
+	text       strings.Builder
+}
+
+// value returns the JSON value of the element: its text if it has neither attributes nor children, or an object
+// with the attributes (prefixed with @), the children (an array when a name is repeated) and the text (#text).
+func (element *xmlElement) value() interface{} {
+	text := strings.TrimSpace(element.text.String())
+	if len(element.attributes) == 0 && len(element.children) == 0 {
+		return text
+	}
+
+	object := make(map[string]interface{}, len(element.attributes)+len(element.children)+1)
+	for name, value := range element.attributes {
+		object["@"+name] = value
+	}
+	for name, children := range element.children {
+		if len(children) == 1 {
+			object[name] = children[0].value()
+			continue
+		}
+		values := make([]interface{}, 0, len(children))
+		for _, child := range children {
+			values = append(values, child.value())
+		}
+		object[name] = values
+	}
+	if text != "" {
+		object["#text"] = text
+	}
+	return object
+}
+
+// XMLToJSON converts the XML data to indented JSON, with the attributes prefixed with @ and the text as #text.
+func XMLToJSON(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+
+	root := &xmlElement{children: make(map[string][]*xmlElement)}
+	stack := []*xmlElement{root}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrorMalformedContent
+		}
+
+		current := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &xmlElement{attributes: make(map[string]string), children: make(map[string][]*xmlElement)}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				element.attributes[attr.Name.Local] = attr.Value
+			}
+			current.children[t.Name.Local] = append(current.children[t.Name.Local], element)
+			stack = append(stack, element)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			current.text.Write(t)
+		}
+	}
+
+	if len(stack) != 1 || len(root.children) == 0 {
+		return nil, ErrorMalformedContent
+	}
+	root.text.Reset()
+	return json.MarshalIndent(root.value(), "", "  ")
+}
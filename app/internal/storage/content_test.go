@@ -0,0 +1,163 @@
+package storage_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
+)
+
+const maxBytes = 1024 * 1024
+
+func fixture(name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	Expect(err).To(BeNil())
+	return data
+}
+
+func decode(name string) (*DecodedContent, []byte) {
+	content, err := DecodeContent(bytes.NewReader(fixture(name)), maxBytes)
+	Expect(err).To(BeNil())
+	data, err := ReadContent(content, maxBytes)
+	Expect(err).To(BeNil())
+	return content, data
+}
+
+var _ = Describe("Content", func() {
+	Describe("DecodeContent", func() {
+		fixtures := []struct {
+			name     string
+			encoding string
+			kind     string
+			decoded  string
+		}{
+			{"openxml.xml", IdentityEncoding, XMLContent, "openxml.xml"},
+			{"cloudjson.json", IdentityEncoding, JSONContent, "cloudjson.json"},
+			{"cloudjson.json.gz", GzipEncoding, JSONContent, "cloudjson.json"},
+			{"openxml.zip", ZipEncoding, XMLContent, "openxml.xml"},
+			{"archive.zip", ZipEncoding, ZipContent, "archive.zip"},
+			{"plain.txt", IdentityEncoding, TextContent, "plain.txt"},
+			{"binary.bin", IdentityEncoding, BinaryContent, "binary.bin"},
+		}
+
+		for _, f := range fixtures {
+			f := f
+			It("detects the encoding and type of "+f.name+" and decompresses it", func() {
+				content, data := decode(f.name)
+
+				Expect(content.Encoding).To(Equal(f.encoding))
+				Expect(content.Type).To(Equal(f.kind))
+				Expect(data).To(Equal(fixture(f.decoded)))
+			})
+		}
+
+		Context("When a zip archive is bigger than the maximum", func() {
+			It("returns object too big error", func() {
+				_, err := DecodeContent(bytes.NewReader(fixture("archive.zip")), 100)
+
+				Expect(err).To(Equal(ErrorObjectTooBig))
+			})
+		})
+
+		Context("When the gzip content is truncated", func() {
+			It("returns malformed content error", func() {
+				gz := fixture("cloudjson.json.gz")
+				content, err := DecodeContent(bytes.NewReader(gz[:len(gz)-10]), maxBytes)
+				if err == nil {
+					_, err = ReadContent(content, maxBytes)
+				}
+
+				Expect(err).To(Equal(ErrorMalformedContent))
+			})
+		})
+	})
+
+	Describe("MimeType", func() {
+		It("returns the MIME type of each type of content", func() {
+			Expect(MimeType(XMLContent)).To(Equal("application/xml"))
+			Expect(MimeType(JSONContent)).To(Equal("application/json"))
+			Expect(MimeType(TextContent)).To(Equal("text/plain; charset=utf-8"))
+			Expect(MimeType(ZipContent)).To(Equal("application/zip"))
+			Expect(MimeType(BinaryContent)).To(Equal("application/octet-stream"))
+		})
+	})
+
+	Describe("IsTextMimeType", func() {
+		It("returns true only for text, JSON and XML", func() {
+			Expect(IsTextMimeType("text/plain; charset=utf-8")).To(BeTrue())
+			Expect(IsTextMimeType("Application/JSON")).To(BeTrue())
+			Expect(IsTextMimeType("application/soap+xml")).To(BeTrue())
+			Expect(IsTextMimeType("application/gzip")).To(BeFalse())
+			Expect(IsTextMimeType("application/octet-stream")).To(BeFalse())
+		})
+	})
+
+	Describe("PrettyPrint", func() {
+		Context("When the content is JSON", func() {
+			It("indents it", func() {
+				pretty, err := PrettyPrint(fixture("cloudjson.json"), JSONContent)
+
+				Expect(err).To(BeNil())
+				Expect(string(pretty)).To(HavePrefix("{\n  \"productNumber\": \"Y0U23A\",\n"))
+			})
+		})
+
+		Context("When the content is XML", func() {
+			It("indents it keeping the namespace prefixes", func() {
+				pretty, err := PrettyPrint(fixture("openxml.xml"), XMLContent)
+
+				Expect(err).To(BeNil())
+				Expect(string(pretty)).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<dd:DeviceData xmlns:dd="http://www.hp.com/schemas/imaging/con/ledm/devicedata/2007/10/30">
+  <dd:ProductNumber>Y0U23A</dd:ProductNumber>
+  <dd:SerialNumber>MY97F1T00H</dd:SerialNumber>
+  <dd:Counter unit="pages">10</dd:Counter>
+  <dd:Counter unit="sheets">5</dd:Counter>
+</dd:DeviceData>`))
+			})
+		})
+
+		Context("When the XML is malformed", func() {
+			It("returns malformed content error", func() {
+				_, err := PrettyPrint([]byte("<a><b></a>"), XMLContent)
+
+				Expect(err).To(Equal(ErrorMalformedContent))
+			})
+		})
+
+		Context("When the content is binary", func() {
+			It("returns content not convertible error", func() {
+				_, err := PrettyPrint(fixture("binary.bin"), BinaryContent)
+
+				Expect(err).To(Equal(ErrorContentNotConvertible))
+			})
+		})
+	})
+
+	Describe("XMLToJSON", func() {
+		It("converts the elements, attributes and repeated elements", func() {
+			converted, err := XMLToJSON(fixture("openxml.xml"))
+
+			Expect(err).To(BeNil())
+			Expect(converted).To(MatchJSON(`{
+				"DeviceData": {
+					"ProductNumber": "Y0U23A",
+					"SerialNumber": "MY97F1T00H",
+					"Counter": [{"@unit": "pages", "#text": "10"}, {"@unit": "sheets", "#text": "5"}]
+				}
+			}`))
+		})
+
+		Context("When the XML is malformed", func() {
+			It("returns malformed content error", func() {
+				_, err := XMLToJSON([]byte("<a><b></a>"))
+
+				Expect(err).To(Equal(ErrorMalformedContent))
+			})
+		})
+	})
+})
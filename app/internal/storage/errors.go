@@ -0,0 +1,18 @@
+package storage
+
+import (
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/errorTypes"
+)
+
+const (
+	ErrorUnsupportedRegion   = ConstError("region not supported by storage error")
+	ErrorAccessDenied        = ConstError("access to the object in storage denied error")
+	ErrorObjectNotFound      = ConstError("object not found in storage error")
+	ErrorRangeNotSatisfiable = ConstError("range not satisfiable by the object in storage error")
+	ErrorReadingObject       = ConstError("object in storage could not be read error")
+
+	ErrorObjectTooBig          = ConstError("object in storage too big to be decoded error")
+	ErrorMalformedContent      = ConstError("malformed content of the object in storage error")
+	ErrorContentNotConvertible = ConstError("content of the object in storage can't be converted to the format error")
+	ErrorRenderedObjectTooBig  = ConstError("object in storage too big to be returned rendered, use the raw format or the presign mode error")
+)
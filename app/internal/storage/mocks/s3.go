@@ -5,6 +5,8 @@
 package mocks
 
 import (
+	aws "github.com/aws/aws-sdk-go/aws"
+	request "github.com/aws/aws-sdk-go/aws/request"
 	s3 "github.com/aws/aws-sdk-go/service/s3"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
@@ -33,17 +35,37 @@ func (m *MockS3Fetcher) EXPECT() *MockS3FetcherMockRecorder {
 	return m.recorder
 }
 
-// GetObject mocks base method
-func (m *MockS3Fetcher) GetObject(arg0 *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+// GetObjectWithContext mocks base method
+func (m *MockS3Fetcher) GetObjectWithContext(arg0 aws.Context, arg1 *s3.GetObjectInput, arg2 ...request.Option) (*s3.GetObjectOutput, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetObject", arg0)
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetObjectWithContext", varargs...)
 	ret0, _ := ret[0].(*s3.GetObjectOutput)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetObject indicates an expected call of GetObject
-func (mr *MockS3FetcherMockRecorder) GetObject(arg0 interface{}) *gomock.Call {
+// GetObjectWithContext indicates an expected call of GetObjectWithContext
+func (mr *MockS3FetcherMockRecorder) GetObjectWithContext(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetObject", reflect.TypeOf((*MockS3Fetcher)(nil).GetObject), arg0)
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetObjectWithContext", reflect.TypeOf((*MockS3Fetcher)(nil).GetObjectWithContext), varargs...)
+}
+
+// GetObjectRequest mocks base method
+func (m *MockS3Fetcher) GetObjectRequest(arg0 *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetObjectRequest", arg0)
+	ret0, _ := ret[0].(*request.Request)
+	ret1, _ := ret[1].(*s3.GetObjectOutput)
+	return ret0, ret1
+}
+
+// GetObjectRequest indicates an expected call of GetObjectRequest
+func (mr *MockS3FetcherMockRecorder) GetObjectRequest(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetObjectRequest", reflect.TypeOf((*MockS3Fetcher)(nil).GetObjectRequest), arg0)
 }
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"strings"
+)
+
+// AccessPolicy is the key prefixes allowed in each bucket of each region. A bucket without prefixes is allowed
+// entirely, and an empty AccessPolicy allows no object.
+type AccessPolicy map[string]map[string][]string
+
+// Allows returns true if the object key of bucket in region is in the allow-list of the policy.
+func (policy AccessPolicy) Allows(region, bucket, key string) bool {
+	region = NormalizeRegion(region)
+	for policyRegion, buckets := range policy {
+		if NormalizeRegion(policyRegion) != region {
+			continue
+		}
+
+		prefixes, ok := buckets[bucket]
+		if !ok {
+			continue
+		}
+		if len(prefixes) == 0 {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// KeyBelongsToPrinter returns true if a segment of key starts with productNumber and serialNumber separated by an
+// exclamation mark (any serial number if it is empty).
+func KeyBelongsToPrinter(key, productNumber, serialNumber string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		i := strings.Index(segment, "!")
+		if i < 0 || !strings.EqualFold(segment[:i], productNumber) {
+			continue
+		}
+
+		rest := segment[i+1:]
+		if serialNumber == "" {
+			return true
+		}
+		if len(rest) >= len(serialNumber) && strings.EqualFold(rest[:len(serialNumber)], serialNumber) &&
+			(len(rest) == len(serialNumber) || !isAlphanumeric(rest[len(serialNumber)])) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAlphanumeric returns true if c is an ASCII letter or digit, which would continue a serial number.
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
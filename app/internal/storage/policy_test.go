@@ -0,0 +1,77 @@
+package storage_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
+)
+
+var _ = Describe("AccessPolicy", func() {
+	policy := AccessPolicy{
+		"US_EAST_1": {
+			"printer-uploads": {"uploads/raw/", "uploads/parsed/"},
+		},
+		"us-west-1": {
+			"blacksea": {},
+		},
+	}
+
+	objects := []struct {
+		region  string
+		bucket  string
+		key     string
+		allowed bool
+	}{
+		{"us-east-1", "printer-uploads", "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16", true},
+		{"US_EAST_1", "printer-uploads", "uploads/parsed/Y0U23A!MY97F1T00H.json", true},
+		{"us-east-1", "printer-uploads", "secrets/credentials", false},
+		{"us-east-1", "other-bucket", "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16", false},
+		{"US_WEST_1", "blacksea", "anything/at/all", true},
+		{"us-west-1", "printer-uploads", "uploads/raw/Y0U23A!MY97F1T00H_2020_09_16", false},
+		{"eu-central-1", "blacksea", "anything/at/all", false},
+	}
+
+	for _, o := range objects {
+		o := o
+		It("decides the access to "+o.region+"/"+o.bucket+"/"+o.key, func() {
+			Expect(policy.Allows(o.region, o.bucket, o.key)).To(Equal(o.allowed))
+		})
+	}
+
+	Context("When there is no policy", func() {
+		It("allows no object", func() {
+			Expect(AccessPolicy(nil).Allows("eu-central-1", "any-bucket", "any/key")).To(BeFalse())
+		})
+	})
+
+	Context("When the policy is empty", func() {
+		It("allows no object", func() {
+			Expect(AccessPolicy{}.Allows("us-east-1", "printer-uploads", "uploads/raw/key")).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("KeyBelongsToPrinter", func() {
+	keys := []struct {
+		key           string
+		productNumber string
+		serialNumber  string
+		belongs       bool
+	}{
+		{"uploads/raw/Y0U23A!MY97F1T00H_2020_09_16_09_24_57_813", "Y0U23A", "MY97F1T00H", true},
+		{"uploads/raw/Y0U23A!MY97F1T00H_2020_09_16_09_24_57_813", "Y0U23A", "", true},
+		{"uploads/raw/y0u23a!my97f1t00h.json", "Y0U23A", "MY97F1T00H", true},
+		{"uploads/raw/Y0U23A!MY97F1T00H2_2020_09_16", "Y0U23A", "MY97F1T00H", false},
+		{"uploads/raw/Y0U23A!CN12345678_2020_09_16", "Y0U23A", "MY97F1T00H", false},
+		{"uploads/raw/L2E27A!MY97F1T00H_2020_09_16", "Y0U23A", "MY97F1T00H", false},
+		{"uploads/raw/MY97F1T00H_2020_09_16", "Y0U23A", "MY97F1T00H", false},
+	}
+
+	for _, k := range keys {
+		k := k
+		It("decides if "+k.key+" belongs to "+k.productNumber+"!"+k.serialNumber, func() {
+			Expect(KeyBelongsToPrinter(k.key, k.productNumber, k.serialNumber)).To(Equal(k.belongs))
+		})
+	}
+})
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+)
+
+// S3Registry is an interface that defines a method to obtain the S3Fetcher of an AWS region.
+type S3Registry interface {
+	Fetcher(region string) (S3Fetcher, error)
+}
+
+// S3FetcherFactory creates the S3Fetcher of an AWS region (with its standard name, like us-east-1).
+type S3FetcherFactory func(region string) (S3Fetcher, error)
+
+// RegionRegistry is the S3Registry of the configured regions. The S3Fetcher of each region is created with the
+// factory the first time it is needed, and reused afterwards.
+type RegionRegistry struct {
+	regions map[string]bool
+	factory S3FetcherFactory
+
+	mutex    sync.Mutex
+	fetchers map[string]S3Fetcher
+}
+
+// NewRegionRegistry creates a RegionRegistry of regions, written in either style (us-east-1 or US_EAST_1).
+func NewRegionRegistry(regions []string, factory S3FetcherFactory) *RegionRegistry {
+	registry := &RegionRegistry{
+		regions:  make(map[string]bool, len(regions)),
+		factory:  factory,
+		fetchers: make(map[string]S3Fetcher, len(regions)),
+	}
+	for _, region := range regions {
+		registry.regions[NormalizeRegion(region)] = true
+	}
+	return registry
+}
+
+// NormalizeRegion returns the standard name of an AWS region written in either style: us-east-1 or US_EAST_1.
+func NormalizeRegion(region string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(region), "_", "-"))
+}
+
+// Fetcher returns the S3Fetcher of region (written in either style), or ErrorUnsupportedRegion if it is not
+// one of the regions of the registry.
+func (registry *RegionRegistry) Fetcher(region string) (S3Fetcher, error) {
+	region = NormalizeRegion(region)
+	if !registry.regions[region] {
+		return nil, ErrorUnsupportedRegion
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if fetcher, ok := registry.fetchers[region]; ok {
+		return fetcher, nil
+	}
+	fetcher, err := registry.factory(region)
+	if err != nil {
+		return nil, err
+	}
+	registry.fetchers[region] = fetcher
+	return fetcher, nil
+}
@@ -0,0 +1,84 @@
+package storage_test
+
+import (
+	"errors"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage"
+	"bitbucket.org/aldoft/printer-timeline-backend/app/internal/storage/mocks"
+)
+
+var _ = Describe("RegionRegistry", func() {
+	var mockCtrl *gomock.Controller
+	var created []string
+	var failing bool
+	var registry *RegionRegistry
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		created = nil
+		failing = false
+		registry = NewRegionRegistry([]string{"us-east-1", "US_WEST_1"}, func(region string) (S3Fetcher, error) {
+			if failing {
+				return nil, errors.New("no credentials")
+			}
+			created = append(created, region)
+			return mocks.NewMockS3Fetcher(mockCtrl), nil
+		})
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	Context("When the region is written in either style", func() {
+		It("returns the same fetcher, created only once", func() {
+			first, err := registry.Fetcher("US_EAST_1")
+			Expect(err).To(BeNil())
+			second, err := registry.Fetcher("us-east-1")
+			Expect(err).To(BeNil())
+
+			Expect(second).To(BeIdenticalTo(first))
+			Expect(created).To(Equal([]string{"us-east-1"}))
+		})
+
+		It("normalizes the configured regions too", func() {
+			_, err := registry.Fetcher("us-west-1")
+
+			Expect(err).To(BeNil())
+			Expect(created).To(Equal([]string{"us-west-1"}))
+		})
+	})
+
+	Context("When the region is not configured", func() {
+		It("returns unsupported region error without creating a fetcher", func() {
+			_, err := registry.Fetcher("EU_CENTRAL_1")
+
+			Expect(err).To(Equal(ErrorUnsupportedRegion))
+			Expect(created).To(BeEmpty())
+		})
+	})
+
+	Context("When the fetcher can't be created", func() {
+		It("returns the error and tries again the next time", func() {
+			failing = true
+			_, err := registry.Fetcher("us-west-1")
+			Expect(err).To(HaveOccurred())
+
+			failing = false
+			_, err = registry.Fetcher("us-west-1")
+			Expect(err).To(BeNil())
+			Expect(created).To(Equal([]string{"us-west-1"}))
+		})
+	})
+
+	Describe("NormalizeRegion", func() {
+		It("returns the standard name of the region", func() {
+			Expect(NormalizeRegion("US_EAST_1")).To(Equal("us-east-1"))
+			Expect(NormalizeRegion(" us-west-1 ")).To(Equal("us-west-1"))
+		})
+	})
+})
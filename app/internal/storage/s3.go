@@ -2,35 +2,71 @@
 package storage
 
 import (
-	"bytes"
-	"io"
+	"context"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-// S3Fetcher is an interface that defines a method to obtain the data.
+// S3Fetcher is an interface that defines the methods to obtain the data.
+// GetObjectRequest is used to pre-sign the requests of the objects that can't be returned directly.
 type S3Fetcher interface {
-	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	GetObjectWithContext(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+	GetObjectRequest(*s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
 }
 
-// GetS3Data returns the corresponding S3 element using a fetcher Interface passed as a parameter.
+// OpenS3Object returns the corresponding S3 element using a fetcher Interface passed as a parameter, without reading
+// its body, only byteRange of it if not empty. The caller has to close the body.
 // Every object that fulfills the interface S3Fetcher can be used to fetch the data. It is injected as a
 // parameter (dependency injection).
-func GetS3Data(fetcher S3Fetcher, bucket string, key string) ([]byte, error) {
-	results, err := fetcher.GetObject(&s3.GetObjectInput{
+func OpenS3Object(ctx context.Context, fetcher S3Fetcher, bucket string, key string, byteRange string) (*s3.GetObjectOutput, error) {
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
-	})
+	}
+	if byteRange != "" {
+		if !strings.HasPrefix(byteRange, "bytes=") {
+			return nil, ErrorRangeNotSatisfiable
+		}
+		input.Range = aws.String(byteRange)
+	}
 
+	results, err := fetcher.GetObjectWithContext(ctx, input)
 	if err != nil {
-		return nil, err
+		return nil, translateError(ctx, err)
+	}
+	return results, nil
+}
+
+// PresignS3Object returns a URL that allows to get the corresponding S3 element without credentials during ttl.
+func PresignS3Object(fetcher S3Fetcher, bucket string, key string, ttl time.Duration) (string, error) {
+	req, _ := fetcher.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(ttl)
+}
+
+// translateError returns the error of the package equivalent to the S3 error err, or err itself if there is none.
+func translateError(ctx context.Context, err error) error {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return err
 	}
-	defer results.Body.Close()
 
-	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, results.Body); err != nil {
-		return nil, err
+	switch awsErr.Code() {
+	case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, "NotFound":
+		return ErrorObjectNotFound
+	case "InvalidRange":
+		return ErrorRangeNotSatisfiable
+	case request.CanceledErrorCode:
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 	}
-	return buf.Bytes(), nil
+	return err
 }